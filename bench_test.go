@@ -0,0 +1,97 @@
+package sieve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/migadu/go-sieve/interp"
+)
+
+// nestedAnyof returns a test of depth nested anyof tests, each with a
+// header test that does not match.
+func nestedAnyof(depth int) string {
+	test := `header :contains "Subject" "present"`
+	for i := 0; i < depth; i++ {
+		test = fmt.Sprintf(`anyof(header :is "X-Level-%d" "yes", %s)`, i, test)
+	}
+	return test
+}
+
+// manyHeaders returns eml with n additional Received fields.
+func manyHeaders(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "Received: from relay%d.example.org by mx.example.org; Tue, 1 Apr 1997 09:06:31 -0800\n", i)
+	}
+	return b.String() + eml
+}
+
+// largeBody returns eml with its body repeated to about size bytes.
+func largeBody(size int) string {
+	hdr, body, _ := strings.Cut(eml, "\n\n")
+	return hdr + "\n\n" + strings.Repeat(body, size/len(body)+1)
+}
+
+var benchScripts = []struct {
+	name   string
+	script string
+	msg    string
+}{
+	{"header", `if header :contains "Subject" "present" { keep; }`, eml},
+	{"address-all", `if address :all :is ["From", "To"] "nobody@example.org" { discard; }`, eml},
+	{"regex", `require ["regex", "variables", "fileinto"];
+if header :regex "Subject" "^I have a ([a-z]+) for (you|me)$" { fileinto "${1}"; }`, eml},
+	{"large-message", `require "body"; if body :text :contains "not in the message" { discard; }`, largeBody(1 << 20)},
+	{"many-headers", `require "relational"; if header :count "ge" "Received" "500" { discard; }`, manyHeaders(1000)},
+	{"nested-anyof", `if ` + nestedAnyof(14) + ` { keep; }`, eml},
+}
+
+func BenchmarkLoad(b *testing.B) {
+	for _, bs := range benchScripts {
+		b.Run(bs.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Load(strings.NewReader(bs.script), benchOptions()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	ctx := context.Background()
+	for _, bs := range benchScripts {
+		b.Run(bs.name, func(b *testing.B) {
+			script, err := Load(strings.NewReader(bs.script), benchOptions())
+			if err != nil {
+				b.Fatal(err)
+			}
+			msg, err := interp.ReadMessage(strings.NewReader(bs.msg), interp.HeaderLimits{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			env := interp.EnvelopeStatic{From: "from@test.com", To: "to@test.com"}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				data := NewRuntimeData(script, interp.DummyPolicy{}, env, msg)
+				if err := script.Execute(ctx, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchOptions returns testOptions with "body" enabled and without the
+// execution step limit, which the benchmarks are not about.
+func benchOptions() Options {
+	opts := testOptions()
+	opts.EnabledExtensions = append(opts.EnabledExtensions, "body")
+	opts.Interp.MaxExecutionSteps = 0
+	return opts
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net/textproto"
 	"os"
 	"strings"
 	"time"
@@ -27,23 +25,14 @@ func main() {
 		log.Fatalln(err)
 	}
 	defer msg.Close()
-	fileInfo, err := msg.Stat()
-	if err != nil {
-		log.Fatalln(err)
-	}
-	msgHdr, err := textproto.NewReader(bufio.NewReader(msg)).ReadMIMEHeader()
-	if err != nil {
-		log.Fatalln(err)
-	}
 
-	script, err := os.Open(*scriptPath)
+	opts := sieve.DefaultOptions()
+	msgData, err := interp.ReadMessage(msg, opts.Interp.HeaderLimits)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	defer script.Close()
 
 	start := time.Now()
-	opts := sieve.DefaultOptions()
 	// Enable all extensions
 	opts.EnabledExtensions = []string{
 		"fileinto", "envelope", "encoded-character",
@@ -52,7 +41,7 @@ func main() {
 		"imap4flags", "variables", "relational", "vacation", "copy", "regex",
 		"date", "index", "editheader", "mailbox", "subaddress",
 	}
-	loadedScript, err := sieve.Load(script, opts)
+	loadedScript, err := sieve.LoadFile(*scriptPath, opts)
 	end := time.Now()
 	if err != nil {
 		log.Fatalln(err)
@@ -63,10 +52,6 @@ func main() {
 		From: *envFrom,
 		To:   *envTo,
 	}
-	msgData := interp.MessageStatic{
-		Size:   int(fileInfo.Size()),
-		Header: msgHdr,
-	}
 	data := sieve.NewRuntimeData(loadedScript, interp.DummyPolicy{},
 		envData, msgData)
 
@@ -82,6 +67,41 @@ func main() {
 	fmt.Println("fileinfo:", data.Mailboxes)
 	fmt.Println("keep:", data.ImplicitKeep || data.Keep)
 	fmt.Printf("flags: %s\n", strings.Join(data.Flags, " "))
+	if data.Keep {
+		fmt.Printf("keep flags: %s\n", strings.Join(data.KeepFlags, " "))
+	}
+
+	// Print header edits in the order they were made
+	if len(data.HeaderEdits) > 0 {
+		fmt.Println("header edits:")
+		for _, edit := range data.HeaderEdits {
+			switch edit.Action {
+			case "add":
+				where := "first"
+				if edit.Last {
+					where = "last"
+				}
+				fmt.Printf("  add (%s) %s: %s\n", where, edit.FieldName, edit.Value)
+			case "delete":
+				which := "all"
+				if edit.Index != 0 {
+					which = fmt.Sprintf("index %d", edit.Index)
+					if edit.Last {
+						which += " from last"
+					}
+				} else if edit.Value != "" {
+					which = "value"
+				}
+				if edit.Value != "" {
+					fmt.Printf("  delete (%s) %s: %s\n", which, edit.FieldName, edit.Value)
+				} else {
+					fmt.Printf("  delete (%s) %s\n", which, edit.FieldName)
+				}
+			}
+		}
+	} else {
+		fmt.Println("header edits: none")
+	}
 
 	// Print vacation responses
 	if len(data.VacationResponses) > 0 {
@@ -2,6 +2,8 @@ package sieve
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -12,6 +14,7 @@ func TestCopyExtension(t *testing.T) {
 		name       string
 		script     string
 		shouldFail bool
+		missing    string // extension the load error reports as not required
 		expected   Result
 	}{
 		{
@@ -34,11 +37,13 @@ func TestCopyExtension(t *testing.T) {
 			name:       "redirect :copy without require",
 			script:     `redirect :copy "user@example.com";`,
 			shouldFail: true,
+			missing:    "copy",
 		},
 		{
 			name:       "fileinto :copy without require",
 			script:     `require "fileinto"; fileinto :copy "Spam";`,
 			shouldFail: true,
+			missing:    "copy",
 		},
 	}
 
@@ -46,6 +51,17 @@ func TestCopyExtension(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ctx := context.Background()
 
+			if tc.missing != "" {
+				_, err := Load(strings.NewReader(tc.script), testOptions())
+				var reqErr ExtensionRequiredError
+				if !errors.As(err, &reqErr) {
+					t.Fatalf("Load error = %v, want ExtensionRequiredError", err)
+				}
+				if reqErr.Extension != tc.missing {
+					t.Errorf("Extension = %q, want %q", reqErr.Extension, tc.missing)
+				}
+			}
+
 			testExecute(ctx, t, tc.script, eml, tc.shouldFail, tc.expected)
 		})
 	}
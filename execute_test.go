@@ -3,10 +3,14 @@ package sieve
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/textproto"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/migadu/go-sieve/interp"
 )
@@ -33,10 +37,65 @@ type Result struct {
 	ImplicitKeep bool
 	Keep         bool
 	Flags        []string
+	KeepFlags    []string // flags of the explicit keep
+	Discarded    bool     // discard was executed
+	Vacation     bool     // a vacation response was recorded
 }
 
 func testExecute(ctx context.Context, t *testing.T, in string, eml string, shouldFail bool, intendedResult Result) {
 	t.Helper()
+	testExecuteOpts(ctx, t, in, eml, nil, shouldFail, intendedResult)
+}
+
+// testOptions returns the default options with all extensions enabled.
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.EnabledExtensions = []string{
+		"fileinto", "envelope", "encoded-character",
+		"comparator-i;octet", "comparator-i;ascii-casemap",
+		"comparator-i;ascii-numeric", "comparator-i;unicode-casemap",
+		"imap4flags", "variables", "relational", "vacation", "copy", "regex",
+		"date", "index", "editheader", "mailbox", "subaddress", "envelope-dsn",
+		"mime",
+	}
+	return opts
+}
+
+// testLoadFails checks that the script is rejected at load time.
+func testLoadFails(t *testing.T, in string) {
+	t.Helper()
+	if _, err := Load(strings.NewReader(in), testOptions()); err == nil {
+		t.Fatal("Load succeeded, expected an error")
+	}
+}
+
+// testLoadError checks that loading in fails with an error mentioning msg.
+func testLoadError(t *testing.T, in, msg string) {
+	t.Helper()
+	_, err := Load(strings.NewReader(in), testOptions())
+	if err == nil {
+		t.Fatal("Load succeeded, expected an error")
+	}
+	if !strings.Contains(err.Error(), msg) {
+		t.Fatalf("error %q does not contain %q", err, msg)
+	}
+}
+
+// testExecuteOpts is testExecute with a hook to adjust the default options
+// before the script is loaded.
+func testExecuteOpts(ctx context.Context, t *testing.T, in string, eml string, setOpts func(*Options), shouldFail bool, intendedResult Result) {
+	t.Helper()
+	env := interp.EnvelopeStatic{
+		From: "from@test.com",
+		To:   "to@test.com",
+	}
+	testExecuteEnv(ctx, t, in, eml, setOpts, env, interp.DummyPolicy{}, shouldFail, intendedResult)
+}
+
+// testExecuteEnv is testExecuteOpts with the envelope and the policy the
+// script is executed with.
+func testExecuteEnv(ctx context.Context, t *testing.T, in string, eml string, setOpts func(*Options), env interp.Envelope, policy interp.PolicyReader, shouldFail bool, intendedResult Result) {
+	t.Helper()
 
 	msgHdr, err := textproto.NewReader(bufio.NewReader(strings.NewReader(eml))).ReadMIMEHeader()
 	if err != nil {
@@ -45,14 +104,9 @@ func testExecute(ctx context.Context, t *testing.T, in string, eml string, shoul
 
 	script := bufio.NewReader(strings.NewReader(in))
 
-	// Enable all extensions for testing
-	opts := DefaultOptions()
-	opts.EnabledExtensions = []string{
-		"fileinto", "envelope", "encoded-character",
-		"comparator-i;octet", "comparator-i;ascii-casemap",
-		"comparator-i;ascii-numeric", "comparator-i;unicode-casemap",
-		"imap4flags", "variables", "relational", "vacation", "copy", "regex",
-		"date", "index", "editheader", "mailbox", "subaddress",
+	opts := testOptions()
+	if setOpts != nil {
+		setOpts(&opts)
 	}
 	loadedScript, err := Load(script, opts)
 	if err != nil {
@@ -61,15 +115,17 @@ func testExecute(ctx context.Context, t *testing.T, in string, eml string, shoul
 		}
 		t.Fatal(err)
 	}
-	env := interp.EnvelopeStatic{
-		From: "from@test.com",
-		To:   "to@test.com",
-	}
 	msg := interp.MessageStatic{
-		Size:   len(eml),
+		Size:   int64(len(eml)),
 		Header: msgHdr,
 	}
-	data := NewRuntimeData(loadedScript, interp.DummyPolicy{}, env, msg)
+	data := NewRuntimeData(loadedScript, policy, env, msg)
+	discarded := false
+	data.OnAction = func(a interp.Action) {
+		if a.Kind == interp.ActionDiscard {
+			discarded = true
+		}
+	}
 
 	if err := loadedScript.Execute(ctx, data); err != nil {
 		if shouldFail {
@@ -88,6 +144,9 @@ func testExecute(ctx context.Context, t *testing.T, in string, eml string, shoul
 		Keep:         data.Keep,
 		ImplicitKeep: data.ImplicitKeep,
 		Flags:        data.Flags,
+		KeepFlags:    data.KeepFlags,
+		Discarded:    discarded,
+		Vacation:     len(data.VacationResponses) != 0,
 	}
 
 	if !reflect.DeepEqual(r, intendedResult) {
@@ -112,13 +171,59 @@ func TestFileinto(t *testing.T) {
 			ImplicitKeep: false,
 		})
 	})
+	t.Run("empty-mailbox", func(t *testing.T) {
+		testLoadFails(t, `require "fileinto"; fileinto "";`)
+		testLoadFails(t, `require "fileinto"; fileinto "  ";`)
+	})
+	t.Run("tags", func(t *testing.T) {
+		for _, script := range []string{
+			`require ["fileinto", "copy"]; fileinto :copy "test";`,
+			`require ["fileinto", "mailbox"]; fileinto :create "test";`,
+			`require ["fileinto", "imap4flags"]; fileinto :flags "\\Seen" "test";`,
+			`require ["fileinto", "copy", "mailbox", "imap4flags"]; fileinto :flags "\\Seen" :create :copy "test";`,
+		} {
+			if _, err := Load(strings.NewReader(script), testOptions()); err != nil {
+				t.Errorf("%s: %v", script, err)
+			}
+		}
+		testLoadError(t, `require ["fileinto", "copy"]; fileinto :copy :copy "test";`, "1:46: LoadSpec: :copy specified more than once")
+		testLoadError(t, `require ["fileinto", "imap4flags"]; fileinto :flags "a" :flags "b" "test";`, ":flags specified more than once")
+		testLoadError(t, `require "copy"; redirect :copy :copy "a@example.org";`, ":copy specified more than once")
+		testLoadError(t, `require "imap4flags"; keep :flags "a" :flags "b";`, ":flags specified more than once")
+		testLoadError(t, `require "vacation"; vacation :days 3 :days 4 "away";`, ":days specified more than once")
+		// Neither special-use (RFC 8579) nor mailboxid (RFC 9042) is
+		// supported.
+		testLoadFails(t, `require "fileinto"; fileinto :specialuse "\\Junk" "Spam";`)
+		testLoadFails(t, `require "fileinto"; fileinto :mailboxid "F6352ae03" "Spam";`)
+	})
+	t.Run("empty-mailbox-variable", func(t *testing.T) {
+		script := `require ["fileinto", "variables"]; set "box" ""; fileinto "${box}";`
+		if _, err := Load(strings.NewReader(script), testOptions()); err != nil {
+			t.Fatal(err)
+		}
+		testExecute(ctx, t, script, eml, true, Result{})
+	})
 }
 
 func TestRedirect(t *testing.T) {
 	ctx := context.Background()
-	testExecute(ctx, t, `redirect "user@example.com";`, eml, false, Result{
-		Redirect:     []string{"user@example.com"},
-		ImplicitKeep: false,
+	t.Run("valid", func(t *testing.T) {
+		testExecute(ctx, t, `redirect "user@example.com";`, eml, false, Result{
+			Redirect:     []string{"user@example.com"},
+			ImplicitKeep: false,
+		})
+	})
+	t.Run("invalid", func(t *testing.T) {
+		testLoadFails(t, `redirect "not an address";`)
+		testLoadFails(t, `redirect "user@";`)
+		testLoadFails(t, `redirect "";`)
+	})
+	t.Run("invalid-variable", func(t *testing.T) {
+		script := `require "variables"; set "to" "not an address"; redirect "${to}";`
+		if _, err := Load(strings.NewReader(script), testOptions()); err != nil {
+			t.Fatal(err)
+		}
+		testExecute(ctx, t, script, eml, true, Result{})
 	})
 }
 
@@ -138,6 +243,180 @@ func TestAddress(t *testing.T) {
 			ImplicitKeep: true, // keep does NOT cancel implicit keep
 		})
 	})
+	t.Run("third-key-matches", func(t *testing.T) {
+		testExecute(ctx, t, `if address :is "From" ["a@b.c", "d@e.f", "coyote@desert.example.org"] { keep; }`, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("count-independent-of-keys", func(t *testing.T) {
+		script := `require "relational"; if address :count "eq" ["From", "To"] ["1", "3", "2"] { keep; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("localpart-casemap", func(t *testing.T) {
+		testExecute(ctx, t, `if address :localpart :is "From" "Coyote" { keep; }`, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("localpart-octet", func(t *testing.T) {
+		testExecute(ctx, t, `if address :comparator "i;octet" :localpart :is "From" "Coyote" { keep; }`, eml, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("domain-octet", func(t *testing.T) {
+		testExecute(ctx, t, `if address :comparator "i;octet" :domain :is "From" "DESERT.example.org" { keep; }`, eml, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	caseInsensitiveDomains := func(opts *Options) { opts.Interp.CaseInsensitiveDomains = true }
+	t.Run("domain-octet-case-insensitive", func(t *testing.T) {
+		testExecuteOpts(ctx, t, `if address :comparator "i;octet" :domain :is "From" "DESERT.example.org" { keep; }`, eml, caseInsensitiveDomains, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+		testExecuteOpts(ctx, t, `if address :comparator "i;octet" :domain :matches "From" "DESERT.*" { keep; }`, eml, caseInsensitiveDomains, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("localpart-octet-case-insensitive-domains", func(t *testing.T) {
+		// Only the domain part is affected.
+		testExecuteOpts(ctx, t, `if address :comparator "i;octet" :localpart :is "From" "Coyote" { keep; }`, eml, caseInsensitiveDomains, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("idn-domains", func(t *testing.T) {
+		idnDomains := func(opts *Options) { opts.Interp.Text.IDNDomains = true }
+		ace := strings.Replace(eml, "coyote@desert.example.org", "Coyote@xn--mnchen-3ya.de", 1)
+		unicode := strings.Replace(eml, "coyote@desert.example.org", "Coyote@münchen.de", 1)
+		for _, tc := range []struct {
+			name, msg, script string
+			keep              bool
+		}{
+			{"ace-header", ace, `if address :all :is "From" "coyote@münchen.de" { keep; }`, true},
+			{"unicode-header", unicode, `if address :all :is "From" "coyote@xn--mnchen-3ya.de" { keep; }`, true},
+			{"domain", ace, `if address :domain :is "From" "münchen.de" { keep; }`, true},
+			// The local-part is never converted and still follows the
+			// comparator.
+			{"localpart-octet", ace, `if address :comparator "i;octet" :all :is "From" "coyote@münchen.de" { keep; }`, false},
+			{"other-domain", ace, `if address :all :is "From" "coyote@munchen.de" { keep; }`, false},
+			{"matches", ace, `if address :all :matches "From" "*@münchen.de" { keep; }`, false},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				want := Result{ImplicitKeep: true, Keep: tc.keep}
+				testExecuteOpts(ctx, t, tc.script, tc.msg, idnDomains, false, want)
+			})
+		}
+		testExecute(ctx, t, `if address :all :is "From" "coyote@münchen.de" { keep; }`, ace, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	msg := strings.Replace(eml, "Subject:", "X-Original-Sender: Wile E. <wile@acme.example.com>\nSubject:", 1)
+	t.Run("custom-header-not-allowed", func(t *testing.T) {
+		testExecute(ctx, t, `if address :domain :is "X-Original-Sender" "acme.example.com" { keep; }`, msg, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("custom-header", func(t *testing.T) {
+		addressHeaders := func(opts *Options) { opts.Interp.AddressHeaders = []string{"x-original-SENDER"} }
+		testExecuteOpts(ctx, t, `if address :domain :is "X-Original-Sender" "acme.example.com" { keep; }`, msg, addressHeaders, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+		testExecuteOpts(ctx, t, `if address :all :is "x-original-sender" "wile@acme.example.com" { keep; }`, msg, addressHeaders, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("strict-unknown-header", func(t *testing.T) {
+		strict := func(opts *Options) {
+			opts.Interp.AddressHeaders = []string{"X-Original-Sender"}
+			opts.Interp.StrictAddressHeaders = true
+		}
+		testExecuteOpts(ctx, t, `if address :is "Subject" "x" { keep; }`, msg, strict, true, Result{})
+		testExecuteOpts(ctx, t, `if address :is ["From", "X-Original-Sender"] "wile@acme.example.com" { keep; }`, msg, strict, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+}
+
+// Email message with a From header that is not a valid address list
+var emlMalformedFrom string = `Date: Tue, 1 Apr 1997 09:06:31 -0800 (PST)
+From: coyote at desert.example.org
+To: roadrunner@acme.example.com
+Subject: Malformed sender
+
+Test message with a malformed From header
+`
+
+func TestAddressMalformed(t *testing.T) {
+	ctx := context.Background()
+	t.Run("all", func(t *testing.T) {
+		script := `if address :all :is "From" "coyote at desert.example.org" { keep; }`
+		testExecute(ctx, t, script, emlMalformedFrom, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("localpart", func(t *testing.T) {
+		script := `if address :localpart :contains "From" "coyote" { keep; }`
+		testExecute(ctx, t, script, emlMalformedFrom, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("domain", func(t *testing.T) {
+		script := `if address :domain :contains "From" "desert" { keep; }`
+		testExecute(ctx, t, script, emlMalformedFrom, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	literalFallback := func(opts *Options) {
+		opts.Interp.AddressLiteralFallback = true
+	}
+	t.Run("all-literal-fallback", func(t *testing.T) {
+		script := `if address :all :is "From" "coyote at desert.example.org" { keep; }`
+		testExecuteOpts(ctx, t, script, emlMalformedFrom, literalFallback, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("domain-literal-fallback", func(t *testing.T) {
+		script := `if address :domain :contains "From" "desert" { keep; }`
+		testExecuteOpts(ctx, t, script, emlMalformedFrom, literalFallback, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+}
+
+// emlResent is eml resent twice: each resend prepends its Resent-* block
+// (RFC 5322, Section 3.6.6), so the newest block comes first.
+var emlResent string = "Resent-From: newest@example.org\n" +
+	"Resent-To: list@example.org\n" +
+	"Resent-Date: Thu, 3 Apr 1997 09:06:31 -0800\n" +
+	"Resent-From: oldest@example.org\n" +
+	"Resent-To: archive@example.org\n" +
+	"Resent-Date: Wed, 2 Apr 1997 09:06:31 -0800\n" + eml
+
+func TestAddressResent(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		script string
+		result Result
+	}{
+		{"index-newest", `require "index"; if address :index 1 :is "Resent-From" "newest@example.org" { keep; }`, Result{Keep: true, ImplicitKeep: true}},
+		{"index-last-oldest", `require "index"; if address :index 1 :last :is "Resent-From" "oldest@example.org" { keep; }`, Result{Keep: true, ImplicitKeep: true}},
+		{"matches-newest-first", `require ["fileinto", "variables"]; if address :localpart :matches "Resent-From" "*" { fileinto "${1}"; }`, Result{Fileinto: []string{"newest"}}},
+		{"any-block", `if address :is "Resent-To" "archive@example.org" { keep; }`, Result{Keep: true, ImplicitKeep: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testExecute(ctx, t, tc.script, emlResent, false, tc.result)
+		})
+	}
 }
 
 func TestEnvelope(t *testing.T) {
@@ -154,6 +433,162 @@ func TestEnvelope(t *testing.T) {
 			ImplicitKeep: true,
 		})
 	})
+	t.Run("localpart-casemap", func(t *testing.T) {
+		testExecute(ctx, t, `require "envelope"; if envelope :localpart :is "from" "FROM" { keep; }`, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("localpart-octet", func(t *testing.T) {
+		testExecute(ctx, t, `require "envelope"; if envelope :comparator "i;octet" :localpart :is "from" "FROM" { keep; }`, eml, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("domain-octet", func(t *testing.T) {
+		script := `require "envelope"; if envelope :comparator "i;octet" :domain :is "from" "TEST.com" { keep; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			ImplicitKeep: true,
+		})
+		testExecuteOpts(ctx, t, script, eml, func(opts *Options) { opts.Interp.CaseInsensitiveDomains = true }, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+}
+
+func TestEnvelopeDSN(t *testing.T) {
+	ctx := context.Background()
+	env := interp.EnvelopeStatic{
+		From:   "from@test.com",
+		To:     "to@test.com",
+		ORcpt:  "Original@Example.com",
+		Notify: "SUCCESS,FAILURE",
+	}
+	for _, tc := range []struct {
+		name   string
+		script string
+		env    interp.Envelope
+		keep   bool
+	}{
+		{"orcpt", `require ["envelope", "envelope-dsn"]; if envelope :is "orcpt" "original@example.com" { keep; }`, env, true},
+		{"orcpt-domain", `require ["envelope", "envelope-dsn"]; if envelope :domain :is "orcpt" "example.com" { keep; }`, env, true},
+		{"notify", `require ["envelope", "envelope-dsn"]; if envelope :contains "notify" "FAILURE" { keep; }`, env, true},
+		{"orcpt-missing", `require ["envelope", "envelope-dsn"]; if envelope :matches "orcpt" "*" { keep; }`, interp.EnvelopeStatic{From: "from@test.com", To: "to@test.com"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			loadedScript, err := Load(strings.NewReader(tc.script), testOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := NewRuntimeData(loadedScript, interp.DummyPolicy{}, tc.env, interp.MessageStatic{})
+			if err := loadedScript.Execute(ctx, data); err != nil {
+				t.Fatal(err)
+			}
+			if data.Keep != tc.keep {
+				t.Errorf("keep = %v, want %v", data.Keep, tc.keep)
+			}
+		})
+	}
+	t.Run("unknown-part", func(t *testing.T) {
+		testLoadFails(t, `require "envelope"; if envelope :is "x-unknown" "a" { keep; }`)
+	})
+	t.Run("orcpt-without-require", func(t *testing.T) {
+		testLoadFails(t, `require "envelope"; if envelope :is "orcpt" "a@b.c" { keep; }`)
+	})
+}
+
+func TestEnvelopeNullSender(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		script string
+		from   string
+		keep   bool
+	}{
+		{"all-empty-key", `require "envelope"; if envelope :is "from" "" { keep; }`, "<>", true},
+		{"all-empty-key-empty-from", `require "envelope"; if envelope :is "from" "" { keep; }`, "", true},
+		{"all-empty-key-real-sender", `require "envelope"; if envelope :is "from" "" { keep; }`, "from@test.com", false},
+		{"domain-empty-key", `require "envelope"; if envelope :domain :is "from" "" { keep; }`, "<>", false},
+		{"localpart-empty-key", `require "envelope"; if envelope :localpart :is "from" "" { keep; }`, "<>", false},
+		{"localpart-matches-any", `require "envelope"; if envelope :localpart :matches "from" "*" { keep; }`, "", false},
+		{"mailer-daemon-all", `require "envelope"; if envelope :is "from" "MAILER-DAEMON" { keep; }`, "MAILER-DAEMON", true},
+		{"mailer-daemon-lower-case", `require "envelope"; if envelope :is "from" "MAILER-DAEMON" { keep; }`, "mailer-daemon", true},
+		{"mailer-daemon-bracketed-lower-case", `require "envelope"; if envelope :matches "from" "*" { keep; }`, "<mailer-daemon>", true},
+		{"mailer-daemon-at-lower-case", `require "envelope"; if envelope :matches "from" "*" { keep; }`, "mailer-daemon@", true},
+		{"mailer-daemon-domain", `require "envelope"; if envelope :domain :matches "from" "*" { keep; }`, "MAILER-DAEMON", false},
+		{"mailer-daemon-localpart", `require "envelope"; if envelope :localpart :is "from" "MAILER-DAEMON" { keep; }`, "MAILER-DAEMON", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := interp.EnvelopeStatic{From: tc.from, To: "to@test.com"}
+			testExecuteEnv(ctx, t, tc.script, eml, nil, env, interp.DummyPolicy{}, false, Result{
+				Keep:         tc.keep,
+				ImplicitKeep: true,
+			})
+		})
+	}
+}
+
+func TestEnvelopeRecipients(t *testing.T) {
+	ctx := context.Background()
+	env := interp.EnvelopeStatic{
+		From:   "from@test.com",
+		To:     "first@test.com",
+		ToList: []string{"first@test.com", "second@example.org"},
+	}
+	for _, tc := range []struct {
+		name   string
+		script string
+		keep   bool
+	}{
+		{"is-second", `require "envelope"; if envelope :is "to" "second@example.org" { keep; }`, true},
+		{"domain-second", `require "envelope"; if envelope :domain :is "to" "example.org" { keep; }`, true},
+		{"count", `require ["envelope", "relational"]; if envelope :count "eq" "to" "2" { keep; }`, true},
+		{"no-match", `require "envelope"; if envelope :is "to" "third@test.com" { keep; }`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testExecuteEnv(ctx, t, tc.script, eml, nil, env, interp.DummyPolicy{}, false, Result{
+				Keep:         tc.keep,
+				ImplicitKeep: true,
+			})
+		})
+	}
+	t.Run("count-three", func(t *testing.T) {
+		// Each recipient counts once, the null and invalid ones not at all.
+		env := interp.EnvelopeStatic{
+			From:   "from@test.com",
+			ToList: []string{"a@test.com", "b@test.com", "", "not an address", "c@example.org"},
+		}
+		testExecuteEnv(ctx, t, `require ["envelope", "relational"]; if envelope :count "eq" "to" "3" { keep; }`, eml, nil, env, interp.DummyPolicy{}, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+}
+
+func TestEmptyHeaderValue(t *testing.T) {
+	ctx := context.Background()
+	msg := "From: coyote@desert.example.org\r\nX-Empty:\r\nCc: \r\n\r\nbody\r\n"
+	for _, tc := range []struct {
+		name   string
+		script string
+		keep   bool
+	}{
+		{"exists", `if exists "X-Empty" { keep; }`, true},
+		{"exists-whitespace", `if exists "Cc" { keep; }`, true},
+		{"header-is-empty", `if header :is "X-Empty" "" { keep; }`, true},
+		{"header-is-other", `if header :is "X-Empty" "x" { keep; }`, false},
+		{"header-matches-any", `if header :matches "X-Empty" "*" { keep; }`, true},
+		{"address-is-empty", `if address :is "Cc" "" { keep; }`, true},
+		{"address-is-other", `if address :is "Cc" "x@example.org" { keep; }`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := Result{ImplicitKeep: true}
+			if tc.keep {
+				want.Keep = true
+			}
+			testExecute(ctx, t, tc.script, msg, false, want)
+		})
+	}
 }
 
 func TestExists(t *testing.T) {
@@ -207,6 +642,62 @@ func TestHeader(t *testing.T) {
 			ImplicitKeep: true,
 		})
 	})
+	// RFC 5228, Section 2.7.1: the test is true if any header matches any key
+	t.Run("third-key-matches", func(t *testing.T) {
+		testExecute(ctx, t, `if header :is "Subject" ["a", "b", "I have a present for you"] { keep; }`, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("second-header-third-key-matches", func(t *testing.T) {
+		testExecute(ctx, t, `if header :contains ["X-Missing", "To"] ["a@", "b@", "acme"] { keep; }`, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("no-key-matches", func(t *testing.T) {
+		testExecute(ctx, t, `if header :is "Subject" ["a", "b", "c"] { keep; }`, eml, false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("count-independent-of-keys", func(t *testing.T) {
+		// The count is the number of header values (2), whatever the keys;
+		// any key satisfying the relation makes the test true
+		script := `require "relational"; if header :count "eq" ["Subject", "To"] ["5", "7", "2"] { keep; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("unsupported-comparator", func(t *testing.T) {
+		// The error points at the comparator name, not at the test.
+		testLoadError(t, `if header :comparator "i;foo" "Subject" "x" { keep; }`, `1:23: unsupported comparator: i;foo`)
+		testLoadError(t, `require "envelope";
+if anyof (true, envelope :comparator ["i;bar"] "to" "x") { keep; }`, `2:38: unsupported comparator: i;bar`)
+	})
+	t.Run("encoded-words", func(t *testing.T) {
+		msg := "Subject: =?UTF-8?Q?Caf=C3=A9_menu?=\n" + eml
+		script := `require "imap4flags";
+		if header :is "Subject" "Café menu" { addflag "decoded"; }
+		if header :contains "Subject" "=?UTF-8?Q?Caf=C3=A9" { addflag "encoded"; }`
+		testExecute(ctx, t, script, msg, false, Result{
+			ImplicitKeep: true,
+			Flags:        []string{"decoded"},
+		})
+		testExecuteOpts(ctx, t, script, msg, func(o *Options) { o.Interp.Text.KeepEncodedWords = true }, false, Result{
+			ImplicitKeep: true,
+			Flags:        []string{"encoded"},
+		})
+	})
+	t.Run("mime-missing-require", func(t *testing.T) {
+		testLoadError(t, `if header :mime :anychild :param "filename" :matches "Content-Disposition" "*.exe" { discard; }`, "missing require 'mime'")
+	})
+	t.Run("param-without-mime", func(t *testing.T) {
+		testLoadError(t, `require "mime"; if header :param "filename" "Content-Disposition" "x.exe" { discard; }`, "only be specified with :mime")
+	})
+	t.Run("mime-two-options", func(t *testing.T) {
+		testLoadFails(t, `require "mime"; if header :mime :type :subtype "Content-Type" "text" { discard; }`)
+	})
 }
 
 func TestRegex(t *testing.T) {
@@ -235,6 +726,30 @@ func TestRegex(t *testing.T) {
 			ImplicitKeep: true, // keep does NOT cancel implicit keep
 		})
 	})
+	t.Run("regex-named-group", func(t *testing.T) {
+		// Named groups are set as variables alongside ${1}
+		script := `require ["fileinto", "regex", "variables"]; if header :comparator "i;octet" :regex "Subject" "I have a (?P<topic>\\w+) for (\\w+)" { fileinto "${topic}-${2}"; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			Fileinto: []string{"present-you"},
+		})
+	})
+	t.Run("regex-named-group-variable-key", func(t *testing.T) {
+		// Keys with variables are compiled when the test runs
+		script := `require ["fileinto", "regex", "variables"]; set "word" "have"; if header :comparator "i;octet" :regex "Subject" "I ${word} a (?P<topic>\\w+)" { fileinto "${topic}"; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			Fileinto: []string{"present"},
+		})
+	})
+	t.Run("regex-named-group-pattern-limit", func(t *testing.T) {
+		// Options.RegexLimits applies to patterns with named groups
+		pattern := strings.Repeat("(?:x?)", 200) + "I have a (?P<topic>\\\\w+)"
+		script := `require ["fileinto", "regex", "variables"]; if header :comparator "i;octet" :regex "Subject" "` + pattern + `" { fileinto "${topic}"; }`
+		testExecuteOpts(ctx, t, script, eml, func(o *Options) {
+			o.Interp.RegexLimits.MaxPatternLength = 2000
+		}, false, Result{
+			Fileinto: []string{"present"},
+		})
+	})
 	t.Run("regex-no-match", func(t *testing.T) {
 		// Test regex that doesn't match
 		script := `require "regex"; if header :regex "Subject" "No match pattern" { keep; }`
@@ -361,13 +876,44 @@ func TestSize(t *testing.T) {
 	})
 	t.Run("no-tag-error", func(t *testing.T) {
 		testExecute(ctx, t, `if size 100 { keep; }`, eml, true, Result{})
+		testLoadError(t, `if size 100 { keep; }`, "1:4: size requires exactly one of :over/:under")
 	})
 	t.Run("both-tags-error", func(t *testing.T) {
 		testExecute(ctx, t, `if size :over 100 :under 200 { keep; }`, eml, true, Result{})
+		testLoadError(t, `if size :over :under 100 { keep; }`, "1:4: size cannot specify both :over and :under")
 	})
 	t.Run("invalid-number-error", func(t *testing.T) {
 		testExecute(ctx, t, `if size :over "abc" { keep; }`, eml, true, Result{})
 	})
+	t.Run("number-too-large-error", func(t *testing.T) {
+		testLoadFails(t, `if size :over 9999999999G { keep; }`)
+	})
+	t.Run("above-max-int32", func(t *testing.T) {
+		// 3G = 3221225472, past math.MaxInt32
+		for _, tc := range []struct {
+			script string
+			size   int64
+			keep   bool
+		}{
+			{`if size :over 3G { keep; }`, 3<<30 + 1, true},
+			{`if size :over 3G { keep; }`, 3 << 30, false},
+			{`if size :under 3G { keep; }`, 3<<30 - 1, true},
+			{`if size :over 3221225471 { keep; }`, 3 << 30, true},
+			{`if size :under 2147483648 { keep; }`, math.MaxInt32 + 1, false},
+		} {
+			loadedScript, err := Load(strings.NewReader(tc.script), testOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := NewRuntimeData(loadedScript, interp.DummyPolicy{}, interp.EnvelopeStatic{}, interp.MessageStatic{Size: tc.size})
+			if err := loadedScript.Execute(ctx, data); err != nil {
+				t.Fatal(err)
+			}
+			if data.Keep != tc.keep {
+				t.Errorf("%s with size %d: keep = %v, want %v", tc.script, tc.size, data.Keep, tc.keep)
+			}
+		}
+	})
 }
 
 func TestDate(t *testing.T) {
@@ -419,6 +965,50 @@ func TestDate(t *testing.T) {
 			ImplicitKeep: true,
 		})
 	})
+	t.Run("date-std11", func(t *testing.T) {
+		// std11 is normalized: numeric zone, two-digit day, weekday added.
+		for _, date := range []string{
+			"Tue, 1 Apr 1997 17:06:31 GMT",
+			"Tue, 01 Apr 1997 17:06:31 +0000",
+			"1 Apr 1997 17:06:31 UT",
+		} {
+			msg := strings.Replace(eml, "Tue, 1 Apr 1997 09:06:31 -0800 (PST)", date, 1)
+			script := `require "date"; if date :is :originalzone "date" "std11" "Tue, 01 Apr 1997 17:06:31 +0000" { keep; }`
+			testExecute(ctx, t, script, msg, false, Result{
+				Keep:         true,
+				ImplicitKeep: true,
+			})
+		}
+	})
+	t.Run("date-std11-named-zone", func(t *testing.T) {
+		msg := strings.Replace(eml, "Tue, 1 Apr 1997 09:06:31 -0800 (PST)", "1 Apr 1997 12:06:31 EST", 1)
+		script := `require "date"; if date :is :originalzone "date" "std11" "Tue, 01 Apr 1997 12:06:31 -0500" { keep; }`
+		testExecute(ctx, t, script, msg, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("date-weekday-numbering", func(t *testing.T) {
+		for _, tc := range []struct {
+			date    string
+			iso     bool
+			weekday string
+		}{
+			{"Wed, 2 Apr 1997 09:06:31 -0800", false, "3"},
+			{"Wed, 2 Apr 1997 09:06:31 -0800", true, "3"},
+			{"Sun, 6 Apr 1997 09:06:31 -0800", false, "0"},
+			{"Sun, 6 Apr 1997 09:06:31 -0800", true, "7"},
+		} {
+			msg := strings.Replace(eml, "Tue, 1 Apr 1997 09:06:31 -0800 (PST)", tc.date, 1)
+			script := `require "date"; if date :is :originalzone "date" "weekday" "` + tc.weekday + `" { keep; }`
+			testExecuteOpts(ctx, t, script, msg, func(o *Options) {
+				o.Interp.ISOWeekday = tc.iso
+			}, false, Result{
+				Keep:         true,
+				ImplicitKeep: true,
+			})
+		}
+	})
 	t.Run("date-no-match", func(t *testing.T) {
 		script := `require "date"; if date :is :originalzone "date" "year" "2020" { keep; }`
 		testExecute(ctx, t, script, eml, false, Result{
@@ -433,6 +1023,19 @@ func TestDate(t *testing.T) {
 			ImplicitKeep: true,
 		})
 	})
+	t.Run("date-date-format", func(t *testing.T) {
+		// The "date" part is always "yyyy-mm-dd" (RFC 5260, Section 4.2)
+		// and keys are compared to it as strings: a key that is not
+		// zero-padded does not match.
+		script := `require ["date", "imap4flags"];
+		if date :is :originalzone "date" "date" "1997-04-01" { addflag "padded"; }
+		if date :is :originalzone "date" "date" "1997-4-1" { addflag "unpadded"; }
+		if date :matches :originalzone "date" "date" "1997-*" { addflag "matches"; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			ImplicitKeep: true,
+			Flags:        []string{"matches", "padded"},
+		})
+	})
 	t.Run("date-without-require-error", func(t *testing.T) {
 		script := `if date :is "date" "year" "1997" { keep; }`
 		testExecute(ctx, t, script, eml, true, Result{})
@@ -451,6 +1054,89 @@ func TestDate(t *testing.T) {
 			ImplicitKeep: true,
 		})
 	})
+	t.Run("date-and-currentdate", func(t *testing.T) {
+		// The message is from 1997-04-01 17:06:31 UTC, "now" is
+		// 1997-04-02 03:00 UTC: the same day at -0800, but not in UTC.
+		script := `require ["date", "variables"];
+		if allof (
+		  currentdate :matches "date" "*",
+		  date :is "date" "date" "${0}"
+		) {
+		  keep;
+		}`
+		clock := func(loc *time.Location) func(*Options) {
+			return func(o *Options) {
+				o.Interp.Clock = func() time.Time { return time.Date(1997, 4, 2, 3, 0, 0, 0, time.UTC) }
+				o.Interp.Location = loc
+			}
+		}
+		testExecuteOpts(ctx, t, script, eml, clock(time.FixedZone("", -8*3600)), false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+		testExecuteOpts(ctx, t, script, eml, clock(time.UTC), false, Result{
+			ImplicitKeep: true,
+		})
+	})
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	msg := "Cc: first@example.org\n" +
+		"Cc: second@example.org\n" +
+		"X-Date: Tue, 1 Apr 1997 09:06:31 -0800\n" +
+		"X-Date: Wed, 2 Apr 1997 09:06:31 -0800\n" + eml
+	kept := Result{Keep: true, ImplicitKeep: true}
+	notKept := Result{ImplicitKeep: true}
+
+	for _, tc := range []struct {
+		name   string
+		script string
+		result Result
+	}{
+		{"header", `if header :index 2 "Cc" "second@example.org" { keep; }`, kept},
+		{"header-last", `if header :index 1 :last "Cc" "second@example.org" { keep; }`, kept},
+		{"header-other-occurrence", `if header :index 1 "Cc" "second@example.org" { keep; }`, notKept},
+		{"header-out-of-range", `if header :index 3 :contains "Cc" "" { keep; }`, notKept},
+		{"address", `if address :index 2 :localpart "Cc" "second" { keep; }`, kept},
+		{"address-last", `if address :index 2 :last :localpart "Cc" "first" { keep; }`, kept},
+		{"address-out-of-range", `if address :index 3 :contains "Cc" "" { keep; }`, notKept},
+		{"date", `if date :index 2 :originalzone "X-Date" "day" "02" { keep; }`, kept},
+		{"date-last", `if date :index 2 :last :originalzone "X-Date" "day" "01" { keep; }`, kept},
+		{"deleteheader", `require "editheader"; deleteheader :index 2 "Cc"; if not header :is "Cc" "second@example.org" { keep; }`, kept},
+		{"deleteheader-last", `require "editheader"; deleteheader :index 1 :last "Cc"; if not header :is "Cc" "second@example.org" { keep; }`, kept},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testExecute(ctx, t, `require ["index", "date"]; `+tc.script, msg, false, tc.result)
+		})
+	}
+
+	t.Run("load-errors", func(t *testing.T) {
+		for _, script := range []string{
+			// :index needs require "index", except on deleteheader.
+			`if header :index 1 "Cc" "a" { keep; }`,
+			`if address :index 1 "Cc" "a" { keep; }`,
+			`require "date"; if date :index 1 "X-Date" "day" "01" { keep; }`,
+			// :last needs :index.
+			`require "index"; if header :last "Cc" "a" { keep; }`,
+			`require "index"; if address :last "Cc" "a" { keep; }`,
+			`require ["index", "date"]; if date :last "X-Date" "day" "01" { keep; }`,
+			`require "editheader"; deleteheader :last "Cc";`,
+			// :index is 1-based.
+			`require "index"; if header :index 0 "Cc" "a" { keep; }`,
+			`require "index"; if address :index 0 "Cc" "a" { keep; }`,
+			`require ["index", "date"]; if date :index 0 "X-Date" "day" "01" { keep; }`,
+			`require "editheader"; deleteheader :index 0 "Cc";`,
+		} {
+			if _, err := Load(strings.NewReader(script), testOptions()); err == nil {
+				t.Errorf("Load succeeded for %s", script)
+			}
+		}
+		script := `require "editheader"; deleteheader :index 1 :last "Cc";`
+		if _, err := Load(strings.NewReader(script), testOptions()); err != nil {
+			t.Errorf("deleteheader :index without require 'index': %v", err)
+		}
+	})
 }
 
 func TestEditheader(t *testing.T) {
@@ -489,6 +1175,14 @@ func TestEditheader(t *testing.T) {
 			ImplicitKeep: true,
 		})
 	})
+	t.Run("addheader-crlf-injection", func(t *testing.T) {
+		// A line break from a variable must not smuggle in another field
+		script := `require ["editheader", "variables", "encoded-character"];
+set "v" "x${hex:0D 0A}Bcc: attacker@evil.example";
+addheader "X-Test" "${v}";
+keep;`
+		testExecute(ctx, t, script, eml, true, Result{})
+	})
 	t.Run("deleteheader-protected-received", func(t *testing.T) {
 		// Deleting "Received" should be silently ignored (protected header)
 		script := `require "editheader"; deleteheader "Received"; keep;`
@@ -553,6 +1247,25 @@ func TestEditheader(t *testing.T) {
 			ImplicitKeep: true,
 		})
 	})
+	t.Run("deleteheader-encoded-word", func(t *testing.T) {
+		// deleteheader matches the field body as it appears in the
+		// message, while the header test sees the decoded value.
+		msg := "X-Note: =?UTF-8?Q?Caf=C3=A9?=\nX-Note: plain\n" + eml
+		script := `require ["editheader", "relational"];
+		deleteheader :is "X-Note" "Café";
+		if header :count "eq" "X-Note" "2" { keep; }`
+		testExecute(ctx, t, script, msg, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+		script = `require "editheader";
+		deleteheader :is "X-Note" "=?UTF-8?Q?Caf=C3=A9?=";
+		if not header :is "X-Note" "Café" { keep; }`
+		testExecute(ctx, t, script, msg, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
 	t.Run("addheader-multiple-same-name", func(t *testing.T) {
 		// Add multiple headers with same name
 		script := `require "editheader"; addheader "X-Test" "value1"; addheader "X-Test" "value2"; if header :contains "X-Test" "value1" { keep; }`
@@ -585,6 +1298,30 @@ func TestEditheader(t *testing.T) {
 			ImplicitKeep: true,
 		})
 	})
+	t.Run("deleteheader-index-twice", func(t *testing.T) {
+		// Each :index refers to the header as edited so far, so deleting
+		// index 1 twice removes two distinct occurrences.
+		msg := "X-Test: a\nX-Test: b\nX-Test: c\n" + eml
+		for _, tc := range []struct {
+			name, del, left string
+		}{
+			{"first", `deleteheader :index 1 "X-Test"`, "c"},
+			{"last", `deleteheader :index 1 :last "X-Test"`, "a"},
+			{"first-with-value", `deleteheader :index 1 :matches "X-Test" "*"`, "c"},
+			{"last-with-value", `deleteheader :index 1 :last :matches "X-Test" "*"`, "a"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				script := `require ["editheader", "relational", "imap4flags"];
+				` + tc.del + `; ` + tc.del + `;
+				if header :count "eq" "X-Test" "1" { addflag "one"; }
+				if header :is "X-Test" "` + tc.left + `" { addflag "left"; }`
+				testExecute(ctx, t, script, msg, false, Result{
+					ImplicitKeep: true,
+					Flags:        []string{"left", "one"},
+				})
+			})
+		}
+	})
 	t.Run("addheader-case-insensitive-check", func(t *testing.T) {
 		// Header names are case-insensitive
 		script := `require "editheader"; addheader "x-test" "hello"; if exists "X-TEST" { keep; }`
@@ -668,7 +1405,6 @@ func TestMailbox(t *testing.T) {
 		script := `require ["fileinto", "mailbox", "imap4flags"]; fileinto :create :flags "\\Seen" "Archive";`
 		testExecute(ctx, t, script, eml, false, Result{
 			Fileinto:     []string{"Archive"},
-			Flags:        []string{"\\seen"},
 			ImplicitKeep: false,
 		})
 	})
@@ -869,6 +1605,126 @@ func TestSubaddress(t *testing.T) {
 	})
 }
 
+// separatorPolicy uses "-" as the subaddress separator in dash.example.
+type separatorPolicy struct {
+	interp.DummyPolicy
+}
+
+func (separatorPolicy) SubaddressSeparatorFor(domain string) string {
+	if strings.EqualFold(domain, "dash.example") {
+		return "-"
+	}
+	return ""
+}
+
+func TestSubaddressSeparatorPolicy(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		script string
+		to     string
+		keep   bool
+	}{
+		{"plus-detail", `if envelope :detail "to" "lists" { keep; }`, "ken+lists@plus.example", true},
+		{"plus-user", `if envelope :user "to" "ken-x" { keep; }`, "ken-x+lists@plus.example", true},
+		{"dash-detail", `if envelope :detail "to" "lists" { keep; }`, "ken-lists@dash.example", true},
+		{"dash-user", `if envelope :user "to" "ken+x" { keep; }`, "ken+x-lists@dash.example", true},
+		{"dash-no-separator", `if envelope :detail "to" "lists" { keep; }`, "ken+lists@dash.example", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := interp.EnvelopeStatic{From: "from@test.com", To: tc.to}
+			testExecuteEnv(ctx, t, `require ["envelope", "subaddress"]; `+tc.script, eml, nil, env, separatorPolicy{}, false, Result{
+				Keep:         tc.keep,
+				ImplicitKeep: true,
+			})
+		})
+	}
+}
+
+// TestKeepDiscardOrdering checks RFC 5228 keep/discard semantics: discard
+// only cancels the implicit keep, while explicit actions always happen,
+// whatever their order.
+func TestKeepDiscardOrdering(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		script string
+		result Result
+	}{
+		{"keep-discard", `keep; discard;`, Result{Keep: true, Flags: []string{}, Discarded: true}},
+		{"discard-keep", `discard; keep;`, Result{Keep: true, Flags: []string{}, KeepFlags: []string{}, Discarded: true}},
+		{"fileinto-keep", `require "fileinto"; fileinto "A"; keep;`, Result{Fileinto: []string{"A"}, Keep: true}},
+		{"fileinto-discard", `require "fileinto"; fileinto "A"; discard;`, Result{Fileinto: []string{"A"}, Flags: []string{}, Discarded: true}},
+		{"discard-fileinto", `require "fileinto"; discard; fileinto "A";`, Result{Fileinto: []string{"A"}, Flags: []string{}, Discarded: true}},
+		{"keep", `keep;`, Result{Keep: true, ImplicitKeep: true}},
+		{"discard", `discard;`, Result{Flags: []string{}, Discarded: true}},
+		{"vacation-discard", `require "vacation"; vacation "Away."; discard;`, Result{Flags: []string{}, Discarded: true, Vacation: true}},
+		{"vacation", `require "vacation"; vacation "Away.";`, Result{ImplicitKeep: true, Vacation: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testExecute(ctx, t, tc.script, eml, false, tc.result)
+		})
+	}
+}
+
+func TestKeepRepeated(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		script string
+		result Result
+	}{
+		{"keep-keep", `keep; keep;`, Result{Keep: true, ImplicitKeep: true}},
+		{"flags-keep", `require "imap4flags"; keep :flags "A"; keep;`, Result{Keep: true, ImplicitKeep: true, KeepFlags: []string{"A"}}},
+		{"keep-flags", `require "imap4flags"; keep; keep :flags "A";`, Result{Keep: true, ImplicitKeep: true, KeepFlags: []string{"A"}}},
+		{"flags-flags", `require "imap4flags"; keep :flags "A"; keep :flags "B";`, Result{Keep: true, ImplicitKeep: true, KeepFlags: []string{"A", "B"}}},
+		{"current-flags", `require "imap4flags"; addflag "A"; keep; setflag "B"; keep;`, Result{Keep: true, ImplicitKeep: true, Flags: []string{"B"}, KeepFlags: []string{"A", "B"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testExecute(ctx, t, tc.script, eml, false, tc.result)
+		})
+	}
+}
+
+// TestStop checks that stop ends the script without undoing the actions
+// executed before it (RFC 5228, Section 3.3).
+func TestStop(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		script string
+		result Result
+	}{
+		{"fileinto", `require "fileinto"; fileinto "A"; stop; fileinto "B";`, Result{Fileinto: []string{"A"}}},
+		{"fileinto-copy", `require ["fileinto", "copy"]; fileinto :copy "A"; stop; discard;`, Result{Fileinto: []string{"A"}, ImplicitKeep: true}},
+		{"redirect", `redirect "a@example.org"; stop; redirect "b@example.org";`, Result{Redirect: []string{"a@example.org"}}},
+		{"keep", `keep; stop; discard;`, Result{Keep: true, ImplicitKeep: true}},
+		{"discard", `discard; stop; keep;`, Result{Flags: []string{}, Discarded: true}},
+		{"nested", `require "fileinto"; if true { fileinto "A"; if true { stop; } } fileinto "B";`, Result{Fileinto: []string{"A"}}},
+		{"flags", `require ["fileinto", "imap4flags"]; addflag "x"; fileinto "A"; stop; removeflag "x";`, Result{Fileinto: []string{"A"}, Flags: []string{"x"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testExecute(ctx, t, tc.script, eml, false, tc.result)
+		})
+	}
+}
+
+func TestDisableImplicitKeep(t *testing.T) {
+	ctx := context.Background()
+	disable := func(o *Options) { o.Interp.DisableImplicitKeep = true }
+	t.Run("no-action", func(t *testing.T) {
+		testExecuteOpts(ctx, t, `if false { keep; }`, eml, disable, false, Result{})
+	})
+	t.Run("keep", func(t *testing.T) {
+		testExecuteOpts(ctx, t, `keep;`, eml, disable, false, Result{Keep: true})
+	})
+	t.Run("fileinto-copy", func(t *testing.T) {
+		testExecuteOpts(ctx, t, `require ["fileinto", "copy"]; fileinto :copy "A";`, eml, disable, false, Result{
+			Fileinto: []string{"A"},
+		})
+	})
+}
+
 func TestFlags(t *testing.T) {
 	ctx := context.Background()
 	t.Run("set-add-remove", func(t *testing.T) {
@@ -888,10 +1744,12 @@ func TestFlags(t *testing.T) {
 		})
 	})
 	t.Run("case-insensitivity", func(t *testing.T) {
+		// Keywords are compared case-insensitively but keep their spelling
 		script := `require "imap4flags"; setflag "Seen"; addflag "FLAGGED"; removeflag "seen"; keep;`
 		testExecute(ctx, t, script, eml, false, Result{
 			Keep:         true,
-			Flags:        []string{"flagged"},
+			Flags:        []string{"FLAGGED"},
+			KeepFlags:    []string{"FLAGGED"},
 			ImplicitKeep: true, // keep does NOT cancel implicit keep
 		})
 	})
@@ -899,8 +1757,436 @@ func TestFlags(t *testing.T) {
 		script := `require "imap4flags"; keep :flags ["\\Answered", "MyFlag"];`
 		testExecute(ctx, t, script, eml, false, Result{
 			Keep:         true,
-			Flags:        []string{"\\answered", "myflag"},
+			KeepFlags:    []string{"MyFlag", "\\answered"},
 			ImplicitKeep: true, // keep does NOT cancel implicit keep
 		})
 	})
+	t.Run("fileinto-flags-space-separated", func(t *testing.T) {
+		script := `require ["fileinto", "imap4flags"]; fileinto :flags ["\\Seen \\Flagged", "Custom"] "test";`
+		testExecute(ctx, t, script, eml, false, Result{
+			Fileinto:     []string{"test"},
+			ImplicitKeep: false,
+		})
+	})
+	t.Run("fileinto-copy-flags", func(t *testing.T) {
+		for _, script := range []string{
+			`require ["fileinto", "copy", "imap4flags"]; fileinto :copy :flags ["\\Seen"] "Archive"; fileinto :copy :flags "\\Flagged" "Other";`,
+			`require ["fileinto", "copy", "imap4flags"]; fileinto :flags ["\\Seen"] :copy "Archive"; fileinto :copy :flags "\\Flagged" "Other";`,
+		} {
+			s, err := Load(strings.NewReader(script), testOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := NewRuntimeData(s, interp.DummyPolicy{}, interp.EnvelopeStatic{}, interp.MessageStatic{})
+			if err := s.Execute(ctx, d); err != nil {
+				t.Fatal(err)
+			}
+			if !d.ImplicitKeep {
+				t.Errorf("%s: fileinto :copy cancelled the implicit keep", script)
+			}
+			want := map[string][]string{"Archive": {"\\seen"}, "Other": {"\\flagged"}}
+			if !reflect.DeepEqual(d.MailboxFlags, want) {
+				t.Errorf("%s: MailboxFlags = %v, want %v", script, d.MailboxFlags, want)
+			}
+		}
+	})
+	t.Run("mailbox-flags-every-delivery", func(t *testing.T) {
+		script := `require ["fileinto", "copy", "imap4flags"]; setflag "\\Seen"; fileinto :copy "A"; keep :flags "\\Flagged"; fileinto "B";`
+		s, err := Load(strings.NewReader(script), testOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewRuntimeData(s, interp.DummyPolicy{}, interp.EnvelopeStatic{}, interp.MessageStatic{})
+		if err := s.Execute(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string][]string{"A": {"\\seen"}, "B": {"\\seen"}}
+		if !reflect.DeepEqual(d.MailboxFlags, want) {
+			t.Errorf("MailboxFlags = %v, want %v", d.MailboxFlags, want)
+		}
+		if want := []string{"\\flagged"}; !reflect.DeepEqual(d.KeepFlags, want) {
+			t.Errorf("KeepFlags = %v, want %v", d.KeepFlags, want)
+		}
+		if want := []string{"\\seen"}; !reflect.DeepEqual(d.Flags, want) {
+			t.Errorf("Flags = %v, want %v", d.Flags, want)
+		}
+	})
+	t.Run("keep-flags-duplicates-and-whitespace", func(t *testing.T) {
+		script := `require "imap4flags"; keep :flags ["  \\Seen	\\SEEN  Custom", "custom \\seen"];`
+		testExecute(ctx, t, script, eml, false, Result{
+			Keep:         true,
+			KeepFlags:    []string{"Custom", "\\seen"},
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("addflag-variable-with-spaces", func(t *testing.T) {
+		script := `require ["imap4flags", "variables"]; set "f" "\\Seen  Custom"; addflag "${f}"; keep;`
+		testExecute(ctx, t, script, eml, false, Result{
+			Keep:         true,
+			Flags:        []string{"Custom", "\\seen"},
+			KeepFlags:    []string{"Custom", "\\seen"},
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("invalid-flag-rejected", func(t *testing.T) {
+		script := `require "imap4flags"; addflag "foo(bar"; keep;`
+		testExecute(ctx, t, script, eml, true, Result{})
+	})
+	t.Run("invalid-flag-variable-rejected", func(t *testing.T) {
+		// A space separates flags, so it can only split a flag in two; other
+		// atom-specials are invalid wherever they come from
+		script := `require ["imap4flags", "variables"]; set "f" "ok bad*"; setflag "${f}"; keep;`
+		testExecute(ctx, t, script, eml, true, Result{})
+	})
+	dropInvalid := func(opts *Options) {
+		opts.Interp.DropInvalidFlags = true
+	}
+	t.Run("invalid-flag-dropped", func(t *testing.T) {
+		script := `require "imap4flags"; keep :flags ["Valid foo(bar", "\\", "a\"b", "\\Seen"];`
+		testExecuteOpts(ctx, t, script, eml, dropInvalid, false, Result{
+			Keep:         true,
+			KeepFlags:    []string{"Valid", "\\seen"},
+			ImplicitKeep: true,
+		})
+	})
+}
+
+// emlReceived returns eml with n Received headers prepended, as added by
+// successive relays. Every other header uses a lower-case field name.
+func emlReceived(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		name := "Received"
+		if i%2 == 1 {
+			name = "received"
+		}
+		fmt.Fprintf(&b, "%s: from relay%d.example.org by relay%d.example.org; Tue, 1 Apr 1997 09:06:%02d -0800\n", name, i, i+1, i)
+	}
+	return b.String() + eml
+}
+
+func TestCountReceivedHeaders(t *testing.T) {
+	ctx := context.Background()
+	script := `require ["relational", "comparator-i;ascii-numeric"];
+if header :count "ge" :comparator "i;ascii-numeric" "Received" "25" {
+	redirect "quarantine@example.com";
+}`
+	t.Run("loop", func(t *testing.T) {
+		testExecute(ctx, t, script, emlReceived(30), false, Result{
+			Redirect:     []string{"quarantine@example.com"},
+			ImplicitKeep: false,
+		})
+	})
+	t.Run("below-limit", func(t *testing.T) {
+		testExecute(ctx, t, script, emlReceived(24), false, Result{
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("exact", func(t *testing.T) {
+		script := `require "relational"; if header :count "eq" "Received" "30" { keep; }`
+		testExecute(ctx, t, script, emlReceived(30), false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+}
+
+func TestMatchesMultiValueHeader(t *testing.T) {
+	ctx := context.Background()
+	msg := "Received: from localhost with LMTP\n" +
+		"Received: from relay.example.org by mx.example.org; Tue, 1 Apr 1997 09:06:31 -0800\n" + eml
+	t.Run("captures-from-matching-value", func(t *testing.T) {
+		script := `require ["fileinto", "variables"];
+if header :matches "Received" "from * by *;*" {
+	fileinto "${1}";
+}`
+		testExecute(ctx, t, script, msg, false, Result{
+			Fileinto: []string{"relay.example.org"},
+		})
+	})
+	t.Run("failed-test-keeps-captures", func(t *testing.T) {
+		// RFC 5229, Section 3.2: match variables are only changed by a
+		// successful match.
+		script := `require ["fileinto", "variables"];
+if header :matches "Received" "from * by *;*" {}
+if header :matches "Received" "from * via *" {}
+fileinto "${2}";`
+		testExecute(ctx, t, script, msg, false, Result{
+			Fileinto: []string{"mx.example.org"},
+		})
+	})
+}
+
+func TestStringValueOrdering(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		script string
+		keep   bool
+	}{
+		// "B" (0x42) sorts before "a" (0x61) octet-wise...
+		{"octet-lt", `require ["variables", "relational"]; if string :value "lt" :comparator "i;octet" "B" "a" { keep; }`, true},
+		{"octet-gt", `require ["variables", "relational"]; if string :value "gt" :comparator "i;octet" "B" "a" { keep; }`, false},
+		// ...but after it once case is folded.
+		{"casemap-lt", `require ["variables", "relational"]; if string :value "lt" :comparator "i;ascii-casemap" "B" "a" { keep; }`, false},
+		{"casemap-gt", `require ["variables", "relational"]; if string :value "gt" :comparator "i;ascii-casemap" "B" "a" { keep; }`, true},
+		{"casemap-eq", `require ["variables", "relational"]; if string :value "eq" :comparator "i;ascii-casemap" "ABC" "abc" { keep; }`, true},
+		{"octet-ne", `require ["variables", "relational"]; if string :value "ne" :comparator "i;octet" "ABC" "abc" { keep; }`, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := Result{ImplicitKeep: true}
+			if tc.keep {
+				want.Keep = true
+			}
+			testExecute(ctx, t, tc.script, eml, false, want)
+		})
+	}
+}
+
+func TestDefaultComparator(t *testing.T) {
+	ctx := context.Background()
+	octet := func(opts *Options) { opts.Interp.DefaultComparator = interp.ComparatorOctet }
+	for _, tc := range []struct {
+		name      string
+		script    string
+		keep      bool
+		keepOctet bool
+	}{
+		{"header", `if header :contains "Subject" "PRESENT" { keep; }`, true, false},
+		{"header-exact-case", `if header :contains "Subject" "present" { keep; }`, true, true},
+		{"address", `if address :is "From" "Coyote@Desert.Example.org" { keep; }`, true, false},
+		// An explicit :comparator is not affected.
+		{"explicit", `if header :comparator "i;ascii-casemap" :contains "Subject" "PRESENT" { keep; }`, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testExecute(ctx, t, tc.script, eml, false, Result{ImplicitKeep: true, Keep: tc.keep})
+			testExecuteOpts(ctx, t, tc.script, eml, octet, false, Result{ImplicitKeep: true, Keep: tc.keepOctet})
+		})
+	}
+
+	numeric := func(opts *Options) { opts.Interp.DefaultComparator = interp.ComparatorASCIINumeric }
+	testExecuteOpts(ctx, t, `if header :contains "Subject" "present" { keep; }`, eml, numeric, true, Result{})
+	unknown := func(opts *Options) { opts.Interp.DefaultComparator = "i;nonsense" }
+	testExecuteOpts(ctx, t, `if header :is "Subject" "present" { keep; }`, eml, unknown, true, Result{})
+	testExecuteOpts(ctx, t, `keep;`, eml, unknown, true, Result{})
+}
+
+func TestStringCount(t *testing.T) {
+	ctx := context.Background()
+	t.Run("multi-item-variable", func(t *testing.T) {
+		// "a,b,,c" holds three non-empty items; the empty one is not counted
+		script := `require ["variables", "relational"]; set "mylist" "a,b,,c"; if string :count "eq" "${mylist}" "3" { keep; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("variables-and-literals", func(t *testing.T) {
+		script := `require ["variables", "relational"]; set "mylist" "a,b"; if string :count "eq" ["${mylist}", "c", ""] "3" { keep; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("empty-variable", func(t *testing.T) {
+		script := `require ["variables", "relational"]; set "mylist" ""; if string :count "eq" "${mylist}" "0" { keep; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("list-separator", func(t *testing.T) {
+		script := `require ["variables", "relational"]; set "mylist" "a b,c"; if string :count "eq" "${mylist}" "2" { keep; }`
+		testExecuteOpts(ctx, t, script, eml, func(o *Options) {
+			o.Interp.ListSeparator = " "
+		}, false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+}
+
+func TestMaxExecutionSteps(t *testing.T) {
+	ctx := context.Background()
+	// 1 if + 1 anyof + 20 exists tests + 1 keep = 23 steps.
+	script := `if anyof(` + strings.Repeat(`exists "X-Missing", `, 19) + `exists "Subject") { keep; }`
+	limit := func(n int) func(*Options) {
+		return func(opts *Options) { opts.Interp.MaxExecutionSteps = n }
+	}
+	t.Run("within-limit", func(t *testing.T) {
+		testExecuteOpts(ctx, t, script, eml, limit(23), false, Result{
+			Keep:         true,
+			ImplicitKeep: true,
+		})
+	})
+	t.Run("exceeded", func(t *testing.T) {
+		testExecuteOpts(ctx, t, script, eml, limit(10), true, Result{})
+
+		opts := testOptions()
+		opts.Interp.MaxExecutionSteps = 10
+		s, err := Load(strings.NewReader(script), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewRuntimeData(s, interp.DummyPolicy{}, interp.EnvelopeStatic{}, interp.MessageStatic{})
+		if err := s.Execute(ctx, d); !errors.Is(err, interp.ErrStepLimit) {
+			t.Fatalf("err = %v, want ErrStepLimit", err)
+		}
+	})
+	t.Run("per-execution", func(t *testing.T) {
+		opts := testOptions()
+		opts.Interp.MaxExecutionSteps = 23
+		s, err := Load(strings.NewReader(script), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := interp.MessageStatic{Header: textproto.MIMEHeader{"Subject": {"x"}}}
+		d := NewRuntimeData(s, interp.DummyPolicy{}, interp.EnvelopeStatic{}, msg)
+		for i := 0; i < 2; i++ {
+			if err := s.Execute(ctx, d); err != nil {
+				t.Fatalf("execution %d: %v", i+1, err)
+			}
+		}
+	})
+}
+
+func TestMaxComplexityScore(t *testing.T) {
+	load := func(script string, max int) error {
+		opts := testOptions()
+		opts.Interp.MaxComplexityScore = max
+		_, err := Load(strings.NewReader(script), opts)
+		return err
+	}
+
+	// if, header, keep and 2 :is keys.
+	normal := `if header :is "Subject" ["a", "b"] { keep; }`
+	s, err := Load(strings.NewReader(normal), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.ComplexityScore(); got != 5 {
+		t.Errorf("ComplexityScore() = %d, want 5", got)
+	}
+	if err := load(normal, 20); err != nil {
+		t.Errorf("normal script: %v", err)
+	}
+
+	var b strings.Builder
+	b.WriteString(`require ["regex", "fileinto"];`)
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&b, "\nif header :regex \"Subject\" [\"^a%d\", \"b%d$\"] { fileinto \"%d\"; }", i, i, i)
+	}
+	if err := load(b.String(), 100); !errors.Is(err, interp.ErrComplexityLimit) {
+		t.Errorf("regex-heavy script: err = %v, want ErrComplexityLimit", err)
+	}
+	if err := load(b.String(), 0); err != nil {
+		t.Errorf("regex-heavy script without a limit: %v", err)
+	}
+}
+
+func TestEncodedCharacter(t *testing.T) {
+	ctx := context.Background()
+	msg := "X-Literal: ${hex:41}\n" + eml
+	kept := Result{Keep: true, ImplicitKeep: true}
+	notKept := Result{ImplicitKeep: true}
+	for _, tc := range []struct {
+		name   string
+		script string
+		result Result
+	}{
+		{"hex", `require "encoded-character"; if header :contains "Subject" "${hex:70 72 65}sent" { keep; }`, kept},
+		{"unicode", `require "encoded-character"; if header :contains "Subject" "${unicode:70}resent" { keep; }`, kept},
+		{"string-list", `require "encoded-character"; if header :contains "Subject" ["absent", "${hex:70}resent"] { keep; }`, kept},
+		{"tag-argument", `require "encoded-character"; if header :comparator "i;${hex:6f}ctet" :is "Subject" "I have a present for you" { keep; }`, kept},
+		// Without the require the sequences are ordinary text.
+		{"hex-without-require", `if header :contains "Subject" "${hex:70 72 65}sent" { keep; }`, notKept},
+		{"literal-without-require", `if header :is "X-Literal" "${hex:41}" { keep; }`, kept},
+		{"literal-with-require", `require "encoded-character"; if header :is "X-Literal" "${hex:41}" { keep; }`, notKept},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testExecute(ctx, t, tc.script, msg, false, tc.result)
+		})
+	}
+	testLoadFails(t, `require "encoded-character"; if header :is "Subject" "${unicode:D800}" { keep; }`)
+}
+
+func TestRequire(t *testing.T) {
+	ctx := context.Background()
+	t.Run("separate-statements", func(t *testing.T) {
+		// Extensions from all require statements accumulate
+		script := `require "fileinto"; require ["envelope", "variables"];
+		if envelope :matches "from" "*@*" { set "box" "${2}"; fileinto "${box}"; }`
+		testExecute(ctx, t, script, eml, false, Result{
+			Fileinto:     []string{"test.com"},
+			ImplicitKeep: false,
+		})
+	})
+	t.Run("duplicate", func(t *testing.T) {
+		script := `require "fileinto"; require ["fileinto", "fileinto"]; fileinto "test";`
+		testExecute(ctx, t, script, eml, false, Result{
+			Fileinto:     []string{"test"},
+			ImplicitKeep: false,
+		})
+	})
+	t.Run("used-before-require", func(t *testing.T) {
+		script := `require "envelope"; fileinto "test"; require "fileinto";`
+		testExecute(ctx, t, script, eml, true, Result{})
+	})
+	t.Run("after-command", func(t *testing.T) {
+		script := `keep; require "fileinto";`
+		testExecute(ctx, t, script, eml, true, Result{})
+	})
+	t.Run("inside-block", func(t *testing.T) {
+		script := `if true { require "fileinto"; }`
+		testExecute(ctx, t, script, eml, true, Result{})
+	})
+	t.Run("missing-require-error", func(t *testing.T) {
+		// The missing extension is reported as an ExtensionRequiredError
+		// whichever check of the test finds it.
+		for _, tc := range []struct {
+			script  string
+			missing string
+		}{
+			{`if header :count "eq" "Received" "1" { keep; }`, "relational"},
+			{`if address :value "gt" "From" "a" { keep; }`, "relational"},
+			{`require "envelope"; if envelope :count "eq" "from" "1" { keep; }`, "relational"},
+			{`require "variables"; if string :count "eq" "a" "1" { keep; }`, "relational"},
+			{`require "date"; if date :value "gt" "Date" "year" "2000" { keep; }`, "relational"},
+			{`require "date"; if currentdate :value "gt" "year" "2000" { keep; }`, "relational"},
+			{`require "body"; if body :count "eq" "1" { keep; }`, "relational"},
+			{`if header :index 1 "Received" "a" { keep; }`, "index"},
+			{`if address :index 1 "From" "a" { keep; }`, "index"},
+			{`require "date"; if date :index 1 "Date" "year" "2000" { keep; }`, "index"},
+			{`if header :regex "Subject" "a" { keep; }`, "regex"},
+		} {
+			opts := testOptions()
+			opts.EnabledExtensions = append(opts.EnabledExtensions, "body")
+			_, err := Load(strings.NewReader(tc.script), opts)
+			var reqErr ExtensionRequiredError
+			if !errors.As(err, &reqErr) {
+				t.Errorf("%s: Load error = %v, want ExtensionRequiredError", tc.script, err)
+				continue
+			}
+			if reqErr.Extension != tc.missing {
+				t.Errorf("%s: Extension = %q, want %q", tc.script, reqErr.Extension, tc.missing)
+			}
+		}
+	})
+	t.Run("missing-require-position", func(t *testing.T) {
+		for _, tc := range []struct {
+			script, err string
+		}{
+			{`keep; if envelope :is "from" "a" { keep; }`, "1:10: missing require 'envelope'"},
+			{`keep; if date :is "Date" "year" "2000" { keep; }`, "1:10: missing require 'date'"},
+			{`keep; if currentdate :is "year" "2000" { keep; }`, "1:10: missing require 'date'"},
+			{`keep; if header :regex "Subject" "a" { keep; }`, "1:10: missing require 'regex'"},
+			{`require "variables"; if string :regex "a" "a" { keep; }`, "1:25: missing require 'regex'"},
+			{`keep; if string :is "a" "a" { keep; }`, "1:10: missing require 'variables'"},
+		} {
+			_, err := Load(strings.NewReader(tc.script), testOptions())
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s: Load error = %v, want %q", tc.script, err, tc.err)
+			}
+		}
+	})
 }
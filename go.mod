@@ -5,9 +5,9 @@ go 1.20
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/emersion/go-message v0.18.2
+	golang.org/x/net v0.20.0
+	golang.org/x/text v0.14.0
 	rsc.io/binaryregexp v0.2.0
 )
 
-require golang.org/x/text v0.14.0 // indirect
-
 replace github.com/emersion/go-message => github.com/migadu/go-message v0.0.0-20260705121217-8814c0e56d68
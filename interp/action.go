@@ -3,6 +3,8 @@ package interp
 import (
 	"context"
 	"fmt"
+	"net/mail"
+	"strings"
 )
 
 type CmdStop struct{}
@@ -20,6 +22,13 @@ type CmdFileInto struct {
 
 func (c CmdFileInto) Execute(_ context.Context, d *RuntimeData) error {
 	mailbox := expandVars(d, c.Mailbox)
+	if strings.TrimSpace(mailbox) == "" {
+		return fmt.Errorf("fileinto: mailbox name %q expands to an empty string", c.Mailbox)
+	}
+	if c.Create {
+		// The mailbox may exist from now on.
+		delete(d.mailboxExists, mailbox)
+	}
 	found := false
 	for _, m := range d.Mailboxes {
 		if m == mailbox {
@@ -50,9 +59,12 @@ func (c CmdFileInto) Execute(_ context.Context, d *RuntimeData) error {
 		d.ImplicitKeep = false
 	}
 
-	if c.Flags != nil {
-		d.Flags = canonicalFlags(expandVarsList(d, c.Flags), nil, d.FlagAliases)
+	flags, err := d.actionFlags(c.Flags)
+	if err != nil {
+		return err
 	}
+	d.recordMailboxFlags(mailbox, flags)
+	d.emit(Action{Kind: ActionFileInto, Target: mailbox, Flags: flags, Copy: c.Copy})
 	return nil
 }
 
@@ -63,6 +75,9 @@ type CmdRedirect struct {
 
 func (c CmdRedirect) Execute(ctx context.Context, d *RuntimeData) error {
 	addr := expandVars(d, c.Addr)
+	if err := checkRedirectAddr(addr); err != nil {
+		return fmt.Errorf("redirect: %v", err)
+	}
 
 	ok, err := d.Policy.RedirectAllowed(ctx, d, addr)
 	if err != nil {
@@ -81,9 +96,34 @@ func (c CmdRedirect) Execute(ctx context.Context, d *RuntimeData) error {
 	if len(d.RedirectAddr) > d.Script.opts.MaxRedirects {
 		return fmt.Errorf("too many actions")
 	}
+	d.emit(Action{
+		Kind:          ActionRedirect,
+		Target:        addr,
+		Copy:          c.Copy,
+		RewriteSender: d.Script.opts.RewriteRedirectSender,
+	})
+	return nil
+}
+
+// checkRedirectAddr checks that addr is a mailbox usable as an SMTP
+// forward-path (RFC 5228, Section 4.2): a local-part and a domain, optionally
+// with a display name.
+func checkRedirectAddr(addr string) error {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	if _, _, err := split(a.Address); err != nil {
+		return fmt.Errorf("invalid address %q: %v", addr, err)
+	}
 	return nil
 }
 
+// CmdKeep files the message into the default mailbox (RFC 5228, Section
+// 4.3). Unlike fileinto and redirect it does not cancel the implicit keep,
+// and a later discard does not cancel it. Repeating it delivers a single
+// copy: Keep stays set, KeepFlags accumulates the flags given to :flags, or
+// the current flags, of every keep, and each keep is reported to OnAction.
 type CmdKeep struct {
 	Flags Flags
 }
@@ -91,17 +131,51 @@ type CmdKeep struct {
 func (c CmdKeep) Execute(_ context.Context, d *RuntimeData) error {
 	d.Keep = true
 	// keep is a non-terminating action - it does NOT cancel implicit keep
-	if c.Flags != nil {
-		d.Flags = canonicalFlags(expandVarsList(d, c.Flags), nil, d.FlagAliases)
+	flags, err := d.actionFlags(c.Flags)
+	if err != nil {
+		return err
 	}
+	if d.KeepFlags == nil {
+		d.KeepFlags = flags
+	} else {
+		d.KeepFlags = canonicalFlags(append(append([]string{}, d.KeepFlags...), flags...), nil, d.FlagAliases)
+	}
+	d.emit(Action{Kind: ActionKeep, Flags: copyStrings(flags)})
 	return nil
 }
 
+// actionFlags returns the flags a keep or fileinto stores the message with:
+// those given to :flags, or else the current flags. :flags applies to that
+// action only and leaves the current flags unchanged (RFC 5232, Section 5).
+func (d *RuntimeData) actionFlags(flags Flags) ([]string, error) {
+	if flags == nil {
+		return copyStrings(d.Flags), nil
+	}
+	return checkFlags(d, canonicalFlags(expandVarsList(d, flags), nil, d.FlagAliases))
+}
+
+// recordMailboxFlags records flags as those the message is filed into
+// mailbox with, if the script uses imap4flags.
+func (d *RuntimeData) recordMailboxFlags(mailbox string, flags []string) {
+	if !d.Script.RequiresExtension("imap4flags") {
+		return
+	}
+	if d.MailboxFlags == nil {
+		d.MailboxFlags = make(map[string][]string)
+	}
+	d.MailboxFlags[mailbox] = copyStrings(flags)
+}
+
+// CmdDiscard cancels the implicit keep (RFC 5228, Section 4.5). Other
+// actions, including an explicit keep executed before or after it, still
+// happen: "keep; discard;" and "discard; keep;" both keep the message, and
+// "fileinto; discard;" only files it.
 type CmdDiscard struct{}
 
 func (c CmdDiscard) Execute(_ context.Context, d *RuntimeData) error {
 	d.ImplicitKeep = false
 	d.Flags = make([]string, 0)
+	d.emit(Action{Kind: ActionDiscard})
 	return nil
 }
 
@@ -111,7 +185,11 @@ type CmdSetFlag struct {
 
 func (c CmdSetFlag) Execute(_ context.Context, d *RuntimeData) error {
 	if c.Flags != nil {
-		d.Flags = canonicalFlags(expandVarsList(d, c.Flags), nil, d.FlagAliases)
+		flags, err := checkFlags(d, canonicalFlags(expandVarsList(d, c.Flags), nil, d.FlagAliases))
+		if err != nil {
+			return err
+		}
+		d.Flags = flags
 	}
 	return nil
 }
@@ -124,13 +202,12 @@ func (c CmdAddFlag) Execute(_ context.Context, d *RuntimeData) error {
 	if c.Flags != nil {
 		flags := expandVarsList(d, c.Flags)
 
-		if d.Flags == nil {
-			d.Flags = make([]string, len(flags))
-			copy(d.Flags, flags)
-		} else {
-			// Use canonicalFlags to remove duplicates
-			d.Flags = canonicalFlags(append(d.Flags, flags...), nil, d.FlagAliases)
+		// Use canonicalFlags to split and remove duplicates
+		flags, err := checkFlags(d, canonicalFlags(append(append([]string{}, d.Flags...), flags...), nil, d.FlagAliases))
+		if err != nil {
+			return err
 		}
+		d.Flags = flags
 	}
 	return nil
 }
@@ -146,3 +223,44 @@ func (c CmdRemoveFlag) Execute(_ context.Context, d *RuntimeData) error {
 	}
 	return nil
 }
+
+// isValidFlag reports whether f is a valid IMAP flag (RFC 3501):
+//
+//	flag           = "\\" atom / flag-keyword
+//	flag-keyword   = atom
+//	atom           = 1*ATOM-CHAR
+//	ATOM-CHAR      = <any CHAR except atom-specials>
+//	atom-specials  = "(" / ")" / "{" / SP / CTL / "%" / "*" / DQUOTE / "\\" / "]"
+func isValidFlag(f string) bool {
+	f = strings.TrimPrefix(f, "\\")
+	if f == "" {
+		return false
+	}
+	for i := 0; i < len(f); i++ {
+		c := f[i]
+		if c <= 0x20 || c >= 0x7f {
+			return false
+		}
+		switch c {
+		case '(', ')', '{', '%', '*', '"', '\\', ']':
+			return false
+		}
+	}
+	return true
+}
+
+// checkFlags validates flags before they are stored. Invalid flags fail the
+// script, or are dropped if Options.DropInvalidFlags is set.
+func checkFlags(d *RuntimeData, flags Flags) (Flags, error) {
+	valid := flags[:0:0]
+	for _, f := range flags {
+		if isValidFlag(f) {
+			valid = append(valid, f)
+			continue
+		}
+		if !d.Script.opts.DropInvalidFlags {
+			return nil, fmt.Errorf("imap4flags: invalid flag: %q", f)
+		}
+	}
+	return valid, nil
+}
@@ -0,0 +1,68 @@
+package interp
+
+import (
+	"testing"
+
+	"github.com/emersion/go-message/mail"
+)
+
+var addressValues = []string{
+	"coyote@desert.example.org",
+	"  coyote@desert.example.org\t",
+	"Wile Coyote <coyote@desert.example.org>",
+	"=?utf-8?q?Wile?= <coyote@desert.example.org>",
+	"first.last+tag@sub.example.org",
+	"o'brien@example.org",
+	// Not simple: parsed in full.
+	"<coyote@desert.example.org>",
+	"Wile E. Coyote <coyote@desert.example.org>",
+	`"Coyote, Wile" <coyote@desert.example.org>`,
+	"coyote@desert.example.org, roadrunner@acme.example.com",
+	"coyote(comment)@desert.example.org",
+	"coyote@[192.0.2.1]",
+	"co..yote@desert.example.org",
+	".coyote@desert.example.org",
+	"coyote@desert.example.org.",
+	"undisclosed-recipients:;",
+	"müller@example.org",
+	"coyote",
+	"",
+}
+
+func TestSimpleAddress(t *testing.T) {
+	simple := 0
+	for _, v := range addressValues {
+		addr, ok := simpleAddress(v)
+		if !ok {
+			continue
+		}
+		simple++
+		list, err := mail.ParseAddressList(v)
+		if err != nil || len(list) != 1 || list[0].Address != addr {
+			t.Errorf("simpleAddress(%q) = %q, but ParseAddressList gives %v, %v", v, addr, list, err)
+		}
+	}
+	if simple != 6 {
+		t.Errorf("%d values took the fast path, want 6", simple)
+	}
+}
+
+func BenchmarkAddressParse(b *testing.B) {
+	const value = "Wile Coyote <coyote@desert.example.org>"
+	b.Run("simple", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, ok := simpleAddress(value); !ok {
+				b.Fatal("not simple")
+			}
+		}
+	})
+	b.Run("full", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := mail.ParseAddressList(stripRFC2822Comments(value)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"html"
 	"io"
 	"mime"
@@ -19,6 +20,15 @@ var (
 	htmlSpaceRe = regexp.MustCompile(`[\s\p{Zs}]+`)
 )
 
+// TestBody is the body test (RFC 5173). The transform selects what is
+// searched:
+//   - :raw searches the undecoded body, MIME structure and attachments
+//     included.
+//   - :text searches only text/* and application/xhtml+xml parts, so
+//     images, archives and other attachments never cause a match.
+//   - :content searches the parts of the listed types; :content "" lists
+//     every type, attachments included, decoded from their transfer
+//     encoding.
 type TestBody struct {
 	matcherTest
 
@@ -44,6 +54,10 @@ func (t *TestBody) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 
 	if t.raw {
 		// For :raw, the whole raw body is treated as a single string.
+		// Only its first MaxBodyScan bytes are searched.
+		if max := d.Script.opts.MaxBodyScan; max > 0 && len(rawBody) > max {
+			rawBody = rawBody[:max]
+		}
 		if t.isCount() {
 			return t.countMatches(d, 1), nil
 		}
@@ -68,13 +82,24 @@ func (t *TestBody) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	}
 
 	count := uint64(0)
-	var walk func(h message.Header, b []byte) (bool, error)
-	walk = func(h message.Header, b []byte) (bool, error) {
+	parts := 0
+	var walk func(h message.Header, b []byte, depth int) (bool, error)
+	walk = func(h message.Header, b []byte, depth int) (bool, error) {
 		// Honour the script execution deadline while descending the MIME tree.
 		if err := ctx.Err(); err != nil {
 			return false, err
 		}
 
+		// Bound the work done on MIME bombs: every part, at any depth,
+		// counts towards the limit.
+		parts++
+		if max := d.Script.opts.MaxMimeParts; max > 0 && parts > max {
+			return false, fmt.Errorf("body: message has more than %d MIME parts", max)
+		}
+		if depth > maxMimeDepth {
+			return false, fmt.Errorf("body: MIME parts are nested more than %d levels deep", maxMimeDepth)
+		}
+
 		contentType := h.Get("Content-Type")
 		if contentType == "" {
 			contentType = "text/plain; charset=us-ascii"
@@ -132,35 +157,9 @@ func (t *TestBody) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 				return false, nil
 			}
 
-			// Split by boundary
-			dashBoundary := []byte("\n--" + boundary)
-			dashBoundary2 := []byte("\r\n--" + boundary)
-
-			// Find boundaries
-			var parts [][]byte
-			current := b
-			// A message without a MIME preamble starts directly with the
-			// first delimiter, with no preceding CRLF to search for.
-			if bytes.HasPrefix(current, []byte("--"+boundary)) {
-				parts = append(parts, nil)
-				current = current[len(boundary)+2:]
-			}
-			for {
-				idx := bytes.Index(current, dashBoundary2)
-				if idx == -1 {
-					idx = bytes.Index(current, dashBoundary)
-					if idx == -1 {
-						parts = append(parts, current)
-						break
-					} else {
-						parts = append(parts, current[:idx])
-						current = current[idx+len(dashBoundary):]
-					}
-				} else {
-					parts = append(parts, current[:idx])
-					current = current[idx+len(dashBoundary2):]
-				}
-			}
+			// A missing close delimiter leaves the rest of the body in
+			// the last part.
+			parts := splitMultipart(b, boundary)
 
 			// parts[0] is prologue
 			prologue := parts[0]
@@ -220,20 +219,6 @@ func (t *TestBody) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 					continue
 				}
 
-				// Read until the first blank line to find the body
-				idx := bytes.Index(p, []byte("\r\n\r\n"))
-				var partBody []byte
-				if idx != -1 {
-					partBody = p[idx+4:]
-				} else {
-					idx = bytes.Index(p, []byte("\n\n"))
-					if idx != -1 {
-						partBody = p[idx+2:]
-					} else {
-						partBody = nil
-					}
-				}
-
 				mh := message.Header{}
 				for k, vv := range partHdr {
 					for _, v := range vv {
@@ -241,7 +226,7 @@ func (t *TestBody) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 					}
 				}
 
-				match, err := walk(mh, partBody)
+				match, err := walk(mh, partBody(p), depth+1)
 				if err != nil {
 					return false, err
 				}
@@ -293,7 +278,7 @@ func (t *TestBody) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 						mh.Add(k, v)
 					}
 				}
-				match, err := walk(mh, nestedBody)
+				match, err := walk(mh, nestedBody, depth+1)
 				if err != nil {
 					return false, err
 				}
@@ -344,7 +329,7 @@ func (t *TestBody) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 		return false, nil
 	}
 
-	match, err := walk(hdr, rawBody)
+	match, err := walk(hdr, rawBody, 0)
 	if err != nil {
 		return false, err
 	}
@@ -358,3 +343,57 @@ func (t *TestBody) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 
 	return false, nil
 }
+
+// maxMimeDepth bounds how deeply the body test descends into nested
+// multipart and message/rfc822 parts.
+const maxMimeDepth = 100
+
+// splitMultipart splits a multipart body at its boundary delimiters (RFC
+// 2046, Section 5.1.1). The first element is the preamble; every other
+// element starts right after a delimiter, with the line break that ends it
+// or, for the close delimiter, with "--". Lines that merely start with the
+// delimiter, such as those of a nested multipart whose boundary extends this
+// one, do not split. If the close delimiter is missing, the last element
+// runs to the end of b.
+func splitMultipart(b []byte, boundary string) [][]byte {
+	delim := []byte("--" + boundary)
+	var parts [][]byte
+	start, pos := 0, 0
+	for {
+		idx := bytes.Index(b[pos:], delim)
+		if idx == -1 {
+			break
+		}
+		idx += pos
+		pos = idx + len(delim)
+		// A delimiter starts a line and ends it, except for transport
+		// padding, unless it is the close delimiter.
+		if idx > 0 && b[idx-1] != '\n' {
+			continue
+		}
+		rest := b[pos:]
+		if !bytes.HasPrefix(rest, []byte("--")) {
+			rest = bytes.TrimLeft(rest, " \t")
+			if len(rest) > 0 && rest[0] != '\r' && rest[0] != '\n' {
+				continue
+			}
+		}
+		end := idx
+		if end > 0 {
+			end-- // the line break before the delimiter belongs to it
+			if end > 0 && b[end-1] == '\r' {
+				end--
+			}
+		}
+		parts = append(parts, b[start:end])
+		start = len(b) - len(rest)
+		if bytes.HasPrefix(rest, []byte("--")) {
+			// The epilogue follows the close delimiter.
+			break
+		}
+	}
+	if len(parts) == 0 {
+		return [][]byte{b}
+	}
+	return append(parts, b[start:])
+}
@@ -0,0 +1,204 @@
+package interp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// wideMultipart returns a multipart/mixed body with n text parts.
+func wideMultipart(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "--b\r\nContent-Type: text/plain\r\n\r\npart %d\r\n", i)
+	}
+	b.WriteString("--b--\r\n")
+	return b.String()
+}
+
+// deepMultipart returns a multipart/mixed body nested depth levels deep,
+// with a single text part at the bottom.
+func deepMultipart(depth int) string {
+	body := "Content-Type: text/plain\r\n\r\nbottom\r\n"
+	for i := depth; i > 0; i-- {
+		body = fmt.Sprintf("Content-Type: multipart/mixed; boundary=b%d.\r\n\r\n--b%d.\r\n%s--b%d.--\r\n", i, i, body, i)
+	}
+	return body
+}
+
+func TestBodyMaxMimeParts(t *testing.T) {
+	run := func(t *testing.T, key, contentType, body string) (bool, error) {
+		t.Helper()
+		d, err := runBodyScript(t, &Options{MaxMimeParts: 10}, `require "body"; if body :text :contains "`+key+`" { keep; }`, contentType, body)
+		return d.Keep, err
+	}
+
+	t.Run("within-limit", func(t *testing.T) {
+		keep, err := run(t, "part 8", "multipart/mixed; boundary=b", wideMultipart(9))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !keep {
+			t.Error("body did not match a message within the part limit")
+		}
+	})
+	t.Run("wide", func(t *testing.T) {
+		if _, err := run(t, "nowhere", "multipart/mixed; boundary=b", wideMultipart(50)); err == nil {
+			t.Error("expected an error for a message with 51 parts")
+		}
+	})
+	t.Run("deep-within-limit", func(t *testing.T) {
+		body := deepMultipart(5)
+		contentType, rest, _ := strings.Cut(body, "\r\n\r\n")
+		keep, err := run(t, "bottom", strings.TrimPrefix(contentType, "Content-Type: "), rest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !keep {
+			t.Error("body did not match a nested message within the part limit")
+		}
+	})
+	t.Run("deep", func(t *testing.T) {
+		body := deepMultipart(20)
+		contentType, rest, _ := strings.Cut(body, "\r\n\r\n")
+		if _, err := run(t, "bottom", strings.TrimPrefix(contentType, "Content-Type: "), rest); err == nil {
+			t.Error("expected an error for a message nested 20 levels deep")
+		}
+	})
+}
+
+func TestBodyRawMaxBodyScan(t *testing.T) {
+	body := strings.Repeat("filler ", 100) + "keyword\r\n"
+	for _, tc := range []struct {
+		name string
+		max  int
+		keep bool
+	}{
+		{"unlimited", 0, true},
+		{"beyond-limit", 100, false},
+		{"within-limit", len(body), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := runBodyScript(t, &Options{MaxBodyScan: tc.max}, `require "body"; if body :raw :contains "keyword" { keep; }`, "", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Keep != tc.keep {
+				t.Errorf("keep = %v, want %v", d.Keep, tc.keep)
+			}
+		})
+	}
+}
+
+func TestBodyTextCharset(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		key         string
+		keep        bool
+	}{
+		{"iso-8859-1", "text/plain; charset=iso-8859-1", "un caf\xe9 noir\r\n", "café", true},
+		{"shift-jis", "text/plain; charset=Shift_JIS", "\x93\xfa\x96\x7b\x8c\xea\r\n", "日本語", true},
+		{"utf-8", "text/plain; charset=utf-8", "un café noir\r\n", "café", true},
+		{"unknown-charset", "text/plain; charset=x-unknown", "plain ascii\r\n", "ascii", true},
+		{"undecoded-bytes-do-not-match", "text/plain; charset=iso-8859-1", "un caf\xe9 noir\r\n", "caf\xe9", false},
+		{"multipart", "multipart/mixed; boundary=b",
+			"--b\r\nContent-Type: text/plain; charset=iso-8859-1\r\n\r\ncaf\xe9\r\n" +
+				"--b\r\nContent-Type: text/plain; charset=shift_jis\r\n\r\n\x93\xfa\x96\x7b\r\n--b--\r\n",
+			"日本", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := runBodyScript(t, &Options{}, `require "body"; if body :text :contains "`+tc.key+`" { keep; }`, tc.contentType, tc.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Keep != tc.keep {
+				t.Errorf("keep = %v, want %v", d.Keep, tc.keep)
+			}
+		})
+	}
+}
+
+func TestBodySkipsBinaryParts(t *testing.T) {
+	body := "--b\r\nContent-Type: text/plain\r\n\r\nSee the picture.\r\n" +
+		"--b\r\nContent-Type: image/png\r\nContent-Disposition: attachment\r\n\r\n\x89PNG\r\n\x1a\nIDAT viagra \x00\xff\r\n" +
+		"--b--\r\n"
+	for _, tc := range []struct {
+		transform string
+		keep      bool
+	}{
+		{":text", false},
+		{`:content "text"`, false},
+		{`:content ""`, true},
+		{`:content "image"`, true},
+		{":raw", true},
+	} {
+		t.Run(tc.transform, func(t *testing.T) {
+			d, err := runBodyScript(t, &Options{}, `require "body"; if body `+tc.transform+` :contains "viagra" { keep; }`, "multipart/mixed; boundary=b", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Keep != tc.keep {
+				t.Errorf("keep = %v, want %v", d.Keep, tc.keep)
+			}
+		})
+	}
+}
+
+func TestBodyMalformedMultipart(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		key         string
+		keep        bool
+	}{
+		{"truncated", "multipart/mixed; boundary=b",
+			"--b\r\nContent-Type: text/plain\r\n\r\nfirst\r\n--b\r\nContent-Type: text/plain\r\n\r\nlast part, cut o",
+			"cut o", true},
+		{"truncated-in-header", "multipart/mixed; boundary=b",
+			"--b\r\nContent-Type: text/plain\r\n\r\nfirst\r\n--b\r\nContent-Ty",
+			"first", true},
+		// Without a boundary the body is a single part, and not text.
+		{"no-boundary-parameter", "multipart/mixed",
+			"--b\r\nContent-Type: text/plain\r\n\r\nkeyword\r\n--b--\r\n",
+			"keyword", false},
+		{"nested-no-boundary-parameter", "multipart/mixed; boundary=b",
+			"--b\r\nContent-Type: multipart/alternative\r\n\r\nhidden\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nkeyword\r\n--b--\r\n",
+			"keyword", true},
+		{"no-delimiter", "multipart/mixed; boundary=b",
+			"just some text\r\n",
+			"just", false},
+		{"nested-boundary-extends-outer", "multipart/mixed; boundary=b",
+			"--b\r\nContent-Type: multipart/alternative; boundary=bb\r\n\r\n" +
+				"--bb\r\nContent-Type: text/plain\r\n\r\ninner keyword\r\n--bb--\r\n" +
+				"--b--\r\n",
+			"inner keyword", true},
+		{"transport-padding", "multipart/mixed; boundary=b",
+			"--b \t\r\nContent-Type: text/plain\r\n\r\nkeyword\r\n--b--\r\n",
+			"keyword", true},
+		{"delimiter-not-at-line-start", "multipart/mixed; boundary=b",
+			"--b\r\nContent-Type: text/plain\r\n\r\ntext --b\r\nContent-Type: text/html\r\n\r\n--b--\r\n",
+			"text/html", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := runBodyScript(t, &Options{MaxMimeParts: 10}, `require "body"; if body :text :contains "`+tc.key+`" { keep; }`, tc.contentType, tc.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Keep != tc.keep {
+				t.Errorf("keep = %v, want %v", d.Keep, tc.keep)
+			}
+		})
+	}
+
+	t.Run("too-deep", func(t *testing.T) {
+		body := deepMultipart(maxMimeDepth + 1)
+		contentType, rest, _ := strings.Cut(body, "\r\n\r\n")
+		if _, err := runBodyScript(t, &Options{}, `require "body"; if body :text :contains "bottom" { keep; }`, strings.TrimPrefix(contentType, "Content-Type: "), rest); err == nil {
+			t.Error("expected an error for a message nested too deeply")
+		}
+	})
+}
@@ -10,13 +10,13 @@ type CmdIf struct {
 }
 
 func (c CmdIf) Execute(ctx context.Context, d *RuntimeData) error {
-	res, err := c.Test.Check(ctx, d)
+	res, err := checkTest(ctx, d, c.Test)
 	if err != nil {
 		return err
 	}
 	if res {
 		for _, c := range c.Block {
-			if err := c.Execute(ctx, d); err != nil {
+			if err := executeCmd(ctx, d, c); err != nil {
 				return err
 			}
 		}
@@ -34,13 +34,13 @@ func (c CmdElsif) Execute(ctx context.Context, d *RuntimeData) error {
 	if d.ifResult {
 		return nil
 	}
-	res, err := c.Test.Check(ctx, d)
+	res, err := checkTest(ctx, d, c.Test)
 	if err != nil {
 		return err
 	}
 	if res {
 		for _, c := range c.Block {
-			if err := c.Execute(ctx, d); err != nil {
+			if err := executeCmd(ctx, d, c); err != nil {
 				return err
 			}
 		}
@@ -58,7 +58,7 @@ func (c CmdElse) Execute(ctx context.Context, d *RuntimeData) error {
 		return nil
 	}
 	for _, c := range c.Block {
-		if err := c.Execute(ctx, d); err != nil {
+		if err := executeCmd(ctx, d, c); err != nil {
 			return err
 		}
 	}
@@ -45,8 +45,13 @@ var ValidDateParts = map[DatePart]struct{}{
 	DatePartWeekday: {},
 }
 
-// extractDatePart extracts the specified part from a time value
-func extractDatePart(t time.Time, part DatePart) (string, error) {
+// extractDatePart extracts the specified part from a time value. isoWeekday
+// selects ISO 8601 numbering for the weekday part, see Options.ISOWeekday.
+//
+// Parts are formatted as RFC 5260, Section 4.2 specifies, numbers
+// zero-padded to a fixed width: "date" is "yyyy-mm-dd". Keys are compared
+// as strings, so "2020-1-1" does not match the date part of 2020-01-01.
+func extractDatePart(t time.Time, part DatePart, isoWeekday bool) (string, error) {
 	switch part {
 	case DatePartYear:
 		return strconv.Itoa(t.Year()), nil
@@ -71,11 +76,21 @@ func extractDatePart(t time.Time, part DatePart) (string, error) {
 		// ISO 8601 format with timezone offset like +03:00
 		return t.Format("2006-01-02T15:04:05-07:00"), nil
 	case DatePartStd11:
-		// RFC 2822/5322 format (originally from RFC 822)
+		// RFC 5322 form, reconstructed from the parsed time rather than
+		// copied from the header: the weekday is always present, the day
+		// has two digits and the zone is numeric, so "GMT" and "UT" both
+		// become "+0000".
 		return t.Format(time.RFC1123Z), nil
 	case DatePartZone:
 		return t.Format("-0700"), nil
 	case DatePartWeekday:
+		if isoWeekday {
+			// 1 = Monday, 7 = Sunday
+			if t.Weekday() == time.Sunday {
+				return "7", nil
+			}
+			return strconv.Itoa(int(t.Weekday())), nil
+		}
 		// 0 = Sunday, 6 = Saturday
 		return strconv.Itoa(int(t.Weekday())), nil
 	default:
@@ -130,6 +145,20 @@ func parseZoneOffset(zone string) (int, error) {
 	return sign * (hours*3600 + minutes*60), nil
 }
 
+// obsZones are the obsolete named zones of RFC 5322, Section 4.3.
+var obsZones = map[string]string{
+	"UT":  "+0000",
+	"GMT": "+0000",
+	"EST": "-0500",
+	"EDT": "-0400",
+	"CST": "-0600",
+	"CDT": "-0500",
+	"MST": "-0700",
+	"MDT": "-0600",
+	"PST": "-0800",
+	"PDT": "-0700",
+}
+
 // parseDateHeader parses a date from a header value
 // It supports various common date formats
 func parseDateHeader(value string) (time.Time, error) {
@@ -138,6 +167,13 @@ func parseDateHeader(value string) (time.Time, error) {
 		return time.Time{}, fmt.Errorf("empty date value")
 	}
 
+	// Named zones would otherwise parse with a zero offset.
+	if i := strings.LastIndexAny(value, " \t"); i >= 0 {
+		if offset, ok := obsZones[strings.ToUpper(value[i+1:])]; ok {
+			value = value[:i+1] + offset
+		}
+	}
+
 	// Try RFC 2822 format first (most common for email)
 	t, err := mail.ParseDate(value)
 	if err == nil {
@@ -181,18 +217,23 @@ type DateTest struct {
 	DatePart     DatePart // Part of date to compare
 	Zone         string   // Time zone offset (e.g., "+0500")
 	OriginalZone bool     // Use original zone from header
-	Index        int      // Index for multiple headers (from "index" extension)
-	Last         bool     // Use last header instead of first (from "index" extension)
+
+	fieldIndex // :index and :last (from "index" extension)
 }
 
 func (d DateTest) Check(ctx context.Context, rd *RuntimeData) (bool, error) {
 	header := expandVars(rd, d.Header)
+	if !isValidHeaderName(header) {
+		return false, nil
+	}
 
 	values, err := rd.Msg.HeaderGet(header)
 	if err != nil {
 		return false, err
 	}
 
+	values = d.selectField(values)
+
 	// Handle :count match type
 	if d.isCount() {
 		// Count valid dates in the header values
@@ -205,25 +246,11 @@ func (d DateTest) Check(ctx context.Context, rd *RuntimeData) (bool, error) {
 		return d.countMatches(rd, validCount), nil
 	}
 
+	// Without :index the first occurrence is used.
 	if len(values) == 0 {
 		return false, nil
 	}
-
-	// Select the appropriate header value based on index
-	var value string
-	if d.Index > 0 {
-		idx := d.Index - 1 // Convert to 0-based
-		if d.Last {
-			// Index from the end
-			idx = len(values) - d.Index
-		}
-		if idx < 0 || idx >= len(values) {
-			return false, nil
-		}
-		value = values[idx]
-	} else {
-		value = values[0]
-	}
+	value := values[0]
 
 	// Parse the date from the header
 	t, err := parseDateHeader(value)
@@ -231,12 +258,14 @@ func (d DateTest) Check(ctx context.Context, rd *RuntimeData) (bool, error) {
 		return false, nil // Invalid date doesn't match
 	}
 
-	// Apply zone transformation
-	t = d.applyZone(t)
+	// Apply zone transformation, :originalzone keeps the zone of the header
+	if !d.OriginalZone {
+		t = applyZone(rd.Script, t, d.Zone)
+	}
 
 	// Extract the date part
 	datePart := DatePart(strings.ToLower(expandVars(rd, string(d.DatePart))))
-	partValue, err := extractDatePart(t, datePart)
+	partValue, err := extractDatePart(t, datePart, rd.Script.opts.ISOWeekday)
 	if err != nil {
 		return false, err
 	}
@@ -245,25 +274,31 @@ func (d DateTest) Check(ctx context.Context, rd *RuntimeData) (bool, error) {
 	return d.matcherTest.tryMatch(ctx, rd, partValue)
 }
 
-func (d DateTest) applyZone(t time.Time) time.Time {
-	if d.OriginalZone {
-		// Keep the original zone
-		return t
-	}
-
-	if d.Zone != "" {
-		// Apply specified zone
-		offset, err := parseZoneOffset(d.Zone)
+// applyZone converts t to zone, a "+hhmm" offset, or to the default zone if
+// zone is empty or invalid. date and currentdate share it so that their
+// date-parts can be compared with each other.
+func applyZone(s *Script, t time.Time, zone string) time.Time {
+	if zone != "" {
+		offset, err := parseZoneOffset(zone)
 		if err == nil {
-			loc := time.FixedZone("", offset)
-			return t.In(loc)
+			return t.In(time.FixedZone("", offset))
 		}
 	}
-
-	// Default: use local time zone
+	// Default: use the configured zone, time.Local unless set
+	if s.opts.Location != nil {
+		return t.In(s.opts.Location)
+	}
 	return t.Local()
 }
 
+// now returns the current time for currentdate.
+func (s *Script) now() time.Time {
+	if s.opts.Clock != nil {
+		return s.opts.Clock()
+	}
+	return time.Now()
+}
+
 // CurrentDateTest implements the "currentdate" test from RFC 5260
 // It compares a date-part of the current date/time against key strings
 type CurrentDateTest struct {
@@ -274,22 +309,12 @@ type CurrentDateTest struct {
 }
 
 func (c CurrentDateTest) Check(ctx context.Context, rd *RuntimeData) (bool, error) {
-	// Get current time
-	t := time.Now()
-
-	// Apply zone transformation
-	if c.Zone != "" {
-		offset, err := parseZoneOffset(c.Zone)
-		if err == nil {
-			loc := time.FixedZone("", offset)
-			t = t.In(loc)
-		}
-	}
-	// If no zone specified, use local time (which is what time.Now() returns)
+	// Get current time and apply zone transformation
+	t := applyZone(rd.Script, rd.Script.now(), c.Zone)
 
 	// Extract the date part
 	datePart := DatePart(strings.ToLower(expandVars(rd, string(c.DatePart))))
-	partValue, err := extractDatePart(t, datePart)
+	partValue, err := extractDatePart(t, datePart, rd.Script.opts.ISOWeekday)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,20 @@
+package interp
+
+import (
+	"context"
+)
+
+const DovecotDebugExtension = "vnd.dovecot.debug"
+
+// CmdDebugLog implements the debug_log command of the vnd.dovecot.debug
+// extension. The message is passed to Options.DebugLog.
+type CmdDebugLog struct {
+	Message string
+}
+
+func (c CmdDebugLog) Execute(_ context.Context, d *RuntimeData) error {
+	if d.Script.opts.DebugLog != nil {
+		d.Script.opts.DebugLog(expandVars(d, c.Message))
+	}
+	return nil
+}
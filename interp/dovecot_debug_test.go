@@ -0,0 +1,36 @@
+package interp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDebugLog(t *testing.T) {
+	var logged []string
+	opts := &Options{
+		MaxVariableNameLen: 32,
+		MaxVariableLen:     4000,
+		DebugLog: func(msg string) {
+			logged = append(logged, msg)
+		},
+	}
+	s := loadTestScript(t, opts, `require ["vnd.dovecot.debug", "variables"];
+set "who" "world";
+debug_log "hello ${who}";
+`)
+	d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{})
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"hello world"}; !reflect.DeepEqual(logged, want) {
+		t.Errorf("debug_log emitted %q, want %q", logged, want)
+	}
+
+	// Without a logger debug_log is a no-op.
+	opts.DebugLog = nil
+	d = NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{})
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+}
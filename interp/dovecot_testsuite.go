@@ -1,14 +1,11 @@
 package interp
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
-	"net/textproto"
 	"strconv"
 	"strings"
 	"testing"
@@ -34,11 +31,13 @@ func parseEnvelopeAddress(addr string) (string, error) {
 
 	// Must be in angle brackets for valid envelope address
 	if !strings.HasPrefix(addr, "<") || !strings.HasSuffix(addr, ">") {
-		// Some addresses might not have brackets - validate basic syntax
-		if !strings.Contains(addr, "@") && addr != "MAILER-DAEMON" {
+		// Some addresses might not have brackets - validate basic syntax.
+		// A bare MAILER-DAEMON, as some MTAs give for bounces, is kept: it
+		// matches as a whole but has no local-part or domain.
+		if !strings.Contains(addr, "@") && !strings.EqualFold(addr, "MAILER-DAEMON") {
 			return "", fmt.Errorf("invalid envelope address syntax: %s", addr)
 		}
-		if strings.HasSuffix(addr, "@") && addr != "MAILER-DAEMON@" {
+		if strings.HasSuffix(addr, "@") && !strings.EqualFold(addr, "MAILER-DAEMON@") {
 			return "", fmt.Errorf("invalid envelope address syntax: missing domain")
 		}
 		if strings.HasPrefix(addr, "@") {
@@ -95,7 +94,7 @@ func parseEnvelopeAddress(addr string) (string, error) {
 	}
 
 	// Regular address validation
-	if inner == "MAILER-DAEMON" {
+	if strings.EqualFold(inner, "MAILER-DAEMON") {
 		return inner, nil
 	}
 
@@ -124,6 +123,28 @@ func (c CmdDovecotTest) Execute(ctx context.Context, d *RuntimeData) error {
 	d.testName = c.TestName
 	d.testFailMessage = ""
 
+	// Actions executed inside a test block (keep, discard, fileinto, ...)
+	// must not change the delivery decision of the enclosing script, so the
+	// block runs on a copy. The testsuite environment (message, envelope,
+	// variables, header edits and flags) is carried back so that later tests
+	// observe it, like they would with Pigeonhole.
+	testData := d.Copy()
+	defer func() {
+		d.Msg = testData.Msg
+		d.Envelope = testData.Envelope
+		d.Variables = testData.Variables
+		d.MatchVariables = testData.MatchVariables
+		d.HeaderEdits = testData.HeaderEdits
+		d.Flags = testData.Flags
+		d.testFailMessage = testData.testFailMessage
+		d.testFailAt = testData.testFailAt
+		d.testScript = testData.testScript
+		d.testResult = testData.testResult
+		d.testImplicitKeep = testData.testImplicitKeep
+		d.testMailboxes = testData.testMailboxes
+		d.testSMTP = testData.testSMTP
+	}()
+
 	d.Script.opts.T.Run(c.TestName, func(t *testing.T) {
 		for _, testName := range d.Script.opts.DisabledTests {
 			if c.TestName == testName {
@@ -132,10 +153,10 @@ func (c CmdDovecotTest) Execute(ctx context.Context, d *RuntimeData) error {
 		}
 
 		for _, cmd := range c.Cmds {
-			if err := cmd.Execute(ctx, d); err != nil {
+			if err := executeCmd(ctx, testData, cmd); err != nil {
 				if errors.Is(err, ErrStop) {
-					if d.testFailMessage != "" {
-						t.Errorf("test_fail at %v called: %v", d.testFailAt, d.testFailMessage)
+					if testData.testFailMessage != "" {
+						t.Errorf("test_fail at %v called: %v", testData.testFailAt, testData.testFailMessage)
 					}
 					return
 				}
@@ -192,58 +213,100 @@ func (c CmdDovecotTestSet) Execute(_ context.Context, d *RuntimeData) error {
 
 	switch c.VariableName {
 	case "message":
-		r := textproto.NewReader(bufio.NewReader(strings.NewReader(c.VariableValue)))
-		msgHdr, hdrErr := r.ReadMIMEHeader()
-		if hdrErr != nil && hdrErr != io.EOF {
-			return fmt.Errorf("failed to parse test message: %v", hdrErr)
+		msg, err := ReadMessage(strings.NewReader(c.VariableValue), d.Script.opts.HeaderLimits)
+		if err != nil {
+			return fmt.Errorf("failed to parse test message: %v", err)
 		}
-
-		bodyBytes, err := io.ReadAll(r.R)
+		d.Msg = msg
+	case "envelope":
+		env, err := parseCompositeEnvelope(value)
 		if err != nil {
-			return fmt.Errorf("failed to read test message body: %v", err)
+			return err
 		}
+		d.Envelope = env
+	case "envelope.from", "envelope.to", "envelope.auth", "envelope.orcpt", "envelope.notify":
+		env := staticEnvelope(d.Envelope)
+		setEnvelopePart(&env, strings.TrimPrefix(c.VariableName, "envelope."), value)
+		d.Envelope = env
+	default:
+		d.Variables[c.VariableName] = c.VariableValue
+	}
+
+	return nil
+}
 
-		d.Msg = MessageStatic{
-			Size:    len(c.VariableValue),
-			Header:  msgHdr,
-			Body:    bodyBytes,
-			HasBody: hdrErr != io.EOF,
+// parseCompositeEnvelope parses the value of test_set "envelope": one
+// "part: value" line per envelope part, e.g.
+//
+//	from: <sender@example.com>
+//	to: <recipient@example.com>
+//	orcpt: rfc822;original@example.com
+//
+// Parts that are not listed are left empty.
+func parseCompositeEnvelope(value string) (EnvelopeStatic, error) {
+	var env EnvelopeStatic
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
 		}
-	case "envelope.from":
-		parsedAddr, err := parseEnvelopeAddress(value)
-		if err != nil {
-			// For invalid addresses, store the original value so envelope tests can detect invalidity
-			parsedAddr = value
+		part, partValue, ok := strings.Cut(line, ":")
+		if !ok {
+			return env, fmt.Errorf("test_set envelope: malformed line %q", line)
 		}
-
-		d.Envelope = EnvelopeStatic{
-			From: parsedAddr,
-			To:   d.Envelope.EnvelopeTo(),
-			Auth: d.Envelope.AuthUsername(),
+		part = strings.ToLower(strings.TrimSpace(part))
+		if !setEnvelopePart(&env, part, strings.TrimSpace(partValue)) {
+			return env, fmt.Errorf("test_set envelope: unknown part %q", part)
 		}
-	case "envelope.to":
-		parsedAddr, err := parseEnvelopeAddress(value)
+	}
+	return env, nil
+}
+
+// setEnvelopePart sets a single part of env, as named after "envelope." in
+// test_set. It reports whether part is known.
+func setEnvelopePart(env *EnvelopeStatic, part, value string) bool {
+	switch part {
+	case "from", "to":
+		addr, err := parseEnvelopeAddress(value)
 		if err != nil {
 			// For invalid addresses, store the original value so envelope tests can detect invalidity
-			parsedAddr = value
+			addr = value
 		}
-
-		d.Envelope = EnvelopeStatic{
-			From: d.Envelope.EnvelopeFrom(),
-			To:   parsedAddr,
-			Auth: d.Envelope.AuthUsername(),
+		if part == "from" {
+			env.From = addr
+		} else {
+			env.To = addr
 		}
-	case "envelope.auth":
-		d.Envelope = EnvelopeStatic{
-			From: d.Envelope.EnvelopeFrom(),
-			To:   d.Envelope.EnvelopeTo(),
-			Auth: value,
+	case "auth":
+		env.Auth = value
+	case "orcpt":
+		// Accept the ORCPT parameter as given to RCPT TO, with its
+		// address type (RFC 3461, Section 4.2).
+		if addrType, addr, ok := strings.Cut(value, ";"); ok && strings.EqualFold(addrType, "rfc822") {
+			value = addr
 		}
+		env.ORcpt = value
+	case "notify":
+		env.Notify = value
 	default:
-		d.Variables[c.VariableName] = c.VariableValue
+		return false
 	}
+	return true
+}
 
-	return nil
+// staticEnvelope copies env, including its DSN parameters, so a single
+// part can be replaced.
+func staticEnvelope(env Envelope) EnvelopeStatic {
+	s := EnvelopeStatic{
+		From: env.EnvelopeFrom(),
+		To:   env.EnvelopeTo(),
+		Auth: env.AuthUsername(),
+	}
+	if dsn, ok := env.(EnvelopeDSN); ok {
+		s.ORcpt, _ = dsn.OriginalRecipient()
+		s.Notify, _ = dsn.DSNNotify()
+	}
+	return s
 }
 
 type TestDovecotCompile struct {
@@ -276,9 +339,9 @@ func (t TestDovecotCompile) Check(_ context.Context, d *RuntimeData) (bool, erro
 		return false, nil
 	}
 
-	script, err := LoadScript(cmds, &Options{
-		MaxRedirects: d.Script.opts.MaxRedirects,
-	}, nil)
+	// The compiled script runs with the same options as the test script.
+	opts := *d.Script.opts
+	script, err := LoadScript(cmds, &opts, d.Script.enabledExtensions)
 	if err != nil {
 		return false, nil
 	}
@@ -287,6 +350,28 @@ func (t TestDovecotCompile) Check(_ context.Context, d *RuntimeData) (bool, erro
 	return true, nil
 }
 
+// testMessage is a message as an action of test_script_run left it: the
+// message with the header edits made before the action, and its envelope.
+type testMessage struct {
+	msg      Message
+	edits    []HeaderEdit
+	envelope Envelope
+}
+
+// testAction is an action recorded by test_script_run.
+type testAction struct {
+	Action
+	message testMessage
+}
+
+func newTestMessage(d *RuntimeData) testMessage {
+	return testMessage{
+		msg:      d.Msg,
+		edits:    append([]HeaderEdit(nil), d.HeaderEdits...),
+		envelope: d.Envelope,
+	}
+}
+
 type TestDovecotRun struct {
 }
 
@@ -297,17 +382,136 @@ func (t TestDovecotRun) Check(ctx context.Context, d *RuntimeData) (bool, error)
 
 	testD := d.Copy()
 	testD.Script = d.testScript
+	testD.Keep = false
+	testD.ImplicitKeep = !d.testScript.opts.DisableImplicitKeep
 	// Note: Loaded script has no test environment available -
 	// it is a regular Sieve script.
+	testD.OnAction = func(a Action) {
+		d.testResult = append(d.testResult, testAction{Action: a, message: newTestMessage(testD)})
+	}
 
 	err := d.testScript.Execute(ctx, testD)
 	if err != nil {
 		return false, nil
 	}
 
+	d.testImplicitKeep = nil
+	if testD.ImplicitKeep && !testD.Keep {
+		m := newTestMessage(testD)
+		d.testImplicitKeep = &m
+	}
+	return true, nil
+}
+
+// CmdDovecotResultReset implements test_result_reset: it forgets the
+// actions recorded by test_script_run.
+type CmdDovecotResultReset struct{}
+
+func (c CmdDovecotResultReset) Execute(_ context.Context, d *RuntimeData) error {
+	d.testResult = nil
+	d.testImplicitKeep = nil
+	return nil
+}
+
+// TestDovecotResultExecute implements test_result_execute: it stores the
+// messages kept and filed by test_script_run into their mailboxes, keep and
+// the implicit keep into "INBOX", and sends those redirected, for
+// test_message to retrieve. It fails if no script has been run.
+type TestDovecotResultExecute struct{}
+
+func (t TestDovecotResultExecute) Check(_ context.Context, d *RuntimeData) (bool, error) {
+	if d.testScript == nil {
+		return false, nil
+	}
+	for _, a := range d.testResult {
+		switch a.Kind {
+		case ActionKeep:
+			d.storeTestMessage("INBOX", a.message)
+		case ActionFileInto:
+			d.storeTestMessage(a.Target, a.message)
+		case ActionRedirect:
+			m := a.message
+			m.envelope = EnvelopeStatic{From: m.envelope.EnvelopeFrom(), To: a.Target}
+			d.testSMTP = append(d.testSMTP, m)
+		}
+	}
+	if d.testImplicitKeep != nil {
+		d.storeTestMessage("INBOX", *d.testImplicitKeep)
+	}
 	return true, nil
 }
 
+func (d *RuntimeData) storeTestMessage(mailbox string, m testMessage) {
+	if d.testMailboxes == nil {
+		d.testMailboxes = make(map[string][]testMessage)
+	}
+	d.testMailboxes[mailbox] = append(d.testMailboxes[mailbox], m)
+}
+
+// CmdDovecotTestMessage implements test_message: it makes the message
+// test_result_execute sent at Index, or with :folder stored into Folder at
+// Index, the message of the test script. A sent message brings its
+// envelope along.
+type CmdDovecotTestMessage struct {
+	SMTP   bool
+	Folder string
+	Index  int64
+}
+
+func (c CmdDovecotTestMessage) Execute(_ context.Context, d *RuntimeData) error {
+	msgs := d.testSMTP
+	source := "sent"
+	if !c.SMTP {
+		folder := expandVars(d, c.Folder)
+		msgs = d.testMailboxes[folder]
+		source = fmt.Sprintf("stored into %q", folder)
+	}
+	if c.Index < 0 || c.Index >= int64(len(msgs)) {
+		return fmt.Errorf("test_message: no message %d %s", c.Index, source)
+	}
+	m := msgs[c.Index]
+	d.Msg = m.msg
+	d.HeaderEdits = append([]HeaderEdit(nil), m.edits...)
+	if c.SMTP {
+		d.Envelope = m.envelope
+	}
+	return nil
+}
+
+// TestDovecotResultAction implements test_result_action: it matches the
+// names of the actions recorded by test_script_run, or with :index only the
+// name of the n-th action, against the keys. Names follow Pigeonhole:
+// fileinto is reported as "store".
+type TestDovecotResultAction struct {
+	matcherTest
+	fieldIndex
+}
+
+func (t TestDovecotResultAction) Check(ctx context.Context, d *RuntimeData) (bool, error) {
+	names := make([]string, 0, len(d.testResult))
+	for _, a := range d.testResult {
+		name := string(a.Kind)
+		if a.Kind == ActionFileInto {
+			name = "store"
+		}
+		names = append(names, name)
+	}
+	names = t.selectField(names)
+	if t.isCount() {
+		return t.countMatches(d, uint64(len(names))), nil
+	}
+	for _, name := range names {
+		ok, err := t.tryMatch(ctx, d, name)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 type TestDovecotTestError struct {
 	matcherTest
 }
@@ -0,0 +1,147 @@
+package interp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDovecotTestBlockSandbox(t *testing.T) {
+	s := loadTestScript(t, &Options{T: t, MaxVariableNameLen: 32, MaxVariableLen: 4000}, `require ["vnd.dovecot.testsuite", "fileinto", "variables"];
+test "discard" {
+	discard;
+	fileinto "Junk";
+	set "seen" "yes";
+}
+test "state" {
+	if not string "${seen}" "yes" {
+		test_fail "variables do not carry over between tests";
+	}
+}
+`)
+	d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{})
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if !d.ImplicitKeep {
+		t.Error("discard inside a test block cancelled the implicit keep of the enclosing script")
+	}
+	if len(d.Mailboxes) != 0 {
+		t.Errorf("fileinto inside a test block leaked into the enclosing script: %v", d.Mailboxes)
+	}
+}
+
+// TestDovecotCompileRequireScope checks that a script compiled by
+// test_script_compile has its own require scope, limited to the extensions
+// enabled for the enclosing script.
+func TestDovecotCompileRequireScope(t *testing.T) {
+	namespace := fstest.MapFS{
+		"child.sieve": {Data: []byte(`require "vacation"; vacation "Away.";`)},
+	}
+	load := func(t *testing.T, enabled []string, in string) *Script {
+		t.Helper()
+		s, err := loadTestScriptErr(t, &Options{T: t, Namespace: namespace}, enabled, in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	run := func(t *testing.T, s *Script) {
+		t.Helper()
+		d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{})
+		if err := s.Execute(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		if s.RequiresExtension("vacation") {
+			t.Error("the require of the compiled script leaked into the enclosing one")
+		}
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		run(t, load(t, []string{"vacation"}, `require "vnd.dovecot.testsuite";
+test "child" {
+	if not test_script_compile "child.sieve" {
+		test_fail "child requiring an enabled extension did not compile";
+	}
+}
+`))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		run(t, load(t, []string{"fileinto"}, `require "vnd.dovecot.testsuite";
+test "child" {
+	if test_script_compile "child.sieve" {
+		test_fail "child requiring a disabled extension compiled";
+	}
+}
+`))
+	})
+	t.Run("error", func(t *testing.T) {
+		_, err := loadTestScriptErr(t, &Options{}, []string{"fileinto"}, `require "vacation";`)
+		if err == nil || !strings.Contains(err.Error(), "'vacation' is not enabled") {
+			t.Errorf("error = %v, want one saying vacation is not enabled", err)
+		}
+	})
+}
+
+// TestDovecotCompileOptions checks that a script compiled by
+// test_script_compile is loaded with the options of the enclosing script.
+func TestDovecotCompileOptions(t *testing.T) {
+	namespace := fstest.MapFS{
+		"child.sieve": {Data: []byte(`require "variables"; set "name" "value";`)},
+	}
+	s := loadTestScript(t, &Options{T: t, Namespace: namespace, MaxVariableNameLen: 32}, `require "vnd.dovecot.testsuite";
+test "child" {
+	if not test_script_compile "child.sieve" {
+		test_fail "child setting a variable did not compile";
+	}
+}
+`)
+	d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{})
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDovecotResultActionIndex(t *testing.T) {
+	for _, tc := range []struct {
+		test string
+		ok   bool
+	}{
+		{`test_result_action :index 1 "keep"`, true},
+		{`test_result_action :index 2 :last "keep"`, true},
+		{`test_result_action :index 0 "keep"`, false},
+		{`test_result_action :last "keep"`, false},
+		{`test_result_action :index 1 :index 2 "keep"`, false},
+	} {
+		_, err := loadTestScriptErr(t, &Options{T: t}, []string{DovecotTestExtension}, `require "vnd.dovecot.testsuite"; if `+tc.test+` { }`)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: error = %v, want ok = %v", tc.test, err, tc.ok)
+		}
+	}
+}
+
+func TestDovecotTestMessage(t *testing.T) {
+	for _, tc := range []struct {
+		cmd string
+		ok  bool
+	}{
+		{`test_message :smtp 0;`, true},
+		{`test_message :folder "INBOX" 1;`, true},
+		{`test_message 0;`, false},
+		{`test_message :smtp :folder "INBOX" 0;`, false},
+		{`test_message :folder "INBOX";`, false},
+	} {
+		_, err := loadTestScriptErr(t, &Options{T: t}, []string{DovecotTestExtension}, `require "vnd.dovecot.testsuite"; `+tc.cmd)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: error = %v, want ok = %v", tc.cmd, err, tc.ok)
+		}
+	}
+
+	d := testRuntimeData(loadTestScript(t, &Options{}, ``), nil, nil)
+	for _, c := range []CmdDovecotTestMessage{{SMTP: true}, {Folder: "INBOX"}} {
+		if err := c.Execute(context.Background(), d); err == nil {
+			t.Errorf("%+v: expected an error without a stored or sent message", c)
+		}
+	}
+}
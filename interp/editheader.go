@@ -2,11 +2,14 @@ package interp
 
 import (
 	"context"
+	"fmt"
 	"regexp"
 	"strings"
 )
 
-// HeaderEdit represents a header modification (add or delete)
+// HeaderEdit represents a header modification (add or delete). Edits are
+// applied in order, and Index counts the occurrences left by the edits
+// before it, as deleteheader saw them when it ran.
 type HeaderEdit struct {
 	Action    string // "add" or "delete"
 	FieldName string
@@ -63,6 +66,13 @@ func (c CmdAddHeader) Execute(_ context.Context, d *RuntimeData) error {
 		return nil
 	}
 
+	// A line break in the value, e.g. from a variable holding
+	// "\r\nBcc: ...", would inject a header field when the message is
+	// written out.
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return fmt.Errorf("addheader: value of %s contains a line break or NUL", fieldName)
+	}
+
 	// Check if protected header that cannot be added (optional, not required by RFC)
 	// RFC only requires Subject to be allowed
 
@@ -76,13 +86,15 @@ func (c CmdAddHeader) Execute(_ context.Context, d *RuntimeData) error {
 	return nil
 }
 
-// CmdDeleteHeader represents the deleteheader action
+// CmdDeleteHeader represents the deleteheader action. Value patterns are
+// matched against the field body as it appears in the message, unfolded
+// but with encoded-words left as they are (RFC 5293, Section 5), whatever
+// Options.Text.KeepEncodedWords says for the header test.
 type CmdDeleteHeader struct {
 	matcherTest
+	fieldIndex
 	FieldName     string
 	ValuePatterns []string
-	Index         int
-	Last          bool
 }
 
 func (c CmdDeleteHeader) Execute(ctx context.Context, d *RuntimeData) error {
@@ -173,7 +185,7 @@ func (c CmdDeleteHeader) Execute(ctx context.Context, d *RuntimeData) error {
 
 func (c CmdDeleteHeader) valueMatchesPatterns(ctx context.Context, d *RuntimeData, value string, patterns []string) (bool, error) {
 	// Trim leading/trailing whitespace as per RFC 5293
-	value = strings.TrimSpace(decodeHeaderValue(value))
+	value = strings.TrimSpace(unfoldHeaderValue(value))
 
 	for _, pattern := range patterns {
 		ok, err := c.matcherTest.tryMatch(ctx, d, value)
@@ -250,8 +262,14 @@ func applyHeaderEditsToValues(d *RuntimeData, fieldName string, values []string)
 	return result
 }
 
-// GetHeaderWithEdits retrieves header values with edits applied
+// GetHeaderWithEdits retrieves header values with edits applied. A name
+// that is not a valid field name, e.g. one built from an empty variable,
+// cannot be present in the message: it has no values and the message is not
+// asked for it.
 func GetHeaderWithEdits(d *RuntimeData, fieldName string) ([]string, error) {
+	if !isValidHeaderName(fieldName) {
+		return nil, nil
+	}
 	values, err := d.Msg.HeaderGet(fieldName)
 	if err != nil {
 		return nil, err
@@ -273,7 +291,7 @@ func (m EditableMessage) HeaderGet(key string) ([]string, error) {
 	return applyHeaderEditsToValues(m.Data, key, values), nil
 }
 
-func (m EditableMessage) MessageSize() int {
+func (m EditableMessage) MessageSize() int64 {
 	return m.Original.MessageSize()
 }
 
@@ -23,20 +23,20 @@ var headerWordDecoder = mime.WordDecoder{
 	},
 }
 
-// decodeHeaderValue unfolds a header value and decodes RFC 2047
-// encoded-words into UTF-8 so that comparisons operate on the decoded text
-// (RFC 5228, Section 2.7.2). Values that fail to decode are returned
-// unfolded but otherwise unchanged.
-func decodeHeaderValue(raw string) string {
+// unfoldHeaderValue removes the line breaks of a folded header value.
+func unfoldHeaderValue(raw string) string {
 	if strings.ContainsAny(raw, "\r\n") {
 		raw = strings.NewReplacer("\r", "", "\n", "").Replace(raw)
 	}
-	if !strings.Contains(raw, "=?") {
-		return raw
-	}
-	decoded, err := headerWordDecoder.DecodeHeader(raw)
-	if err != nil {
-		return raw
+	return raw
+}
+
+// headerCompareValue returns a header value as the header test compares
+// it: unfolded and, unless Options.Text sets KeepEncodedWords, with
+// encoded-words decoded.
+func (s *Script) headerCompareValue(raw string) string {
+	if s.opts.Text.KeepEncodedWords {
+		return unfoldHeaderValue(raw)
 	}
-	return decoded
+	return s.opts.Text.decodeHeaderValue(raw)
 }
@@ -0,0 +1,78 @@
+package interp
+
+import (
+	"fmt"
+)
+
+// fieldIndex holds the ":index" <fieldno> [":last"] arguments shared by the
+// header, address and date tests (RFC 5260, Section 6) and the deleteheader
+// command (RFC 5293, Section 5).
+type fieldIndex struct {
+	Index int  // 1-based field occurrence to use, 0 means all occurrences
+	Last  bool // count Index from the last occurrence
+
+	indexSet bool
+	invalid  bool
+}
+
+func (f *fieldIndex) addSpecTags(s *Spec) *Spec {
+	if s.Tags == nil {
+		s.Tags = make(map[string]SpecTag, 2)
+	}
+	s.Tags["index"] = SpecTag{
+		NeedsValue: true,
+		MatchNum: func(val int64) {
+			f.indexSet = true
+			if val < 1 || val > maxFieldIndex {
+				f.invalid = true
+				return
+			}
+			f.Index = int(val)
+		},
+	}
+	s.Tags["last"] = SpecTag{
+		MatchBool: func() {
+			f.Last = true
+		},
+	}
+	return s
+}
+
+// maxFieldIndex bounds :index; no message has this many occurrences of a
+// field.
+const maxFieldIndex = 1 << 30
+
+// check validates the arguments once the spec is loaded. requireIndex is
+// false for deleteheader, whose :index is part of editheader itself.
+func (f *fieldIndex) check(s *Script, requireIndex bool) error {
+	if f.Last && !f.indexSet {
+		return fmt.Errorf(":last can only be specified with :index")
+	}
+	if !f.indexSet {
+		return nil
+	}
+	if requireIndex && !s.RequiresExtension("index") {
+		return ExtensionRequiredError{Extension: "index"}
+	}
+	if f.invalid {
+		return fmt.Errorf(":index must be a positive number")
+	}
+	return nil
+}
+
+// selectField returns the occurrence of a field selected by :index from
+// values, all values if no index is set, or nil if the index is out of
+// range.
+func (f fieldIndex) selectField(values []string) []string {
+	if f.Index == 0 {
+		return values
+	}
+	idx := f.Index - 1
+	if f.Last {
+		idx = len(values) - f.Index
+	}
+	if idx < 0 || idx >= len(values) {
+		return nil
+	}
+	return values[idx : idx+1]
+}
@@ -2,6 +2,7 @@ package interp
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/migadu/go-sieve/lexer"
@@ -30,6 +31,11 @@ var supportedRequires = map[string]struct{}{
 	"mailbox":    {}, // RFC5490 - Mailbox Extension
 	"subaddress": {}, // RFC5233 - Subaddress Extension
 	"body":       {}, // RFC5173 - Body Extension
+	"mime":       {}, // RFC5703 - :mime for the header test
+
+	"envelope-dsn": {}, // RFC6009 - orcpt and notify envelope-parts
+
+	DovecotDebugExtension: {}, // vnd.dovecot.debug - debug_log command
 }
 
 var (
@@ -62,21 +68,21 @@ func init() {
 		// RFC 5293 (editheader extension)
 		"addheader":    loadAddHeader,
 		"deleteheader": loadDeleteHeader,
+		// vnd.dovecot.debug
+		"debug_log": loadDebugLog,
 		// vnd.dovecot.testsuite
 		"test":             loadDovecotTest,
 		"test_set":         loadDovecotTestSet,
 		"test_fail":        loadDovecotTestFail,
 		"test_binary_load": loadNoop, // go-sieve has no intermediate binary representation
 		"test_binary_save": loadNoop, // go-sieve has no intermediate binary representation
-		// "test_result_execute" // apply script results (validated using test_message)
 		// "test_mailbox_create"
 		// "test_imap_metadata_set"
 		"test_config_reload": loadNoop, // go-sieve applies changes immediately
 		"test_config_set":    loadDovecotConfigSet,
 		"test_config_unset":  loadDovecotConfigUnset,
-		// "test_result_reset"
-		// "test_message"
-
+		"test_result_reset":  loadDovecotResultReset,
+		"test_message":       loadDovecotTestMessage,
 	}
 	tests = map[string]func(*Script, parser.Test) (Test, error){
 		// RFC 5228
@@ -100,31 +106,84 @@ func init() {
 		// RFC 5173 (body extension)
 		"body": loadBodyTest,
 		// vnd.dovecot.testsuite
-		"test_script_compile": loadDovecotCompile, // compile script (to test for compile errors)
-		"test_script_run":     loadDovecotRun,     // run script (to test for run-time errors)
-		"test_error":          loadDovecotError,   // check detailed results of test_script_compile or test_script_run
-		// "test_message" // check results of test_result_execute - where messages are
-		// "test_result_action" // check results of test_result_execute - what actions are executed
-		// "test_result_reset" // clean results as observed by test_result_action
+		"test_script_compile": loadDovecotCompile,       // compile script (to test for compile errors)
+		"test_script_run":     loadDovecotRun,           // run script (to test for run-time errors)
+		"test_error":          loadDovecotError,         // check detailed results of test_script_compile or test_script_run
+		"test_result_execute": loadDovecotResultExecute, // apply script results
+		"test_result_action":  loadDovecotResultAction,  // check what actions test_script_run performed
 	}
 }
 
 func LoadScript(cmdStream []parser.Cmd, opts *Options, enabledExtensions []string) (*Script, error) {
+	// The interpreter reads s.opts without checking for nil.
+	if opts == nil {
+		opts = &Options{}
+	}
 	s := &Script{
 		extensions:        map[string]struct{}{},
 		enabledExtensions: enabledExtensions,
 		opts:              opts,
 	}
 
+	if !opts.Text.Normalization.valid() {
+		return nil, fmt.Errorf("unknown Unicode normalization form %q", opts.Text.Normalization)
+	}
+	if opts.DefaultComparator != "" && !validComparator(opts.DefaultComparator) {
+		return nil, fmt.Errorf("unsupported default comparator: %v", opts.DefaultComparator)
+	}
+
+	if err := checkRequirePlacement(cmdStream); err != nil {
+		return nil, err
+	}
+
 	loadedCmds, err := LoadBlock(s, cmdStream)
 	if err != nil {
 		return nil, err
 	}
 	s.cmd = loadedCmds
+	s.warnings = collectWarnings(cmdStream)
+
+	if opts.MaxComplexityScore > 0 {
+		if score := s.ComplexityScore(); score > opts.MaxComplexityScore {
+			return nil, fmt.Errorf("%w (score %d, limit %d)", ErrComplexityLimit, score, opts.MaxComplexityScore)
+		}
+	}
 
 	return s, nil
 }
 
+// checkRequirePlacement enforces RFC 5228, Section 3.2: require commands
+// must appear at the top level, before any other command. Extensions named
+// by several require commands accumulate into a single set.
+func checkRequirePlacement(cmds []parser.Cmd) error {
+	otherSeen := false
+	for _, c := range cmds {
+		if strings.EqualFold(c.Id, "require") {
+			if otherSeen {
+				return lexer.ErrorAt(c, "require must come before any other command")
+			}
+		} else {
+			otherSeen = true
+		}
+		if err := checkNoRequire(c.Block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkNoRequire(cmds []parser.Cmd) error {
+	for _, c := range cmds {
+		if strings.EqualFold(c.Id, "require") {
+			return lexer.ErrorAt(c, "require is not allowed inside a block")
+		}
+		if err := checkNoRequire(c.Block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func LoadBlock(s *Script, cmds []parser.Cmd) ([]Cmd, error) {
 	loaded := make([]Cmd, 0, len(cmds))
 	for _, c := range cmds {
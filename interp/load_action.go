@@ -11,45 +11,54 @@ type Flags []string
 
 func canonicalFlags(src []string, remove Flags, aliases map[string]string) Flags {
 	// This does four things
-	// * Translate space delimited lists of flags into separate flags
+	// * Translate whitespace delimited lists of flags into separate flags
 	// * Handle flag aliases
 	// * Deduplicate
 	// * Sort
 	// * (optionally) remove flags
 	c := make(Flags, 0, len(src))
-	fm := make(map[string]struct{})
+	fm := make(map[string]string)
 	for _, fl := range src {
-		for _, f := range strings.Split(fl, " ") {
-			// RFC 3501: Flags are case-insensitive.
-			f = strings.ToLower(f)
-			if fc, ok := aliases[f]; ok {
-				fm[fc] = struct{}{}
-			} else {
-				fm[f] = struct{}{}
+		for _, f := range strings.Fields(fl) {
+			if fc, ok := aliases[strings.ToLower(f)]; ok {
+				f = fc
+			}
+			f = canonicalFlag(f)
+			key := strings.ToLower(f)
+			if _, ok := fm[key]; !ok {
+				fm[key] = f
 			}
 		}
 	}
 	for _, fl := range remove {
-		for _, f := range strings.Split(fl, " ") {
-			// RFC 3501: Flags are case-insensitive.
-			f = strings.ToLower(f)
-			if fc, ok := aliases[f]; ok {
-				delete(fm, fc)
-			} else {
-				delete(fm, f)
+		for _, f := range strings.Fields(fl) {
+			if fc, ok := aliases[strings.ToLower(f)]; ok {
+				f = fc
 			}
+			delete(fm, strings.ToLower(f))
 		}
 	}
-	for f := range fm {
+	for _, f := range fm {
 		c = append(c, f)
 	}
 	sort.Strings(c)
 	return c
 }
 
+// canonicalFlag case-folds IMAP system flags (RFC 3501: "\Seen", "\SEEN"
+// and "\seen" are the same flag). Keywords keep the spelling used by the
+// script; they are still compared case-insensitively when deduplicating and
+// removing flags.
+func canonicalFlag(f string) string {
+	if strings.HasPrefix(f, "\\") {
+		return strings.ToLower(f)
+	}
+	return f
+}
+
 func loadFileInto(s *Script, pcmd parser.Cmd) (Cmd, error) {
 	if !s.RequiresExtension("fileinto") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'fileinto")
+		return nil, requireError(pcmd.Position, "fileinto")
 	}
 	cmd := CmdFileInto{}
 	err := LoadSpec(s, &Spec{
@@ -88,16 +97,20 @@ func loadFileInto(s *Script, pcmd parser.Cmd) (Cmd, error) {
 		return nil, err
 	}
 
+	if len(usedVars(s, cmd.Mailbox)) == 0 && strings.TrimSpace(cmd.Mailbox) == "" {
+		return nil, parser.ErrorAt(pcmd.Position, "fileinto: empty mailbox name")
+	}
+
 	if !s.RequiresExtension("imap4flags") && cmd.Flags != nil {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'imap4flags")
+		return nil, requireError(pcmd.Position, "imap4flags")
 	}
 
 	if cmd.Copy && !s.RequiresExtension("copy") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'copy'")
+		return nil, requireError(pcmd.Position, "copy")
 	}
 
 	if cmd.Create && !s.RequiresExtension("mailbox") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'mailbox'")
+		return nil, requireError(pcmd.Position, "mailbox")
 	}
 
 	return cmd, nil
@@ -128,8 +141,14 @@ func loadRedirect(s *Script, pcmd parser.Cmd) (Cmd, error) {
 		return nil, err
 	}
 
+	if len(usedVars(s, cmd.Addr)) == 0 {
+		if err := checkRedirectAddr(cmd.Addr); err != nil {
+			return nil, parser.ErrorAt(pcmd.Position, "redirect: %v", err)
+		}
+	}
+
 	if cmd.Copy && !s.RequiresExtension("copy") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'copy'")
+		return nil, requireError(pcmd.Position, "copy")
 	}
 
 	return cmd, nil
@@ -153,7 +172,7 @@ func loadKeep(s *Script, pcmd parser.Cmd) (Cmd, error) {
 	}
 
 	if !s.RequiresExtension("imap4flags") && cmd.Flags != nil {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'imap4flags")
+		return nil, requireError(pcmd.Position, "imap4flags")
 	}
 
 	return cmd, nil
@@ -167,7 +186,7 @@ func loadDiscard(s *Script, pcmd parser.Cmd) (Cmd, error) {
 
 func loadSetFlag(s *Script, pcmd parser.Cmd) (Cmd, error) {
 	if !s.RequiresExtension("imap4flags") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'imap4flags")
+		return nil, requireError(pcmd.Position, "imap4flags")
 	}
 	cmd := CmdSetFlag{}
 	err := LoadSpec(s, &Spec{
@@ -189,7 +208,7 @@ func loadSetFlag(s *Script, pcmd parser.Cmd) (Cmd, error) {
 
 func loadAddFlag(s *Script, pcmd parser.Cmd) (Cmd, error) {
 	if !s.RequiresExtension("imap4flags") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'imap4flags")
+		return nil, requireError(pcmd.Position, "imap4flags")
 	}
 	cmd := CmdAddFlag{}
 	err := LoadSpec(s, &Spec{
@@ -211,7 +230,7 @@ func loadAddFlag(s *Script, pcmd parser.Cmd) (Cmd, error) {
 
 func loadRemoveFlag(s *Script, pcmd parser.Cmd) (Cmd, error) {
 	if !s.RequiresExtension("imap4flags") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'imap4flags")
+		return nil, requireError(pcmd.Position, "imap4flags")
 	}
 	cmd := CmdRemoveFlag{}
 	err := LoadSpec(s, &Spec{
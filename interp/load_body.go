@@ -6,11 +6,11 @@ import (
 
 func loadBodyTest(s *Script, ptest parser.Test) (Test, error) {
 	if !s.RequiresExtension("body") {
-		return nil, parser.ErrorAt(ptest.Position, "missing require 'body'")
+		return nil, requireError(ptest.Position, "body")
 	}
 
 	test := &TestBody{
-		matcherTest: newMatcherTest(),
+		matcherTest: newMatcherTest(s),
 	}
 
 	spec := test.matcherTest.addSpecTags(&Spec{})
@@ -64,7 +64,7 @@ func loadBodyTest(s *Script, ptest parser.Test) (Test, error) {
 
 	err = test.matcherTest.setKey(s, test.matcherTest.key)
 	if err != nil {
-		return nil, parser.ErrorAt(ptest.Position, err.Error())
+		return nil, parser.ErrorAt(ptest.Position, "%w", err)
 	}
 
 	return test, nil
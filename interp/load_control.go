@@ -39,7 +39,7 @@ func loadRequire(s *Script, pcmd parser.Cmd) (Cmd, error) {
 
 		// Check if extension is enabled in configuration
 		if s.enabledExtensions == nil {
-			return nil, fmt.Errorf("extension '%s' is not supported", ext)
+			return nil, fmt.Errorf("extension '%s' is not enabled", ext)
 		}
 		enabled := false
 		for _, enabledExt := range s.enabledExtensions {
@@ -49,7 +49,7 @@ func loadRequire(s *Script, pcmd parser.Cmd) (Cmd, error) {
 			}
 		}
 		if !enabled {
-			return nil, fmt.Errorf("extension '%s' is not supported", ext)
+			return nil, fmt.Errorf("extension '%s' is not enabled", ext)
 		}
 
 		s.extensions[ext] = struct{}{}
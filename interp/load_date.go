@@ -15,17 +15,17 @@ import (
 //	     <header-name: string> <date-part: string> <key-list: string-list>
 func loadDateTest(s *Script, test parser.Test) (Test, error) {
 	if !s.RequiresExtension("date") {
-		return nil, fmt.Errorf("missing require 'date'")
+		return nil, requireError(test.Position, "date")
 	}
 
 	loaded := DateTest{
-		matcherTest: newMatcherTest(),
+		matcherTest: newMatcherTest(s),
 	}
 
 	var key []string
 	var zoneCnt int
 
-	spec := loaded.addSpecTags(&Spec{
+	spec := loaded.fieldIndex.addSpecTags(loaded.matcherTest.addSpecTags(&Spec{
 		Tags: map[string]SpecTag{
 			"zone": {
 				NeedsValue:  true,
@@ -42,17 +42,6 @@ func loadDateTest(s *Script, test parser.Test) (Test, error) {
 					zoneCnt++
 				},
 			},
-			"index": {
-				NeedsValue: true,
-				MatchNum: func(val int) {
-					loaded.Index = val
-				},
-			},
-			"last": {
-				MatchBool: func() {
-					loaded.Last = true
-				},
-			},
 		},
 		Pos: []SpecPosArg{
 			{
@@ -76,7 +65,7 @@ func loadDateTest(s *Script, test parser.Test) (Test, error) {
 				},
 			},
 		},
-	})
+	}))
 
 	err := LoadSpec(s, spec, test.Position, test.Args, test.Tests, nil)
 	if err != nil {
@@ -100,16 +89,12 @@ func loadDateTest(s *Script, test parser.Test) (Test, error) {
 		return nil, fmt.Errorf("date: invalid date-part: %s", loaded.DatePart)
 	}
 
-	// Validate :index and :last usage
-	if loaded.Last && loaded.Index == 0 {
-		return nil, fmt.Errorf("date: :last requires :index")
-	}
-	if loaded.Index > 0 && !s.RequiresExtension("index") {
-		return nil, fmt.Errorf("date: missing require 'index' for :index argument")
+	if err := loaded.fieldIndex.check(s, true); err != nil {
+		return nil, parser.ErrorAt(test.Position, "date: %w", err)
 	}
 
 	if err := loaded.setKey(s, key); err != nil {
-		return nil, err
+		return nil, parser.ErrorAt(test.Position, "%w", err)
 	}
 
 	return loaded, nil
@@ -123,11 +108,11 @@ func loadDateTest(s *Script, test parser.Test) (Test, error) {
 //	            <date-part: string> <key-list: string-list>
 func loadCurrentDateTest(s *Script, test parser.Test) (Test, error) {
 	if !s.RequiresExtension("date") {
-		return nil, fmt.Errorf("missing require 'date'")
+		return nil, requireError(test.Position, "date")
 	}
 
 	loaded := CurrentDateTest{
-		matcherTest: newMatcherTest(),
+		matcherTest: newMatcherTest(s),
 	}
 
 	var key []string
@@ -178,7 +163,7 @@ func loadCurrentDateTest(s *Script, test parser.Test) (Test, error) {
 	}
 
 	if err := loaded.setKey(s, key); err != nil {
-		return nil, err
+		return nil, parser.ErrorAt(test.Position, "%w", err)
 	}
 
 	return loaded, nil
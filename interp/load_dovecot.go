@@ -158,7 +158,7 @@ func loadDovecotRun(s *Script, test parser.Test) (Test, error) {
 }
 
 func loadDovecotError(s *Script, test parser.Test) (Test, error) {
-	loaded := TestDovecotTestError{matcherTest: newMatcherTest()}
+	loaded := TestDovecotTestError{matcherTest: newMatcherTest(s)}
 	err := LoadSpec(s, loaded.addSpecTags(&Spec{
 		Tags: map[string]SpecTag{
 			"index": {
@@ -166,7 +166,7 @@ func loadDovecotError(s *Script, test parser.Test) (Test, error) {
 				MinStrCount: 1,
 				MaxStrCount: 1,
 				NoVariables: true,
-				MatchNum:    func(val int) {},
+				MatchNum:    func(val int64) {},
 			},
 		},
 		Pos: []SpecPosArg{
@@ -178,3 +178,103 @@ func loadDovecotError(s *Script, test parser.Test) (Test, error) {
 	}), test.Position, test.Args, test.Tests, nil)
 	return loaded, err
 }
+
+func loadDebugLog(s *Script, pcmd parser.Cmd) (Cmd, error) {
+	if !s.RequiresExtension(DovecotDebugExtension) {
+		return nil, requireError(pcmd.Position, DovecotDebugExtension)
+	}
+	cmd := CmdDebugLog{}
+	err := LoadSpec(s, &Spec{
+		Pos: []SpecPosArg{
+			{
+				MinStrCount: 1,
+				MaxStrCount: 1,
+				MatchStr: func(val []string) {
+					cmd.Message = val[0]
+				},
+			},
+		},
+	}, pcmd.Position, pcmd.Args, pcmd.Tests, pcmd.Block)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+func loadDovecotResultReset(s *Script, pcmd parser.Cmd) (Cmd, error) {
+	err := LoadSpec(s, &Spec{}, pcmd.Position, pcmd.Args, pcmd.Tests, pcmd.Block)
+	return CmdDovecotResultReset{}, err
+}
+
+func loadDovecotTestMessage(s *Script, pcmd parser.Cmd) (Cmd, error) {
+	if !s.RequiresExtension(DovecotTestExtension) || s.opts.T == nil {
+		return nil, fmt.Errorf("testing environment is not enabled")
+	}
+	cmd := CmdDovecotTestMessage{}
+	sources := 0
+	err := LoadSpec(s, &Spec{
+		Tags: map[string]SpecTag{
+			"smtp": {
+				MatchBool: func() {
+					cmd.SMTP = true
+					sources++
+				},
+			},
+			"folder": {
+				NeedsValue:  true,
+				MinStrCount: 1,
+				MaxStrCount: 1,
+				MatchStr: func(val []string) {
+					cmd.Folder = val[0]
+					sources++
+				},
+			},
+		},
+		Pos: []SpecPosArg{
+			{
+				MatchNum: func(i int64) {
+					cmd.Index = i
+				},
+			},
+		},
+	}, pcmd.Position, pcmd.Args, pcmd.Tests, pcmd.Block)
+	if err != nil {
+		return nil, err
+	}
+	if sources != 1 {
+		return nil, parser.ErrorAt(pcmd.Position, "test_message: exactly one of :smtp and :folder is required")
+	}
+	return cmd, nil
+}
+
+func loadDovecotResultExecute(s *Script, test parser.Test) (Test, error) {
+	err := LoadSpec(s, &Spec{}, test.Position, test.Args, test.Tests, nil)
+	return TestDovecotResultExecute{}, err
+}
+
+func loadDovecotResultAction(s *Script, test parser.Test) (Test, error) {
+	loaded := TestDovecotResultAction{matcherTest: newMatcherTest(s)}
+	var key []string
+	err := LoadSpec(s, loaded.fieldIndex.addSpecTags(loaded.matcherTest.addSpecTags(&Spec{
+		Pos: []SpecPosArg{
+			{
+				MatchStr: func(val []string) {
+					key = val
+				},
+				MinStrCount: 1,
+			},
+		},
+	})), test.Position, test.Args, test.Tests, nil)
+	if err != nil {
+		return nil, err
+	}
+	// :index belongs to the testsuite here, not to the index extension.
+	if err := loaded.fieldIndex.check(s, false); err != nil {
+		return nil, parser.ErrorAt(test.Position, "%w", err)
+	}
+	if err := loaded.setKey(s, key); err != nil {
+		return nil, parser.ErrorAt(test.Position, "%w", err)
+	}
+	return loaded, nil
+}
@@ -8,7 +8,7 @@ import (
 // Usage: "addheader" [":last"] <field-name: string> <value: string>
 func loadAddHeader(s *Script, pcmd parser.Cmd) (Cmd, error) {
 	if !s.RequiresExtension("editheader") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'editheader'")
+		return nil, requireError(pcmd.Position, "editheader")
 	}
 
 	cmd := CmdAddHeader{}
@@ -55,28 +55,14 @@ func loadAddHeader(s *Script, pcmd parser.Cmd) (Cmd, error) {
 //	[<value-patterns: string-list>]
 func loadDeleteHeader(s *Script, pcmd parser.Cmd) (Cmd, error) {
 	if !s.RequiresExtension("editheader") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'editheader'")
+		return nil, requireError(pcmd.Position, "editheader")
 	}
 
 	cmd := CmdDeleteHeader{
-		matcherTest: newMatcherTest(),
+		matcherTest: newMatcherTest(s),
 	}
 
-	spec := cmd.matcherTest.addSpecTags(&Spec{
-		Tags: map[string]SpecTag{
-			"index": {
-				NeedsValue: true,
-				MatchNum: func(val int) {
-					cmd.Index = val
-				},
-			},
-			"last": {
-				NeedsValue: false,
-				MatchBool: func() {
-					cmd.Last = true
-				},
-			},
-		},
+	spec := cmd.fieldIndex.addSpecTags(cmd.matcherTest.addSpecTags(&Spec{
 		Pos: []SpecPosArg{
 			{
 				MinStrCount: 1,
@@ -93,23 +79,23 @@ func loadDeleteHeader(s *Script, pcmd parser.Cmd) (Cmd, error) {
 				},
 			},
 		},
-	})
+	}))
 
 	err := LoadSpec(s, spec, pcmd.Position, pcmd.Args, pcmd.Tests, pcmd.Block)
 	if err != nil {
 		return nil, err
 	}
 
-	// Per RFC 5293: :last MUST only be specified with :index
-	if cmd.Last && cmd.Index == 0 {
-		return nil, parser.ErrorAt(pcmd.Position, ":last can only be specified with :index")
+	// RFC 5293: :index is part of editheader, no require 'index' needed.
+	if err := cmd.fieldIndex.check(s, false); err != nil {
+		return nil, parser.ErrorAt(pcmd.Position, "deleteheader: %w", err)
 	}
 
 	// Set up the key for matcher if value patterns are provided
 	if len(cmd.ValuePatterns) > 0 {
 		err = cmd.matcherTest.setKey(s, cmd.ValuePatterns)
 		if err != nil {
-			return nil, parser.ErrorAt(pcmd.Position, "deleteheader: %v", err)
+			return nil, parser.ErrorAt(pcmd.Position, "deleteheader: %w", err)
 		}
 	}
 
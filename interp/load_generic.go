@@ -10,9 +10,13 @@ import (
 type SpecTag struct {
 	NeedsValue bool
 	MatchStr   func(val []string)
-	MatchNum   func(val int)
+	MatchNum   func(val int64)
 	MatchBool  func()
 
+	// CheckStr, if set, validates the string value before MatchStr. Its
+	// error is reported at the position of the value.
+	CheckStr func(val []string) error
+
 	// Checks for used string list.
 	MinStrCount int
 	MaxStrCount int
@@ -24,7 +28,10 @@ type SpecTag struct {
 type SpecPosArg struct {
 	Optional bool
 	MatchStr func(val []string)
-	MatchNum func(i int)
+	MatchNum func(i int64)
+
+	// CheckStr is as in SpecTag.
+	CheckStr func(val []string) error
 
 	// Checks for used string list.
 	MinStrCount int
@@ -44,8 +51,32 @@ type Spec struct {
 	MultipleTests bool
 }
 
+// checkVarRefs returns an error if a value of the string argument at pos
+// references a variable that cannot be read, e.g. one from a namespace whose
+// extension is not required (RFC 5229, Section 3).
+func checkVarRefs(s *Script, pos lexer.Position, values ...string) error {
+	for _, v := range values {
+		if !usedVarsAreValid(s, v) {
+			return lexer.ErrorAt(pos, "LoadSpec: invalid variable reference in %q", v)
+		}
+	}
+	return nil
+}
+
+// checkStr runs check, if any, on the values of the string argument a.
+func checkStr(check func([]string) error, a parser.Arg, values []string) error {
+	if check == nil {
+		return nil
+	}
+	if err := check(values); err != nil {
+		return lexer.ErrorAt(a, "%w", err)
+	}
+	return nil
+}
+
 func LoadSpec(s *Script, spec *Spec, position lexer.Position, args []parser.Arg, tests []parser.Test, block []parser.Cmd) error {
 	var lastTag *SpecTag
+	seenTags := make(map[string]bool, len(args))
 	nextPosArg := 0
 	for _, a := range args {
 		switch a := a.(type) {
@@ -59,13 +90,18 @@ func LoadSpec(s *Script, spec *Spec, position lexer.Position, args []parser.Arg,
 						var err error
 						value, err = decodeEncodedChars(value)
 						if err != nil {
-							return lexer.ErrorAt(position, "LoadSpec: malformed encoded character sequence: %v", err)
+							return lexer.ErrorAt(a, "LoadSpec: malformed encoded character sequence: %v", err)
 						}
 					}
-					if s.RequiresExtension("variables") && !lastTag.NoVariables {
-
+					if !lastTag.NoVariables {
+						if err := checkVarRefs(s, a.Position, value); err != nil {
+							return err
+						}
 					}
 
+					if err := checkStr(lastTag.CheckStr, a, []string{value}); err != nil {
+						return err
+					}
 					lastTag.MatchStr([]string{value})
 				} else {
 					panic("missing matcher for SpecTag")
@@ -88,10 +124,18 @@ func LoadSpec(s *Script, spec *Spec, position lexer.Position, args []parser.Arg,
 					var err error
 					value, err = decodeEncodedChars(value)
 					if err != nil {
-						return lexer.ErrorAt(position, "LoadSpec: malformed encoded character sequence: %v", err)
+						return lexer.ErrorAt(a, "LoadSpec: malformed encoded character sequence: %v", err)
+					}
+				}
+				if !pos.NoVariables {
+					if err := checkVarRefs(s, a.Position, value); err != nil {
+						return err
 					}
 				}
 
+				if err := checkStr(pos.CheckStr, a, []string{value}); err != nil {
+					return err
+				}
 				pos.MatchStr([]string{value})
 			} else {
 				panic("no pos matcher")
@@ -102,21 +146,35 @@ func LoadSpec(s *Script, spec *Spec, position lexer.Position, args []parser.Arg,
 				if lastTag.MatchNum != nil {
 					return lexer.ErrorAt(a, "LoadSpec: tagged argument requires a number, got string-list")
 				} else if lastTag.MatchStr != nil {
+					if len(a.Value) == 0 && lastTag.MinStrCount != 0 {
+						return lexer.ErrorAt(a, "LoadSpec: empty string-list, at least one string is required")
+					}
 					if (lastTag.MinStrCount != 0 && len(a.Value) < lastTag.MinStrCount) || (lastTag.MaxStrCount != 0 && len(a.Value) > lastTag.MaxStrCount) {
 						return lexer.ErrorAt(a, "LoadSpec: wrong amount of string arguments")
 					}
 
 					value := a.Value
 					if s.RequiresExtension("encoded-character") {
+						// Decode into a copy, the parsed script may be
+						// loaded again.
+						value = append([]string(nil), value...)
 						for i := range value {
 							var err error
 							value[i], err = decodeEncodedChars(value[i])
 							if err != nil {
-								return lexer.ErrorAt(position, "LoadSpec: malformed encoded character sequence: %v", err)
+								return lexer.ErrorAt(a, "LoadSpec: malformed encoded character sequence: %v", err)
 							}
 						}
 					}
+					if !lastTag.NoVariables {
+						if err := checkVarRefs(s, a.Position, value...); err != nil {
+							return err
+						}
+					}
 
+					if err := checkStr(lastTag.CheckStr, a, value); err != nil {
+						return err
+					}
 					lastTag.MatchStr(value)
 				} else {
 					panic("missing matcher for SpecTag")
@@ -129,6 +187,9 @@ func LoadSpec(s *Script, spec *Spec, position lexer.Position, args []parser.Arg,
 				return lexer.ErrorAt(a, "LoadSpec: too many arguments")
 			}
 			pos := spec.Pos[nextPosArg]
+			if len(a.Value) == 0 && pos.MinStrCount != 0 {
+				return lexer.ErrorAt(a, "LoadSpec: empty string-list, at least one string is required")
+			}
 			if (pos.MinStrCount != 0 && len(a.Value) < pos.MinStrCount) || (pos.MaxStrCount != 0 && len(a.Value) > pos.MaxStrCount) {
 				return lexer.ErrorAt(a, "LoadSpec: wrong amount of string arguments")
 			}
@@ -137,15 +198,24 @@ func LoadSpec(s *Script, spec *Spec, position lexer.Position, args []parser.Arg,
 			} else if pos.MatchStr != nil {
 				value := a.Value
 				if s.RequiresExtension("encoded-character") {
+					value = append([]string(nil), value...)
 					for i := range value {
 						var err error
 						value[i], err = decodeEncodedChars(value[i])
 						if err != nil {
-							return lexer.ErrorAt(position, "LoadSpec: malformed encoded character sequence: %v", err)
+							return lexer.ErrorAt(a, "LoadSpec: malformed encoded character sequence: %v", err)
 						}
 					}
 				}
+				if !pos.NoVariables {
+					if err := checkVarRefs(s, a.Position, value...); err != nil {
+						return err
+					}
+				}
 
+				if err := checkStr(pos.CheckStr, a, value); err != nil {
+					return err
+				}
 				pos.MatchStr(value)
 			} else {
 				panic("no pos matcher")
@@ -180,10 +250,16 @@ func LoadSpec(s *Script, spec *Spec, position lexer.Position, args []parser.Arg,
 			if lastTag != nil && lastTag.NeedsValue {
 				return lexer.ErrorAt(a, "LoadSpec: tagged argument requires a value")
 			}
-			tag, ok := spec.Tags[strings.ToLower(a.Value)]
+			name := strings.ToLower(a.Value)
+			tag, ok := spec.Tags[name]
 			if !ok {
 				return lexer.ErrorAt(a, "LoadSpec: unknown tagged argument: %v", a.Value)
 			}
+			// No command or test takes the same tagged argument twice.
+			if seenTags[name] {
+				return lexer.ErrorAt(a, "LoadSpec: :%s specified more than once", name)
+			}
+			seenTags[name] = true
 			if tag.NeedsValue {
 				lastTag = &tag
 			} else {
@@ -199,7 +275,9 @@ func LoadSpec(s *Script, spec *Spec, position lexer.Position, args []parser.Arg,
 
 	if spec.AddTest == nil {
 		if len(tests) != 0 {
-			return lexer.ErrorAt(position, "LoadSpec: no tests allowed")
+			// A test after the arguments of an action is usually the
+			// next command with the semicolon before it missing.
+			return lexer.ErrorAt(tests[0].Position, "LoadSpec: no tests allowed, missing semicolon before %s?", tests[0].Id)
 		}
 	} else {
 		if len(tests) == 0 && !spec.TestOptional {
@@ -8,7 +8,7 @@ import (
 // Usage: mailboxexists <mailbox-names: string-list>
 func loadMailboxExistsTest(s *Script, test parser.Test) (Test, error) {
 	if !s.RequiresExtension("mailbox") {
-		return nil, parser.ErrorAt(test.Position, "missing require 'mailbox'")
+		return nil, requireError(test.Position, "mailbox")
 	}
 
 	t := MailboxExistsTest{}
@@ -1,6 +1,8 @@
 package interp
 
 import (
+	"context"
+	"net/textproto"
 	"reflect"
 	"strings"
 	"testing"
@@ -46,6 +48,72 @@ func testCmdLoader(t *testing.T, s *Script, in string, out []Cmd) {
 	})
 }
 
+func loadTestScript(t *testing.T, opts *Options, in string) *Script {
+	t.Helper()
+	allExtensions := make([]string, 0, len(supportedRequires))
+	for ext := range supportedRequires {
+		allExtensions = append(allExtensions, ext)
+	}
+	s, err := loadTestScriptErr(t, opts, allExtensions, in)
+	if err != nil {
+		t.Fatal("LoadScript failed:", err)
+	}
+	return s
+}
+
+// loadTestScriptErr is like loadTestScript but enables only the extensions
+// in enabled and returns the error of LoadScript.
+func loadTestScriptErr(t *testing.T, opts *Options, enabled []string, in string) (*Script, error) {
+	t.Helper()
+	toks, err := lexer.Lex(strings.NewReader(in), &lexer.Options{})
+	if err != nil {
+		t.Fatal("Lexer failed:", err)
+	}
+	cmds, err := parser.Parse(lexer.NewStream(toks), &parser.Options{})
+	if err != nil {
+		t.Fatal("Parser failed:", err)
+	}
+	return LoadScript(cmds, opts, enabled)
+}
+
+// testRuntimeData returns RuntimeData for a message with header hdr and,
+// unless it is nil, body.
+func testRuntimeData(s *Script, hdr textproto.MIMEHeader, body []byte) *RuntimeData {
+	if hdr == nil {
+		hdr = textproto.MIMEHeader{}
+	}
+	return NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{
+		Header:  hdr,
+		Body:    body,
+		HasBody: body != nil,
+	})
+}
+
+// runHeaderScript loads in and executes it against a message with header
+// hdr and no body.
+func runHeaderScript(t *testing.T, opts *Options, in string, hdr textproto.MIMEHeader) *RuntimeData {
+	t.Helper()
+	s := loadTestScript(t, opts, in)
+	d := testRuntimeData(s, hdr, nil)
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// runBodyScript loads in and executes it against a message with the given
+// Content-Type and body. An empty contentType leaves the header empty.
+func runBodyScript(t *testing.T, opts *Options, in, contentType, body string) (*RuntimeData, error) {
+	t.Helper()
+	s := loadTestScript(t, opts, in)
+	hdr := textproto.MIMEHeader{}
+	if contentType != "" {
+		hdr.Set("Content-Type", contentType)
+	}
+	d := testRuntimeData(s, hdr, []byte(body))
+	return d, s.Execute(context.Background(), d)
+}
+
 func TestLoadBlock(t *testing.T) {
 	// Enable all extensions for testing
 	allExtensions := make([]string, 0, len(supportedRequires))
@@ -55,6 +123,7 @@ func TestLoadBlock(t *testing.T) {
 	s := &Script{
 		extensions:        supportedRequires,
 		enabledExtensions: allExtensions,
+		opts:              &Options{},
 	}
 	testCmdLoader(t, s, `require ["envelope"];`, []Cmd{})
 	testCmdLoader(t, s, `if true { }`, []Cmd{CmdIf{
@@ -109,3 +178,65 @@ removeflag "flag2";
 		},
 	})
 }
+
+func TestLoadDuplicateMatchTags(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		pos string
+	}{
+		{`header :is :contains "Subject" "x"`, "2:4: "},
+		{`header :comparator "i;octet" :comparator "i;ascii-casemap" "Subject" "x"`, "2:33: "},
+		{`address :matches :is "From" "x"`, "2:4: "},
+		{`envelope :comparator "i;octet" :is :comparator "i;octet" "from" "x"`, "2:39: "},
+	} {
+		_, err := loadTestScriptErr(t, &Options{}, []string{"envelope"}, "require \"envelope\";\nif "+tc.in+" { keep; }")
+		if err == nil {
+			t.Errorf("%s: expected a load error", tc.in)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tc.pos) {
+			t.Errorf("%s: error %q does not start with %q", tc.in, err, tc.pos)
+		}
+	}
+}
+
+func TestLoadEmptyStringList(t *testing.T) {
+	for _, in := range []string{
+		`if header :is "Subject" [] { keep; }`,
+		`if exists [] { keep; }`,
+	} {
+		_, err := loadTestScriptErr(t, &Options{}, nil, in)
+		if err == nil {
+			t.Errorf("%s: expected a load error", in)
+			continue
+		}
+		if !strings.Contains(err.Error(), "empty string-list") {
+			t.Errorf("%s: error %q does not mention the empty list", in, err)
+		}
+	}
+}
+
+func TestLoadMissingSemicolon(t *testing.T) {
+	_, err := loadTestScriptErr(t, &Options{}, []string{"fileinto"}, "require \"fileinto\";\nfileinto \"frop\"\nkeep;\n")
+	if err == nil {
+		t.Fatal("expected a load error")
+	}
+	if want := "3:1: LoadSpec: no tests allowed, missing semicolon before keep?"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestLoadScriptNilOptions(t *testing.T) {
+	hdr := textproto.MIMEHeader{}
+	hdr.Set("Subject", "hello")
+	hdr.Set("To", "user+box@example.org")
+	d := runHeaderScript(t, nil, `require ["subaddress", "comparator-i;unicode-casemap"];
+if allof(header :comparator "i;unicode-casemap" :is "Subject" "HELLO",
+         address :detail "To" "box",
+         header :matches "Subject" "h*") {
+	keep;
+}`, hdr)
+	if !d.Keep {
+		t.Error("script with nil Options did not match")
+	}
+}
@@ -2,18 +2,19 @@ package interp
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/migadu/go-sieve/parser"
 )
 
 func loadAddressTest(s *Script, test parser.Test) (Test, error) {
 	loaded := AddressTest{
-		matcherTest: newMatcherTest(),
+		matcherTest: newMatcherTest(s),
 		AddressPart: All,
 	}
 	var key []string
 	var useSubaddress bool
-	err := LoadSpec(s, loaded.addSpecTags(&Spec{
+	err := LoadSpec(s, loaded.mimeTest.addPartSpecTags(loaded.fieldIndex.addSpecTags(loaded.matcherTest.addSpecTags(&Spec{
 		Tags: map[string]SpecTag{
 			"all": {
 				MatchBool: func() {
@@ -63,13 +64,21 @@ func loadAddressTest(s *Script, test parser.Test) (Test, error) {
 				MinStrCount: 1,
 			},
 		},
-	}), test.Position, test.Args, test.Tests, nil)
+	}))), test.Position, test.Args, test.Tests, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	if err := loaded.setKey(s, key); err != nil {
-		return nil, err
+		return nil, parser.ErrorAt(test.Position, "%w", err)
+	}
+
+	if err := loaded.fieldIndex.check(s, true); err != nil {
+		return nil, parser.ErrorAt(test.Position, "address: %w", err)
+	}
+
+	if err := loaded.mimeTest.check(s); err != nil {
+		return nil, parser.ErrorAt(test.Position, "address: %w", err)
 	}
 
 	// Check for duplicate address parts
@@ -79,7 +88,7 @@ func loadAddressTest(s *Script, test parser.Test) (Test, error) {
 
 	// Check for require "subaddress" when :user or :detail is used
 	if useSubaddress && !s.RequiresExtension("subaddress") {
-		return nil, parser.ErrorAt(test.Position, "missing require 'subaddress'")
+		return nil, requireError(test.Position, "subaddress")
 	}
 
 	return loaded, nil
@@ -109,11 +118,11 @@ func loadAnyOfTest(s *Script, test parser.Test) (Test, error) {
 
 func loadEnvelopeTest(s *Script, test parser.Test) (Test, error) {
 	if !s.RequiresExtension("envelope") {
-		return nil, fmt.Errorf("missing require 'envelope'")
+		return nil, requireError(test.Position, "envelope")
 	}
 
 	loaded := EnvelopeTest{
-		matcherTest: newMatcherTest(),
+		matcherTest: newMatcherTest(s),
 		AddressPart: All,
 	}
 	var key []string
@@ -169,12 +178,21 @@ func loadEnvelopeTest(s *Script, test parser.Test) (Test, error) {
 	}
 
 	if err := loaded.setKey(s, key); err != nil {
-		return nil, err
+		return nil, parser.ErrorAt(test.Position, "%w", err)
 	}
 
 	// Check for require "subaddress" when :user or :detail is used
 	if useSubaddress && !s.RequiresExtension("subaddress") {
-		return nil, parser.ErrorAt(test.Position, "missing require 'subaddress'")
+		return nil, requireError(test.Position, "subaddress")
+	}
+
+	for _, field := range loaded.Field {
+		if len(usedVars(s, field)) != 0 {
+			continue
+		}
+		if !envelopePartDefined(s, strings.ToLower(field)) {
+			return nil, parser.ErrorAt(test.Position, "envelope: unsupported envelope-part: %v", field)
+		}
 	}
 
 	return loaded, nil
@@ -182,7 +200,7 @@ func loadEnvelopeTest(s *Script, test parser.Test) (Test, error) {
 
 func loadExistsTest(s *Script, test parser.Test) (Test, error) {
 	loaded := ExistsTest{}
-	err := LoadSpec(s, &Spec{
+	err := LoadSpec(s, loaded.mimeTest.addPartSpecTags(&Spec{
 		Pos: []SpecPosArg{
 			{
 				MatchStr: func(val []string) {
@@ -191,8 +209,16 @@ func loadExistsTest(s *Script, test parser.Test) (Test, error) {
 				MinStrCount: 1,
 			},
 		},
-	}, test.Position, test.Args, test.Tests, nil)
-	return loaded, err
+	}), test.Position, test.Args, test.Tests, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loaded.mimeTest.check(s); err != nil {
+		return nil, parser.ErrorAt(test.Position, "exists: %w", err)
+	}
+
+	return loaded, nil
 }
 
 func loadFalseTest(s *Script, test parser.Test) (Test, error) {
@@ -208,9 +234,9 @@ func loadTrueTest(s *Script, test parser.Test) (Test, error) {
 }
 
 func loadHeaderTest(s *Script, test parser.Test) (Test, error) {
-	loaded := HeaderTest{matcherTest: newMatcherTest()}
+	loaded := HeaderTest{matcherTest: newMatcherTest(s)}
 	var key []string
-	err := LoadSpec(s, loaded.addSpecTags(&Spec{
+	err := LoadSpec(s, loaded.mimeTest.addSpecTags(loaded.fieldIndex.addSpecTags(loaded.matcherTest.addSpecTags(&Spec{
 		Pos: []SpecPosArg{
 			{
 				MatchStr: func(val []string) {
@@ -225,18 +251,26 @@ func loadHeaderTest(s *Script, test parser.Test) (Test, error) {
 				MinStrCount: 1,
 			},
 		},
-	}), test.Position, test.Args, test.Tests, nil)
+	}))), test.Position, test.Args, test.Tests, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	if err := loaded.setKey(s, key); err != nil {
-		return nil, err
+		return nil, parser.ErrorAt(test.Position, "%w", err)
+	}
+
+	if err := loaded.fieldIndex.check(s, true); err != nil {
+		return nil, parser.ErrorAt(test.Position, "header: %w", err)
+	}
+
+	if err := loaded.mimeTest.check(s); err != nil {
+		return nil, parser.ErrorAt(test.Position, "header: %w", err)
 	}
 
 	// Check if regex extension is required
 	if loaded.match == MatchRegex && !s.RequiresExtension("regex") {
-		return nil, fmt.Errorf("missing require 'regex'")
+		return nil, requireError(test.Position, "regex")
 	}
 
 	return loaded, nil
@@ -265,14 +299,20 @@ func loadSizeTest(s *Script, test parser.Test) (Test, error) {
 		},
 		Pos: []SpecPosArg{
 			{
-				MatchNum: func(i int) {
+				MatchNum: func(i int64) {
 					loaded.Size = i
 				},
 			},
 		},
 	}, test.Position, test.Args, test.Tests, nil)
-	if loaded.Under == loaded.Over {
-		return nil, fmt.Errorf("loadSizeTest: either under or over is required")
+	if err != nil {
+		return nil, err
 	}
-	return loaded, err
+	if !loaded.Under && !loaded.Over {
+		return nil, parser.ErrorAt(test.Position, "size requires exactly one of :over/:under")
+	}
+	if loaded.Under && loaded.Over {
+		return nil, parser.ErrorAt(test.Position, "size cannot specify both :over and :under")
+	}
+	return loaded, nil
 }
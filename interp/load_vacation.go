@@ -12,7 +12,7 @@ import (
 //	         [":mime"] [":handle" string] <reason: string>
 func loadVacation(s *Script, pcmd parser.Cmd) (Cmd, error) {
 	if !s.RequiresExtension("vacation") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'vacation'")
+		return nil, requireError(pcmd.Position, "vacation")
 	}
 
 	cmd := CmdVacation{
@@ -22,8 +22,11 @@ func loadVacation(s *Script, pcmd parser.Cmd) (Cmd, error) {
 		Tags: map[string]SpecTag{
 			"days": {
 				NeedsValue: true,
-				MatchNum: func(val int) {
-					cmd.Days = val
+				MatchNum: func(val int64) {
+					if val > MaxVacationDays {
+						val = MaxVacationDays
+					}
+					cmd.Days = int(val)
 				},
 			},
 			"subject": {
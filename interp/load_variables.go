@@ -1,16 +1,16 @@
 package interp
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/migadu/go-sieve/lexer"
 	"github.com/migadu/go-sieve/parser"
 )
 
 func loadSet(script *Script, pcmd parser.Cmd) (Cmd, error) {
 	if !script.RequiresExtension("variables") {
-		return nil, parser.ErrorAt(pcmd.Position, "missing require 'variables'")
+		return nil, requireError(pcmd.Position, "variables")
 	}
 	cmd := CmdSet{}
 
@@ -131,7 +131,7 @@ func loadSet(script *Script, pcmd parser.Cmd) (Cmd, error) {
 
 	settable, _ := script.IsVarUsable(cmd.Name)
 	if !settable {
-		return nil, parser.ErrorAt(pcmd.Position, "cannot set this variable")
+		return nil, setNameError(pcmd.Position, cmd.Name)
 	}
 
 	cmd.ModifyValue = func(s string) string {
@@ -173,12 +173,30 @@ func loadSet(script *Script, pcmd parser.Cmd) (Cmd, error) {
 	return cmd, err
 }
 
+// setNameError explains why set cannot assign the variable name
+// (RFC 5229, Section 4).
+func setNameError(pos lexer.Position, name string) error {
+	namespace, _, qualified := strings.Cut(strings.ToLower(name), ".")
+	switch {
+	case isNumVariable(name):
+		return parser.ErrorAt(pos, "cannot set match variable %q", name)
+	case qualified && namespace == "global":
+		// RFC 6609, Section 3.5; include is not supported.
+		return parser.ErrorAt(pos, "cannot set variable %q: the global namespace is not supported", name)
+	case qualified && namespace == "envelope":
+		return parser.ErrorAt(pos, "cannot set read-only variable %q", name)
+	case qualified:
+		return parser.ErrorAt(pos, "cannot set variable %q: unknown namespace %q", name, namespace)
+	}
+	return parser.ErrorAt(pos, "cannot set this variable")
+}
+
 func loadStringTest(s *Script, test parser.Test) (Test, error) {
 	if !s.RequiresExtension("variables") {
-		return nil, fmt.Errorf("missing require 'variables'")
+		return nil, requireError(test.Position, "variables")
 	}
 
-	loaded := TestString{matcherTest: newMatcherTest()}
+	loaded := TestString{matcherTest: newMatcherTest(s)}
 	var key []string
 	err := LoadSpec(s, loaded.addSpecTags(&Spec{
 		Pos: []SpecPosArg{
@@ -201,12 +219,12 @@ func loadStringTest(s *Script, test parser.Test) (Test, error) {
 	}
 
 	if err := loaded.setKey(s, key); err != nil {
-		return nil, err
+		return nil, parser.ErrorAt(test.Position, "%w", err)
 	}
 
 	// Check if regex extension is required
 	if loaded.match == MatchRegex && !s.RequiresExtension("regex") {
-		return nil, fmt.Errorf("missing require 'regex'")
+		return nil, requireError(test.Position, "regex")
 	}
 
 	return loaded, nil
@@ -29,7 +29,7 @@ func (m MailboxExistsTest) Check(ctx context.Context, d *RuntimeData) (bool, err
 
 		// Check if the policy implements MailboxChecker
 		if checker, ok := d.Policy.(MailboxChecker); ok {
-			exists, err := checker.MailboxExists(ctx, mailbox)
+			exists, err := d.checkMailbox(ctx, checker, mailbox)
 			if err != nil {
 				return false, err
 			}
@@ -42,3 +42,20 @@ func (m MailboxExistsTest) Check(ctx context.Context, d *RuntimeData) (bool, err
 	}
 	return true, nil
 }
+
+// checkMailbox asks checker whether mailbox exists, once per execution:
+// the answer is cached in d until fileinto :create names the mailbox.
+func (d *RuntimeData) checkMailbox(ctx context.Context, checker MailboxChecker, mailbox string) (bool, error) {
+	if exists, ok := d.mailboxExists[mailbox]; ok {
+		return exists, nil
+	}
+	exists, err := checker.MailboxExists(ctx, mailbox)
+	if err != nil {
+		return false, err
+	}
+	if d.mailboxExists == nil {
+		d.mailboxExists = make(map[string]bool)
+	}
+	d.mailboxExists[mailbox] = exists
+	return exists, nil
+}
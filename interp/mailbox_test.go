@@ -0,0 +1,63 @@
+package interp
+
+import (
+	"context"
+	"net/textproto"
+	"reflect"
+	"testing"
+)
+
+// countingChecker reports the mailboxes in exist as existing and counts the
+// queries for each mailbox.
+type countingChecker struct {
+	DummyPolicy
+	exist   map[string]bool
+	queries map[string]int
+}
+
+func (c *countingChecker) MailboxExists(_ context.Context, mailbox string) (bool, error) {
+	c.queries[mailbox]++
+	return c.exist[mailbox], nil
+}
+
+func TestMailboxExistsCache(t *testing.T) {
+	s := loadTestScript(t, &Options{}, `require ["fileinto", "mailbox", "copy"];
+if mailboxexists ["INBOX", "Archive", "INBOX"] { keep; }
+if mailboxexists "Archive" { keep; }
+if mailboxexists ["Missing", "Spam"] { keep; }
+if mailboxexists "Missing" { keep; }
+fileinto :create :copy "Missing";
+if mailboxexists "Missing" { keep; }`)
+
+	checker := &countingChecker{
+		exist:   map[string]bool{"INBOX": true, "Archive": true},
+		queries: map[string]int{},
+	}
+	d := NewRuntimeData(s, checker, EnvelopeStatic{}, MessageStatic{Header: textproto.MIMEHeader{}})
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// Spam is never asked for: the first test fails at Missing. Missing is
+	// asked for again after fileinto :create.
+	want := map[string]int{"INBOX": 1, "Archive": 1, "Missing": 2}
+	if !reflect.DeepEqual(checker.queries, want) {
+		t.Errorf("queries = %v, want %v", checker.queries, want)
+	}
+}
+
+func TestMailboxExistsCacheReset(t *testing.T) {
+	s := loadTestScript(t, &Options{}, `require "mailbox"; if mailboxexists "INBOX" { keep; }`)
+	checker := &countingChecker{
+		exist:   map[string]bool{"INBOX": true},
+		queries: map[string]int{},
+	}
+	d := NewRuntimeData(s, checker, EnvelopeStatic{}, MessageStatic{Header: textproto.MIMEHeader{}})
+	for i := 0; i < 2; i++ {
+		if err := s.Execute(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if checker.queries["INBOX"] != 2 {
+		t.Errorf("INBOX was asked for %d times over two executions, want 2", checker.queries["INBOX"])
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+
+	"github.com/migadu/go-sieve/lexer"
 )
 
 // matcherTest contains code shared between tests
@@ -18,17 +20,34 @@ type matcherTest struct {
 
 	// Used for keys without variables.
 	keyCompiled []CompiledMatcher
+	keyRegex    []*SafeRegexMatcher
 
 	matchCnt int
 }
 
-func newMatcherTest() matcherTest {
+// newMatcherTest returns a matcherTest with the defaults of RFC 5228: :is
+// and the comparator from Options.DefaultComparator, i;ascii-casemap if
+// not set.
+func newMatcherTest(s *Script) matcherTest {
+	comparator := DefaultComparator
+	if s.opts.DefaultComparator != "" {
+		comparator = s.opts.DefaultComparator
+	}
 	return matcherTest{
-		comparator: DefaultComparator,
+		comparator: comparator,
 		match:      MatchIs,
 	}
 }
 
+// validComparator reports whether c is a supported comparator.
+func validComparator(c Comparator) bool {
+	switch c {
+	case ComparatorOctet, ComparatorASCIICaseMap, ComparatorASCIINumeric, ComparatorUnicodeCaseMap:
+		return true
+	}
+	return false
+}
+
 func (t *matcherTest) addSpecTags(s *Spec) *Spec {
 	if s.Tags == nil {
 		s.Tags = make(map[string]SpecTag, 4)
@@ -37,6 +56,12 @@ func (t *matcherTest) addSpecTags(s *Spec) *Spec {
 		NeedsValue:  true,
 		MinStrCount: 1,
 		MaxStrCount: 1,
+		CheckStr: func(val []string) error {
+			if !validComparator(Comparator(val[0])) {
+				return fmt.Errorf("unsupported comparator: %v", val[0])
+			}
+			return nil
+		},
 		MatchStr: func(val []string) {
 			t.comparator = Comparator(val[0])
 		},
@@ -91,6 +116,10 @@ func (t *matcherTest) addSpecTags(s *Spec) *Spec {
 	return s
 }
 
+// setKey sets the key list and validates the tags. Keys that reference
+// variables are expanded each time the test runs, so they see values set
+// earlier in the script; :matches and :regex patterns without variables are
+// compiled here once.
 func (t *matcherTest) setKey(s *Script, k []string) error {
 	t.key = k
 
@@ -100,7 +129,7 @@ func (t *matcherTest) setKey(s *Script, k []string) error {
 
 	if t.match == MatchCount || t.match == MatchValue {
 		if !s.RequiresExtension("relational") {
-			return fmt.Errorf("missing require 'relational'")
+			return ExtensionRequiredError{Extension: "relational"}
 		}
 		switch t.relational {
 		case RelGreaterThan, RelGreaterOrEqual,
@@ -121,9 +150,6 @@ func (t *matcherTest) setKey(s *Script, k []string) error {
 	case ComparatorASCIICaseMap:
 		octet = true
 		caseFold = true
-	case ComparatorASCIINumeric:
-	default:
-		return fmt.Errorf("unsupported comparator: %v", t.comparator)
 	}
 
 	if t.match == MatchMatches {
@@ -133,8 +159,24 @@ func (t *matcherTest) setKey(s *Script, k []string) error {
 				continue
 			}
 
+			key := s.opts.Text.normalizeFor(t.comparator, t.key[i])
+			var err error
+			t.keyCompiled[i], err = compileMatcher(key, octet, caseFold)
+			if err != nil {
+				return fmt.Errorf("malformed pattern (%v): %v", t.key[i], err)
+			}
+		}
+	}
+	if t.match == MatchRegex && t.comparator != ComparatorASCIINumeric {
+		t.keyRegex = make([]*SafeRegexMatcher, len(t.key))
+		for i := range t.key {
+			if len(usedVars(s, t.key[i])) > 0 {
+				continue
+			}
+
+			key := s.opts.Text.normalizeFor(t.comparator, t.key[i])
 			var err error
-			t.keyCompiled[i], err = compileMatcher(t.key[i], octet, caseFold)
+			t.keyRegex[i], err = CompileSafeRegex(key, EffectiveRegexLimits(s.opts.RegexLimits))
 			if err != nil {
 				return fmt.Errorf("malformed pattern (%v): %v", t.key[i], err)
 			}
@@ -151,6 +193,16 @@ func (t *matcherTest) setKey(s *Script, k []string) error {
 	return nil
 }
 
+// MatchType returns the match type used by the test (":is" by default).
+func (t matcherTest) MatchType() Match {
+	return t.match
+}
+
+// Comparator returns the comparator used by the test.
+func (t matcherTest) Comparator() Comparator {
+	return t.comparator
+}
+
 func (t *matcherTest) isCount() bool {
 	return t.match == MatchCount
 }
@@ -175,6 +227,7 @@ func (t *matcherTest) countMatches(d *RuntimeData, value uint64) bool {
 }
 
 func (t *matcherTest) tryMatch(ctx context.Context, d *RuntimeData, source string) (bool, error) {
+	source = d.Script.opts.Text.normalizeFor(t.comparator, source)
 	for i, key := range t.key {
 		// Honour the script execution deadline between keys so a test with
 		// many keys/values can't run past the budget.
@@ -185,13 +238,26 @@ func (t *matcherTest) tryMatch(ctx context.Context, d *RuntimeData, source strin
 		var (
 			ok      bool
 			matches []string
+			names   []string
 			err     error
 		)
 		if t.keyCompiled != nil && t.keyCompiled[i] != nil {
 			ok, matches, err = t.keyCompiled[i](ctx, source)
+		} else if t.keyRegex != nil {
+			d.regexMatches++
+			re := t.keyRegex[i]
+			if re == nil {
+				key = d.Script.opts.Text.normalizeFor(t.comparator, expandVars(d, key))
+				re, err = CompileSafeRegex(key, EffectiveRegexLimits(d.Script.opts.RegexLimits))
+			}
+			if err == nil {
+				matches, err = re.FindSubmatch(ctx, regexValue(t.comparator, source))
+				ok = matches != nil
+				names = re.SubexpNames()
+			}
 		} else {
-			key = expandVars(d, key)
-			ok, matches, err = testString(ctx, t.comparator, t.match, t.relational, source, expandVars(d, key))
+			key = d.Script.opts.Text.normalizeFor(t.comparator, expandVars(d, key))
+			ok, matches, err = testString(ctx, t.comparator, t.match, t.relational, source, key)
 
 			// RFC 5231, Section 5.4:
 			// With the "i;ascii-numeric" comparator, a numeric comparison is
@@ -216,11 +282,36 @@ func (t *matcherTest) tryMatch(ctx context.Context, d *RuntimeData, source strin
 			return false, err
 		}
 		if ok {
+			// Match variables are taken from the value that matched and
+			// are left untouched by a failed match (RFC 5229, Section 3.2),
+			// so a test over several header values reports the captures of
+			// the value that succeeded.
 			if t.match == MatchMatches || t.match == MatchRegex {
 				d.MatchVariables = matches
 			}
+			if t.match == MatchRegex && d.Script.RequiresExtension("variables") {
+				if err := setNamedCaptures(d, names, matches); err != nil {
+					return false, err
+				}
+			}
 			return true, nil
 		}
 	}
 	return false, nil
 }
+
+// setNamedCaptures sets a variable for every named group of the :regex
+// pattern, so "(?P<topic>...)" is available as ${topic} after a match. names
+// are the group names of the compiled pattern, as SubexpNames returns them.
+// Groups whose names are not valid variable names are ignored.
+func setNamedCaptures(d *RuntimeData, names, matches []string) error {
+	for i, name := range names {
+		if name == "" || i >= len(matches) || !lexer.IsValidIdentifier(name) {
+			continue
+		}
+		if err := d.SetVar(name, matches[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package interp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// MessageRaw is implemented by messages that can provide their original
+// bytes, e.g. for a host that forwards the message on redirect.
+type MessageRaw interface {
+	// RawReader returns the message exactly as it was received.
+	RawReader() (io.ReadCloser, error)
+}
+
+// MessageHeaderRaw is implemented by messages that can provide header
+// values exactly as they appear in the message, with folding line breaks
+// and whitespace kept, for tests on signed fields such as DKIM-Signature.
+type MessageHeaderRaw interface {
+	// HeaderGetRaw returns the values of the key field with only the
+	// whitespace after the colon removed. ok is false if the raw values
+	// are not available.
+	HeaderGetRaw(key string) (values []string, ok bool, err error)
+}
+
+// headerValues returns the values of a field the header test compares:
+// the raw values for a field listed in Options.RawHeaders, if d.Msg has
+// them, otherwise the unfolded ones. Header edits apply in both cases.
+func headerValues(d *RuntimeData, fieldName string) (values []string, raw bool, err error) {
+	if hr, isRaw := d.Msg.(MessageHeaderRaw); isRaw && d.Script.isRawHeader(fieldName) && isValidHeaderName(fieldName) {
+		values, ok, err := hr.HeaderGetRaw(fieldName)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return applyHeaderEditsToValues(d, fieldName, values), true, nil
+		}
+	}
+	values, err = GetHeaderWithEdits(d, fieldName)
+	return values, false, err
+}
+
+// isRawHeader reports whether the header field name is listed in
+// Options.RawHeaders.
+func (s *Script) isRawHeader(name string) bool {
+	for _, h := range s.opts.RawHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RawMessage returns the message as it should be delivered or redirected:
+// the bytes of d.Msg with d.HeaderEdits applied to its header. ok is false
+// if d.Msg does not implement MessageRaw.
+func (d *RuntimeData) RawMessage() (rc io.ReadCloser, ok bool, err error) {
+	raw, isRaw := d.Msg.(MessageRaw)
+	if !isRaw {
+		return nil, false, nil
+	}
+	orig, err := raw.RawReader()
+	if err != nil {
+		return nil, true, err
+	}
+	if len(d.HeaderEdits) == 0 {
+		return orig, true, nil
+	}
+	edited, err := ApplyHeaderEdits(orig, d.HeaderEdits)
+	if err != nil {
+		orig.Close()
+		return nil, true, err
+	}
+	return readCloser{edited, orig}, true, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// rawField is a header field as it appears in the message, continuation
+// lines and line endings included.
+type rawField struct {
+	name string
+	raw  []byte
+}
+
+// value returns the unfolded field value, as ReadMessage stores it.
+func (f rawField) value() string {
+	_, val, _ := bytes.Cut(f.raw, []byte(":"))
+	var parts []string
+	for _, line := range bytes.Split(val, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) != 0 {
+			parts = append(parts, string(line))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// ApplyHeaderEdits returns the message read from r with edits applied to
+// its header, in order, the same way the header tests see them. Untouched
+// fields keep their original bytes and order; the body is not modified.
+//
+// An added field goes at the top of the whole header, before the first
+// original field whatever its name, or at the bottom with :last (RFC 5293,
+// Section 4), so a later addheader lands above an earlier one.
+func ApplyHeaderEdits(r io.Reader, edits []HeaderEdit) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	var (
+		fields []rawField
+		end    []byte // the blank line ending the header, if any
+		eol    = "\r\n"
+	)
+	for {
+		line, n, err := readHeaderLine(br, 0)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		if len(fields) == 0 && !bytes.HasSuffix(line, []byte("\r\n")) && bytes.HasSuffix(line, []byte("\n")) {
+			eol = "\n"
+		}
+		trimmed := bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(trimmed) == 0:
+			end = line
+		case (trimmed[0] == ' ' || trimmed[0] == '\t') && len(fields) > 0:
+			last := &fields[len(fields)-1]
+			last.raw = append(last.raw, line...)
+		default:
+			name, _, _ := bytes.Cut(trimmed, []byte(":"))
+			fields = append(fields, rawField{
+				name: string(bytes.TrimRight(name, " \t")),
+				raw:  line,
+			})
+		}
+		if end != nil || err == io.EOF {
+			break
+		}
+	}
+
+	for _, edit := range edits {
+		fields = applyRawHeaderEdit(fields, edit, eol)
+	}
+
+	var hdr bytes.Buffer
+	for _, f := range fields {
+		hdr.Write(f.raw)
+	}
+	hdr.Write(end)
+	return io.MultiReader(&hdr, br), nil
+}
+
+// applyRawHeaderEdit applies a single edit to fields, following
+// applyHeaderEditsToValues.
+func applyRawHeaderEdit(fields []rawField, edit HeaderEdit, eol string) []rawField {
+	switch edit.Action {
+	case "add":
+		f := rawField{
+			name: edit.FieldName,
+			raw:  []byte(foldHeaderField(edit.FieldName, edit.Value, eol)),
+		}
+		if edit.Last {
+			return append(fields, f)
+		}
+		return append([]rawField{f}, fields...)
+	case "delete":
+		var idx []int
+		for i, f := range fields {
+			if strings.EqualFold(f.name, edit.FieldName) {
+				idx = append(idx, i)
+			}
+		}
+		remove := -1
+		switch {
+		case edit.Index > 0:
+			n := edit.Index - 1
+			if edit.Last {
+				n = len(idx) - edit.Index
+			}
+			if n >= 0 && n < len(idx) {
+				remove = idx[n]
+			}
+		case edit.Value != "":
+			for _, i := range idx {
+				if fields[i].value() == edit.Value {
+					remove = i
+					break
+				}
+			}
+		default:
+			kept := fields[:0:0]
+			for _, f := range fields {
+				if !strings.EqualFold(f.name, edit.FieldName) {
+					kept = append(kept, f)
+				}
+			}
+			return kept
+		}
+		if remove >= 0 {
+			return append(fields[:remove:remove], fields[remove+1:]...)
+		}
+	}
+	return fields
+}
+
+// maxFoldedLine is the length header lines are folded at (RFC 5322, Section
+// 2.1.1).
+const maxFoldedLine = 78
+
+// foldHeaderField formats a header field, folding the value at spaces so
+// lines stay short. Line breaks already in the value are replaced by spaces
+// so that it cannot start another field.
+func foldHeaderField(name, value, eol string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, value)
+
+	var b strings.Builder
+	line := name + ":"
+	for _, word := range strings.Split(value, " ") {
+		// Fold before a word that would make the line too long, unless
+		// the line holds nothing to fold after yet.
+		if word != "" && len(line)+1+len(word) > maxFoldedLine && len(line) > len(name)+1 {
+			b.WriteString(line)
+			b.WriteString(eol)
+			line = ""
+		}
+		line += " " + word
+	}
+	b.WriteString(line)
+	b.WriteString(eol)
+	return b.String()
+}
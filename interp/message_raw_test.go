@@ -0,0 +1,130 @@
+package interp
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// rawMessage is a MessageStatic that also provides its original bytes.
+type rawMessage struct {
+	MessageStatic
+	raw string
+}
+
+func (m rawMessage) RawReader() (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(m.raw)), nil
+}
+
+func TestRawMessage(t *testing.T) {
+	raw := "Received: from a\r\nX-Spam: yes\r\nSubject: folded\r\n subject\r\nX-Spam: maybe\r\n\r\nbody\r\nX-Spam: in body\r\n"
+	msg, err := ReadMessage(strings.NewReader(raw), HeaderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := loadTestScript(t, &Options{}, `require ["editheader", "index"];
+addheader "X-Sieve" "filtered";
+addheader :last "X-Trace" "1";
+deleteheader :index 1 "X-Spam";
+deleteheader "Subject" "folded subject";`)
+	d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, rawMessage{msg, raw})
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, ok, err := d.RawMessage()
+	if err != nil || !ok {
+		t.Fatalf("RawMessage() = %v, %v", ok, err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "X-Sieve: filtered\r\nReceived: from a\r\nX-Spam: maybe\r\nX-Trace: 1\r\n\r\nbody\r\nX-Spam: in body\r\n"
+	if string(got) != want {
+		t.Errorf("RawMessage() = %q, want %q", got, want)
+	}
+
+	d = NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, msg)
+	if _, ok, _ := d.RawMessage(); ok {
+		t.Error("RawMessage() is available for a message without RawReader")
+	}
+}
+
+func TestApplyHeaderEditsOrder(t *testing.T) {
+	raw := "Received: from a\r\nSubject: hi\r\n\r\nbody\r\n"
+	r, err := ApplyHeaderEdits(strings.NewReader(raw), []HeaderEdit{
+		{Action: "add", FieldName: "X-Spam-Flag", Value: "YES"},
+		{Action: "add", FieldName: "X-Spam-Score", Value: "9"},
+		{Action: "add", FieldName: "X-Trace", Value: "1", Last: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "X-Spam-Score: 9\r\nX-Spam-Flag: YES\r\nReceived: from a\r\nSubject: hi\r\nX-Trace: 1\r\n\r\nbody\r\n"
+	if string(got) != want {
+		t.Errorf("ApplyHeaderEdits() = %q, want %q", got, want)
+	}
+}
+
+func TestHeaderRaw(t *testing.T) {
+	raw := "Authentication-Results: mx.example.org;\r\n\tdkim=pass header.d=example.com;\r\n\tspf=pass\r\n\r\nbody\r\n"
+	msg, err := ReadMessage(strings.NewReader(raw), HeaderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The key spans the fold between the first and second line.
+	script := "if header :contains \"Authentication-Results\" \"example.org;\r\n\tdkim=pass\" { keep; } else { discard; }"
+
+	cases := []struct {
+		name string
+		opts *Options
+		msg  Message
+		keep bool
+	}{
+		{"raw", &Options{RawHeaders: []string{"authentication-results"}}, msg, true},
+		{"unfolded", &Options{}, msg, false},
+		{"nil options", nil, msg, false},
+		{"not available", &Options{RawHeaders: []string{"Authentication-Results"}}, MessageStatic{Header: msg.Header}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := loadTestScript(t, c.opts, script)
+			d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, c.msg)
+			if err := s.Execute(context.Background(), d); err != nil {
+				t.Fatal(err)
+			}
+			if d.Keep != c.keep {
+				t.Errorf("Keep = %v, want %v", d.Keep, c.keep)
+			}
+		})
+	}
+}
+
+func TestFoldHeaderField(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	got := foldHeaderField("X-Long", long, "\r\n")
+	for _, line := range strings.SplitAfter(got, "\r\n") {
+		if len(line) > maxFoldedLine+2 {
+			t.Errorf("line longer than %d: %q", maxFoldedLine, line)
+		}
+		if strings.TrimSpace(line) == "" && line != "" {
+			t.Errorf("whitespace-only line in %q", got)
+		}
+	}
+	if unfolded := strings.ReplaceAll(got, "\r\n", ""); unfolded != "X-Long: "+long {
+		t.Errorf("unfolded = %q", unfolded)
+	}
+
+	got = foldHeaderField("X-Test", "x\r\nBcc: attacker@evil.example", "\r\n")
+	if strings.Count(got, "\r\n") != 1 || !strings.HasSuffix(got, "\r\n") {
+		t.Errorf("line break in value not removed: %q", got)
+	}
+}
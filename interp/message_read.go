@@ -0,0 +1,186 @@
+package interp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+)
+
+// HeaderLimits bounds the header section of messages read by ReadMessage.
+// Zero fields mean no limit.
+type HeaderLimits struct {
+	// MaxHeaderCount is the maximum number of header fields.
+	MaxHeaderCount int
+	// MaxHeaderValueLen is the maximum length of a single field value,
+	// continuation lines included.
+	MaxHeaderValueLen int
+	// Truncate makes ReadMessage drop the fields past MaxHeaderCount and cut
+	// values longer than MaxHeaderValueLen instead of failing.
+	Truncate bool
+}
+
+// ErrHeaderLimit is returned by ReadMessage for a message whose header
+// exceeds HeaderLimits.
+var ErrHeaderLimit = errors.New("message header exceeds limits")
+
+// maxHeaderNameLen is the longest field name kept while reading a header
+// line; RFC 5322 limits lines to 998 characters.
+const maxHeaderNameLen = 998
+
+// ReadMessage reads an RFC 5322 message into a MessageStatic. The header is
+// checked against limits while it is read, so a message with a huge number
+// of fields or a huge field value is rejected without being buffered.
+func ReadMessage(r io.Reader, limits HeaderLimits) (MessageStatic, error) {
+	br := bufio.NewReader(r)
+	hdr := textproto.MIMEHeader{}
+	rawHdr := textproto.MIMEHeader{}
+	size := int64(0)
+
+	maxLine := 0
+	if limits.MaxHeaderValueLen > 0 {
+		maxLine = limits.MaxHeaderValueLen + maxHeaderNameLen + 2
+	}
+
+	var (
+		name   string
+		value  []byte
+		raw    []byte // value as it appears, folding included
+		eol    []byte // line ending of the last line of raw
+		fields int
+	)
+	flush := func() error {
+		if name == "" {
+			return nil
+		}
+		defer func() { name, value, raw = "", nil, nil }()
+		fields++
+		if limits.MaxHeaderCount > 0 && fields > limits.MaxHeaderCount {
+			if limits.Truncate {
+				return nil
+			}
+			return fmt.Errorf("%w: more than %d fields", ErrHeaderLimit, limits.MaxHeaderCount)
+		}
+		hdr.Add(name, string(value))
+		rawHdr.Add(name, string(raw))
+		return nil
+	}
+	appendValue := func(part []byte) error {
+		part = bytes.TrimSpace(part)
+		if len(value) != 0 && len(part) != 0 {
+			value = append(value, ' ')
+		}
+		value = append(value, part...)
+		if limits.MaxHeaderValueLen > 0 && len(value) > limits.MaxHeaderValueLen {
+			if !limits.Truncate {
+				return fmt.Errorf("%w: %s value longer than %d bytes", ErrHeaderLimit, name, limits.MaxHeaderValueLen)
+			}
+			value = value[:limits.MaxHeaderValueLen]
+		}
+		return nil
+	}
+	// appendRaw adds a line to raw, keeping the line break that precedes it.
+	appendRaw := func(line []byte, first bool) {
+		if first {
+			line = bytes.TrimLeft(line, " \t")
+		} else {
+			raw = append(raw, eol...)
+		}
+		raw = append(raw, line...)
+		if limits.Truncate && limits.MaxHeaderValueLen > 0 && len(raw) > limits.MaxHeaderValueLen {
+			raw = raw[:limits.MaxHeaderValueLen]
+		}
+	}
+
+	for {
+		line, n, err := readHeaderLine(br, maxLine)
+		size += int64(n)
+		if err != nil && err != io.EOF {
+			return MessageStatic{}, err
+		}
+		if n == 0 && err == io.EOF {
+			// No blank line: the message has a header only.
+			if err := flush(); err != nil {
+				return MessageStatic{}, err
+			}
+			return MessageStatic{Size: size, Header: hdr, RawHeader: rawHdr}, nil
+		}
+
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if len(trimmed) == 0 {
+			if err := flush(); err != nil {
+				return MessageStatic{}, err
+			}
+			break
+		}
+
+		if trimmed[0] == ' ' || trimmed[0] == '\t' {
+			if name == "" {
+				return MessageStatic{}, fmt.Errorf("malformed message header: continuation without a field: %q", trimmed)
+			}
+			if err := appendValue(trimmed); err != nil {
+				return MessageStatic{}, err
+			}
+			appendRaw(trimmed, false)
+		} else {
+			if err := flush(); err != nil {
+				return MessageStatic{}, err
+			}
+			key, val, ok := bytes.Cut(trimmed, []byte(":"))
+			key = bytes.TrimRight(key, " \t")
+			if !ok || len(key) == 0 {
+				return MessageStatic{}, fmt.Errorf("malformed message header line: %q", trimmed)
+			}
+			name = textproto.CanonicalMIMEHeaderKey(string(key))
+			if err := appendValue(val); err != nil {
+				return MessageStatic{}, err
+			}
+			appendRaw(val, true)
+		}
+		eol = line[len(trimmed):]
+
+		if err == io.EOF {
+			if err := flush(); err != nil {
+				return MessageStatic{}, err
+			}
+			return MessageStatic{Size: size, Header: hdr, RawHeader: rawHdr}, nil
+		}
+	}
+
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return MessageStatic{}, err
+	}
+	return MessageStatic{
+		Size:      size + int64(len(body)),
+		Header:    hdr,
+		RawHeader: rawHdr,
+		Body:      body,
+		HasBody:   true,
+	}, nil
+}
+
+// readHeaderLine reads one line, including its line ending, and returns at
+// most max bytes of it (all of it if max is zero) and the full line length.
+// The rest of an over-long line is consumed without being buffered.
+func readHeaderLine(br *bufio.Reader, max int) ([]byte, int, error) {
+	var line []byte
+	n := 0
+	for {
+		chunk, err := br.ReadSlice('\n')
+		n += len(chunk)
+		if max == 0 || len(line) < max {
+			keep := chunk
+			if max != 0 && len(line)+len(keep) > max {
+				keep = keep[:max-len(line)]
+			}
+			line = append(line, keep...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return line, n, err
+	}
+}
@@ -0,0 +1,70 @@
+package interp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadMessage(t *testing.T) {
+	raw := "From: a@example.org\r\nSubject: folded\r\n  subject\r\nX-A: 1\r\nX-A: 2\r\n\r\nbody\r\n"
+	msg, err := ReadMessage(strings.NewReader(raw), HeaderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := msg.HeaderGet("subject"); !reflect.DeepEqual(got, []string{"folded subject"}) {
+		t.Errorf("Subject = %q", got)
+	}
+	if got, _, _ := msg.HeaderGetRaw("subject"); !reflect.DeepEqual(got, []string{"folded\r\n  subject"}) {
+		t.Errorf("raw Subject = %q", got)
+	}
+	if got, _ := msg.HeaderGet("X-A"); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("X-A = %q", got)
+	}
+	if !msg.HasBody || string(msg.Body) != "body\r\n" {
+		t.Errorf("body = %q (%v)", msg.Body, msg.HasBody)
+	}
+	if msg.Size != int64(len(raw)) {
+		t.Errorf("size = %d, want %d", msg.Size, len(raw))
+	}
+
+	msg, err = ReadMessage(strings.NewReader("Subject: no body\n"), HeaderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.HasBody {
+		t.Error("message without a blank line has a body")
+	}
+}
+
+func TestReadMessageLimits(t *testing.T) {
+	many := strings.Repeat("Received: from relay\r\n", 50) + "\r\nbody\r\n"
+	long := "Subject: " + strings.Repeat("x", 5000) + "\r\n\r\nbody\r\n"
+
+	if _, err := ReadMessage(strings.NewReader(many), HeaderLimits{MaxHeaderCount: 10}); !errors.Is(err, ErrHeaderLimit) {
+		t.Errorf("header count: err = %v, want ErrHeaderLimit", err)
+	}
+	if _, err := ReadMessage(strings.NewReader(long), HeaderLimits{MaxHeaderValueLen: 100}); !errors.Is(err, ErrHeaderLimit) {
+		t.Errorf("value length: err = %v, want ErrHeaderLimit", err)
+	}
+
+	msg, err := ReadMessage(strings.NewReader(many), HeaderLimits{MaxHeaderCount: 10, Truncate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := msg.HeaderGet("Received"); len(got) != 10 {
+		t.Errorf("truncated message has %d Received fields, want 10", len(got))
+	}
+	if string(msg.Body) != "body\r\n" {
+		t.Errorf("truncated message body = %q", msg.Body)
+	}
+
+	msg, err = ReadMessage(strings.NewReader(long), HeaderLimits{MaxHeaderValueLen: 100, Truncate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := msg.HeaderGet("Subject"); len(got) != 1 || len(got[0]) != 100 {
+		t.Errorf("truncated Subject = %q", got)
+	}
+}
@@ -26,8 +26,21 @@ type EnvelopeStatic struct {
 	From string
 	To   string
 	Auth string
+
+	// ToList holds all recipients of a message with several, see
+	// EnvelopeRecipients. To is used if it is empty.
+	ToList []string
+
+	// DSN parameters, see EnvelopeDSN. Empty means not given.
+	ORcpt  string
+	Notify string
 }
 
+var (
+	_ EnvelopeDSN        = EnvelopeStatic{}
+	_ EnvelopeRecipients = EnvelopeStatic{}
+)
+
 func (m EnvelopeStatic) EnvelopeFrom() string {
 	return m.From
 }
@@ -36,24 +49,52 @@ func (m EnvelopeStatic) EnvelopeTo() string {
 	return m.To
 }
 
+func (m EnvelopeStatic) EnvelopeToList() []string {
+	if len(m.ToList) == 0 {
+		return []string{m.To}
+	}
+	return m.ToList
+}
+
 func (m EnvelopeStatic) AuthUsername() string {
 	return m.Auth
 }
 
+func (m EnvelopeStatic) OriginalRecipient() (string, bool) {
+	return m.ORcpt, m.ORcpt != ""
+}
+
+func (m EnvelopeStatic) DSNNotify() (string, bool) {
+	return m.Notify, m.Notify != ""
+}
+
 // MessageStatic is a simple Message interface implementation
 // that just keeps all data in memory in a Go struct.
 type MessageStatic struct {
-	Size    int
-	Header  MessageHeader
-	Body    []byte
-	HasBody bool
+	Size   int64
+	Header MessageHeader
+	// RawHeader holds the same fields with their values as they appear in
+	// the message, folding included. It is optional, see MessageHeaderRaw.
+	RawHeader MessageHeader
+	Body      []byte
+	HasBody   bool
 }
 
 func (m MessageStatic) HeaderGet(key string) ([]string, error) {
+	if m.Header == nil {
+		return nil, nil
+	}
 	return m.Header.Values(key), nil
 }
 
-func (m MessageStatic) MessageSize() int {
+func (m MessageStatic) HeaderGetRaw(key string) ([]string, bool, error) {
+	if m.RawHeader == nil {
+		return nil, false, nil
+	}
+	return m.RawHeader.Values(key), true, nil
+}
+
+func (m MessageStatic) MessageSize() int64 {
 	return m.Size
 }
 
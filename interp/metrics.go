@@ -0,0 +1,44 @@
+package interp
+
+import "time"
+
+// ExecutionMetrics describes one run of Script.Execute, see Options.Metrics.
+type ExecutionMetrics struct {
+	// Duration is the wall-clock time Execute took.
+	Duration time.Duration
+	// Tests is the number of tests evaluated, nested ones included.
+	Tests int
+	// RegexMatches is the number of regular expressions run by :regex,
+	// one per key and value compared.
+	RegexMatches int
+	// Err is the error Execute returned, if any.
+	Err error
+}
+
+// MetricsCollector receives the metrics of every script execution, e.g. to
+// export them to a monitoring system. It may be called from several
+// goroutines at once.
+type MetricsCollector interface {
+	ScriptExecuted(m ExecutionMetrics)
+}
+
+// metricsStart is the state of an execution when it started.
+type metricsStart struct {
+	time         time.Time
+	tests, regex int
+}
+
+func (d *RuntimeData) startMetrics() metricsStart {
+	return metricsStart{time.Now(), d.tests, d.regexMatches}
+}
+
+// reportMetrics reports the execution started at start to c. d may have
+// been used before, so only the counts since start are reported.
+func (d *RuntimeData) reportMetrics(c MetricsCollector, start metricsStart, err error) {
+	c.ScriptExecuted(ExecutionMetrics{
+		Duration:     time.Since(start.time),
+		Tests:        d.tests - start.tests,
+		RegexMatches: d.regexMatches - start.regex,
+		Err:          err,
+	})
+}
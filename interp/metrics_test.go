@@ -0,0 +1,47 @@
+package interp
+
+import (
+	"context"
+	"net/textproto"
+	"testing"
+)
+
+type metricsRecorder []ExecutionMetrics
+
+func (r *metricsRecorder) ScriptExecuted(m ExecutionMetrics) {
+	*r = append(*r, m)
+}
+
+func TestMetrics(t *testing.T) {
+	var rec metricsRecorder
+	s := loadTestScript(t, &Options{Metrics: &rec}, `require "regex";
+if anyof (header :is "Subject" "no", header :regex "Subject" "^h.*o$") { keep; }
+if exists "X-Missing" { discard; }
+if header :regex ["Subject", "From"] ["^x", "^y"] { discard; }`)
+
+	hdr := textproto.MIMEHeader{}
+	hdr.Set("Subject", "hello")
+	hdr.Set("From", "sender@example.org")
+	d := testRuntimeData(s, hdr, nil)
+	for i := 0; i < 2; i++ {
+		if err := s.Execute(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(rec) != 2 {
+		t.Fatalf("collector called %d times, want 2", len(rec))
+	}
+	// Both runs report their own counts although d is reused.
+	for _, m := range rec {
+		if m.Tests != 5 {
+			t.Errorf("Tests = %d, want 5", m.Tests)
+		}
+		if m.RegexMatches != 5 {
+			t.Errorf("RegexMatches = %d, want 5", m.RegexMatches)
+		}
+		if m.Err != nil {
+			t.Errorf("Err = %v", m.Err)
+		}
+	}
+}
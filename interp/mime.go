@@ -0,0 +1,242 @@
+package interp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"strings"
+)
+
+// mimeOption selects what a header test with :mime compares (RFC 5703,
+// Section 4.2).
+type mimeOption int
+
+const (
+	mimeValue       mimeOption = iota // the whole field value
+	mimeType                          // :type, the Content-Type type
+	mimeSubtype                       // :subtype, the Content-Type subtype
+	mimeContentType                   // :contenttype, type "/" subtype
+	mimeParam                         // :param, the listed parameters
+)
+
+// mimeTest holds the ":mime" [":anychild"] [option] arguments of the header
+// test and the ":mime" [":anychild"] arguments of the address and exists
+// tests (RFC 5703, Section 4). The foreverypart loop of the same extension
+// is not supported.
+type mimeTest struct {
+	mime     bool
+	anyChild bool
+	option   mimeOption
+	params   []string
+
+	options int
+}
+
+// addPartSpecTags adds :mime and :anychild, the tags the address and exists
+// tests accept.
+func (m *mimeTest) addPartSpecTags(s *Spec) *Spec {
+	if s.Tags == nil {
+		s.Tags = make(map[string]SpecTag, 2)
+	}
+	s.Tags["mime"] = SpecTag{
+		MatchBool: func() { m.mime = true },
+	}
+	s.Tags["anychild"] = SpecTag{
+		MatchBool: func() { m.anyChild = true },
+	}
+	return s
+}
+
+// addSpecTags adds :mime, :anychild and the options of the header test.
+func (m *mimeTest) addSpecTags(s *Spec) *Spec {
+	m.addPartSpecTags(s)
+	for tag, opt := range map[string]mimeOption{
+		"type":        mimeType,
+		"subtype":     mimeSubtype,
+		"contenttype": mimeContentType,
+	} {
+		opt := opt
+		s.Tags[tag] = SpecTag{
+			MatchBool: func() {
+				m.option = opt
+				m.options++
+			},
+		}
+	}
+	s.Tags["param"] = SpecTag{
+		NeedsValue:  true,
+		MinStrCount: 1,
+		MatchStr: func(val []string) {
+			m.option = mimeParam
+			m.params = val
+			m.options++
+		},
+	}
+	return s
+}
+
+// check validates the arguments once the spec is loaded.
+func (m *mimeTest) check(s *Script) error {
+	if !m.mime {
+		if m.anyChild || m.options != 0 {
+			return fmt.Errorf(":anychild, :type, :subtype, :contenttype and :param can only be specified with :mime")
+		}
+		return nil
+	}
+	if !s.RequiresExtension("mime") {
+		return ExtensionRequiredError{Extension: "mime"}
+	}
+	if m.options > 1 {
+		return fmt.Errorf("only one of :type, :subtype, :contenttype and :param can be specified")
+	}
+	return nil
+}
+
+// rawValues returns the raw values of field in the message header and, with
+// :anychild, in the header of every MIME part at any depth.
+func (m mimeTest) rawValues(ctx context.Context, d *RuntimeData, field string) ([]string, error) {
+	raw, err := GetHeaderWithEdits(d, field)
+	if err != nil {
+		return nil, err
+	}
+	if m.anyChild {
+		parts, err := mimePartHeaders(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range parts {
+			raw = append(raw, h.Values(field)...)
+		}
+	}
+	return raw, nil
+}
+
+// values returns the values of field the header test compares with :mime:
+// those rawValues returns, reduced as the option selects and decoded.
+func (m mimeTest) values(ctx context.Context, d *RuntimeData, field string) ([]string, error) {
+	raw, err := m.rawValues(ctx, d, field)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, v := range raw {
+		values = append(values, m.extract(d, field, v)...)
+	}
+	return values, nil
+}
+
+// extract returns the parts of a single field value selected by the option.
+// :type, :subtype and :contenttype only apply to Content-Type; :param
+// applies to any field with parameters, such as Content-Disposition.
+func (m mimeTest) extract(d *RuntimeData, field, value string) []string {
+	value = unfoldHeaderValue(value)
+	switch m.option {
+	case mimeType, mimeSubtype, mimeContentType:
+		if !strings.EqualFold(field, "Content-Type") {
+			return nil
+		}
+		mediaType, _, err := mime.ParseMediaType(value)
+		if err != nil {
+			mediaType = strings.ToLower(strings.TrimSpace(strings.Split(value, ";")[0]))
+		}
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		switch m.option {
+		case mimeType:
+			return []string{typ}
+		case mimeSubtype:
+			return []string{subtype}
+		}
+		return []string{mediaType}
+	case mimeParam:
+		// ParseMediaType also joins and decodes RFC 2231 parameter values;
+		// RFC 2047 encoded-words are decoded afterwards, as clients still
+		// use them for file names.
+		_, params, err := mime.ParseMediaType(value)
+		if err != nil {
+			return nil
+		}
+		var values []string
+		for _, name := range m.params {
+			if v, ok := params[strings.ToLower(expandVars(d, name))]; ok {
+				values = append(values, d.Script.headerCompareValue(v))
+			}
+		}
+		return values
+	}
+	return []string{d.Script.headerCompareValue(value)}
+}
+
+// mimePartHeaders returns the headers of the MIME parts of the message, at
+// any depth, in the order they appear. Only multipart bodies are descended
+// into; like the body test it bounds the work with Options.MaxMimeParts and
+// maxMimeDepth.
+func mimePartHeaders(ctx context.Context, d *RuntimeData) ([]textproto.MIMEHeader, error) {
+	body, hasBody, err := d.Msg.BodyRaw()
+	if err != nil || !hasBody {
+		return nil, err
+	}
+	contentType := ""
+	if vals, err := GetHeaderWithEdits(d, "Content-Type"); err != nil {
+		return nil, err
+	} else if len(vals) > 0 {
+		contentType = vals[0]
+	}
+
+	var headers []textproto.MIMEHeader
+	var walk func(contentType string, b []byte, depth int) error
+	walk = func(contentType string, b []byte, depth int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+			return nil
+		}
+		if depth > maxMimeDepth {
+			return fmt.Errorf("header: MIME parts are nested more than %d levels deep", maxMimeDepth)
+		}
+
+		for _, p := range splitMultipart(b, params["boundary"])[1:] {
+			if bytes.HasPrefix(p, []byte("--")) {
+				break
+			}
+			p = bytes.TrimPrefix(p, []byte("\r"))
+			p = bytes.TrimPrefix(p, []byte("\n"))
+
+			r := textproto.NewReader(bufio.NewReader(bytes.NewReader(p)))
+			h, err := r.ReadMIMEHeader()
+			if err != nil && err != io.EOF {
+				continue
+			}
+			headers = append(headers, h)
+			if max := d.Script.opts.MaxMimeParts; max > 0 && len(headers) > max {
+				return fmt.Errorf("header: message has more than %d MIME parts", max)
+			}
+			if err := walk(h.Get("Content-Type"), partBody(p), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(contentType, body, 0); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// partBody returns the body of a MIME part: what follows the first blank
+// line, or nil if the part has only a header.
+func partBody(p []byte) []byte {
+	if idx := bytes.Index(p, []byte("\r\n\r\n")); idx != -1 {
+		return p[idx+4:]
+	}
+	if idx := bytes.Index(p, []byte("\n\n")); idx != -1 {
+		return p[idx+2:]
+	}
+	return nil
+}
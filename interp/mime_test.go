@@ -0,0 +1,109 @@
+package interp
+
+import (
+	"testing"
+)
+
+const mimeTestBody = "--outer\r\n" +
+	"Content-Type: text/plain; charset=us-ascii\r\n" +
+	"\r\n" +
+	"See attached.\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"inner\"\r\n" +
+	"X-Original-To: Bob <bob@example.net>\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: application/octet-stream; name=\"invoice.exe\"\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.exe\"\r\n" +
+	"\r\n" +
+	"TVqQAAMAAAAEAAAA\r\n" +
+	"--inner\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment;\r\n" +
+	" filename*=UTF-8''r%C3%A9sum%C3%A9.pdf\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--inner--\r\n" +
+	"--outer--\r\n"
+
+func TestHeaderMime(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		test  string
+		match bool
+	}{
+		{"attachment-filename", `header :mime :anychild :param "filename" :matches "Content-Disposition" "*.exe"`, true},
+		{"other-extension", `header :mime :anychild :param "filename" :matches "Content-Disposition" "*.zip"`, false},
+		{"without-anychild", `header :mime :param "filename" :matches "Content-Disposition" "*.exe"`, false},
+		{"param-name-case", `header :mime :anychild :param "FileName" :matches "Content-Disposition" "*.EXE"`, true},
+		{"rfc2231-filename", `header :mime :anychild :param "filename" :is "Content-Disposition" "résumé.pdf"`, true},
+		{"content-type-name", `header :mime :anychild :param ["filename", "name"] :matches "Content-Type" "*.exe"`, true},
+		{"type", `header :mime :type "Content-Type" "multipart"`, true},
+		{"subtype", `header :mime :anychild :subtype "Content-Type" "pdf"`, true},
+		{"contenttype", `header :mime :anychild :contenttype "Content-Type" "application/octet-stream"`, true},
+		{"contenttype-other-field", `header :mime :anychild :contenttype :matches "Content-Disposition" "*"`, false},
+		{"whole-value", `header :mime :anychild :contains "Content-Disposition" "invoice.exe"`, true},
+		{"count", `header :mime :anychild :count "eq" "Content-Disposition" "2"`, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := runMimeTest(t, tc.test); got != tc.match {
+				t.Errorf("match = %v, want %v", got, tc.match)
+			}
+		})
+	}
+}
+
+func TestAddressExistsMime(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		test  string
+		match bool
+	}{
+		{"address-anychild", `address :mime :anychild :domain "X-Original-To" "example.net"`, true},
+		{"address-without-anychild", `address :mime :domain "X-Original-To" "example.net"`, false},
+		{"address-without-mime", `address :domain "X-Original-To" "example.net"`, false},
+		{"address-anychild-count", `address :mime :anychild :count "eq" "X-Original-To" "1"`, true},
+		{"exists-anychild", `exists :mime :anychild "Content-Disposition"`, true},
+		{"exists-anychild-all-fields", `exists :mime :anychild ["Content-Type", "Content-Disposition"]`, true},
+		{"exists-anychild-missing", `exists :mime :anychild ["Content-Disposition", "X-Missing"]`, false},
+		{"exists-without-anychild", `exists :mime "Content-Disposition"`, false},
+		{"exists-top-level", `exists :mime "Content-Type"`, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := runMimeTest(t, tc.test); got != tc.match {
+				t.Errorf("match = %v, want %v", got, tc.match)
+			}
+		})
+	}
+}
+
+func TestLoadAddressExistsMime(t *testing.T) {
+	for _, in := range []string{
+		`address :anychild "To" "x"`,
+		`address :mime :type "To" "x"`,
+		`exists :anychild "To"`,
+		`exists :mime :param "filename" "Content-Disposition"`,
+	} {
+		if _, err := loadTestScriptErr(t, &Options{}, []string{"mime"}, `require "mime"; if `+in+` { keep; }`); err == nil {
+			t.Errorf("%s: expected a load error", in)
+		}
+	}
+	for _, in := range []string{
+		`address :mime "To" "x"`,
+		`exists :mime "To"`,
+	} {
+		if _, err := loadTestScriptErr(t, &Options{}, []string{"mime"}, `if `+in+` { keep; }`); err == nil {
+			t.Errorf("%s: expected a load error without require \"mime\"", in)
+		}
+	}
+}
+
+// runMimeTest reports whether test matches the message of mimeTestBody.
+func runMimeTest(t *testing.T, test string) bool {
+	t.Helper()
+	d, err := runBodyScript(t, &Options{}, `require ["mime", "relational"]; if `+test+` { discard; }`, `multipart/mixed; boundary="outer"`, mimeTestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return !d.ImplicitKeep
+}
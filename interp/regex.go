@@ -83,6 +83,7 @@ type findSubmatchFunc func(value string) []string
 type SafeRegexMatcher struct {
 	find    findSubmatchFunc
 	pattern string
+	names   []string
 	limits  RegexLimits
 }
 
@@ -99,7 +100,7 @@ func CompileSafeRegex(pattern string, limits RegexLimits) (*SafeRegexMatcher, er
 	if err != nil {
 		return nil, fmt.Errorf("regex compile error: %w", err)
 	}
-	return &SafeRegexMatcher{find: re.FindStringSubmatch, pattern: pattern, limits: limits}, nil
+	return &SafeRegexMatcher{find: re.FindStringSubmatch, pattern: pattern, names: re.SubexpNames(), limits: limits}, nil
 }
 
 // compileSafeBinaryRegex compiles a pattern with the binaryregexp engine
@@ -113,7 +114,7 @@ func compileSafeBinaryRegex(pattern string, limits RegexLimits) (*SafeRegexMatch
 	if err != nil {
 		return nil, fmt.Errorf("regex compile error: %w", err)
 	}
-	return &SafeRegexMatcher{find: re.FindStringSubmatch, pattern: pattern, limits: limits}, nil
+	return &SafeRegexMatcher{find: re.FindStringSubmatch, pattern: pattern, names: re.SubexpNames(), limits: limits}, nil
 }
 
 // FindSubmatch runs the matcher against input with input truncation and a
@@ -180,6 +181,12 @@ func (m *SafeRegexMatcher) FindSubmatch(ctx context.Context, input string) ([]st
 	}
 }
 
+// SubexpNames returns the names of the parenthesized subexpressions of the
+// pattern, as regexp.Regexp.SubexpNames does.
+func (m *SafeRegexMatcher) SubexpNames() []string {
+	return m.names
+}
+
 // Match reports whether input matches, applying the same bounds as
 // FindSubmatch.
 func (m *SafeRegexMatcher) Match(ctx context.Context, input string) (bool, error) {
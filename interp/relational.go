@@ -11,6 +11,9 @@ const (
 	RelNotEqual       Relational = "ne"
 )
 
+// CompareString compares lhs and rhs octet by octet, which is the i;octet
+// ordering (RFC 4790, Section 9.3). Callers fold the case of both strings
+// first for i;ascii-casemap.
 func (r Relational) CompareString(lhs, rhs string) bool {
 	switch r {
 	case RelGreaterThan:
@@ -19,6 +19,34 @@ type Envelope interface {
 	AuthUsername() string
 }
 
+// EnvelopeDSN is optionally implemented by an Envelope that carries the
+// RFC 3461 DSN parameters of the recipient. They are exposed to scripts as
+// the "orcpt" and "notify" envelope-parts of the envelope-dsn extension
+// (RFC 6009). The boolean is false if the parameter was not given; the part
+// then matches nothing.
+type EnvelopeDSN interface {
+	// OriginalRecipient returns the address from the ORCPT parameter,
+	// without the addr-type prefix.
+	OriginalRecipient() (string, bool)
+	// DSNNotify returns the NOTIFY parameter, e.g. "SUCCESS,FAILURE".
+	DSNNotify() (string, bool)
+}
+
+// EnvelopeRecipients is optionally implemented by an Envelope of a message
+// with several RCPT TO recipients. The "to" envelope-part then tests each of
+// them; EnvelopeTo is used otherwise.
+type EnvelopeRecipients interface {
+	EnvelopeToList() []string
+}
+
+// envelopeTo returns the envelope recipients of env.
+func envelopeTo(env Envelope) []string {
+	if rcpts, ok := env.(EnvelopeRecipients); ok {
+		return rcpts.EnvelopeToList()
+	}
+	return []string{env.EnvelopeTo()}
+}
+
 type Message interface {
 	/*
 		HeaderGet returns the header field value.
@@ -35,9 +63,15 @@ type Message interface {
 		      syntax) or processed according to local conventions.  An encoded
 		      NUL octet (character zero) SHOULD NOT cause early termination of
 		      the header content being compared against.
+
+		A field that is not present has no values: HeaderGet returns an
+		empty slice and a nil error, and tests on the field are false.
+		An error is reserved for failures to read the message, e.g. I/O
+		errors, and ends the script. HeaderGet is only called with valid
+		field names.
 	*/
 	HeaderGet(key string) ([]string, error)
-	MessageSize() int
+	MessageSize() int64
 	BodyRaw() ([]byte, bool, error)
 }
 
@@ -50,6 +84,13 @@ type RuntimeData struct {
 	Namespace fs.FS
 
 	ifResult bool
+	steps    int // commands and tests evaluated, see Options.MaxExecutionSteps
+
+	// Counts for Options.Metrics.
+	tests        int
+	regexMatches int
+
+	mailboxExists map[string]bool // MailboxChecker results, see checkMailbox
 
 	RedirectAddr    []string
 	Mailboxes       []string
@@ -58,6 +99,20 @@ type RuntimeData struct {
 	Keep            bool
 	ImplicitKeep    bool
 
+	// KeepFlags holds the flags the explicit keep stores the message
+	// with: those given with :flags, or else the current flags, merged
+	// over every keep. Flags holds those of the implicit keep.
+	KeepFlags []string
+
+	// MailboxFlags holds the flags each fileinto stores the message with,
+	// given with :flags or else the current flags, keyed by mailbox. It is
+	// only set for scripts that require imap4flags (RFC 5232, Section 5).
+	MailboxFlags map[string][]string
+
+	// OnAction, if set, is called for every keep, fileinto, redirect,
+	// discard and vacation action as it is executed.
+	OnAction func(Action)
+
 	FlagAliases map[string]string
 
 	MatchVariables []string
@@ -68,36 +123,77 @@ type RuntimeData struct {
 
 	// Vacation extension state
 	VacationResponses map[string]VacationResponse
+	// VacationSuppressed is set when a vacation command was executed but
+	// did not produce a response.
+	VacationSuppressed VacationSuppression
 
 	// vnd.dovecot.testsuit state
-	testName        string
-	testFailMessage string // if set - test failed.
-	testFailAt      lexer.Position
-	testScript      *Script // script loaded using test_script_compile
-	testMaxNesting  int     // max nesting for scripts loaded using test_script_compile
+	testName         string
+	testFailMessage  string // if set - test failed.
+	testFailAt       lexer.Position
+	testScript       *Script                  // script loaded using test_script_compile
+	testResult       []testAction             // actions performed by test_script_run
+	testImplicitKeep *testMessage             // message test_script_run kept implicitly
+	testMailboxes    map[string][]testMessage // messages stored by test_result_execute
+	testSMTP         []testMessage            // messages sent by test_result_execute
+	testMaxNesting   int                      // max nesting for scripts loaded using test_script_compile
 }
 
+// Copy returns a deep copy of d: all slices and maps are duplicated, so the
+// copy can be executed against without affecting d. Policy, Envelope, Msg,
+// Script and Namespace are shared.
 func (d *RuntimeData) Copy() *RuntimeData {
 	newData := &RuntimeData{
-		Policy:          d.Policy,
-		Envelope:        d.Envelope,
-		Msg:             d.Msg,
-		Script:          d.Script,
-		Namespace:       d.Namespace,
-		RedirectAddr:    make([]string, len(d.RedirectAddr)),
-		Mailboxes:       make([]string, len(d.Mailboxes)),
-		MailboxesCreate: make([]string, len(d.MailboxesCreate)),
-		Flags:           make([]string, len(d.Flags)),
-		Keep:            d.Keep,
-		ImplicitKeep:    d.ImplicitKeep,
-		FlagAliases:     make(map[string]string, len(d.FlagAliases)),
-		MatchVariables:  make([]string, len(d.MatchVariables)),
-		Variables:       make(map[string]string, len(d.Variables)),
-		testName:        d.testName,
-		testFailMessage: d.testFailMessage,
-		testFailAt:      d.testFailAt,
-		testScript:      d.testScript,
-		testMaxNesting:  d.testMaxNesting,
+		Policy:             d.Policy,
+		Envelope:           d.Envelope,
+		Msg:                d.Msg,
+		Script:             d.Script,
+		Namespace:          d.Namespace,
+		ifResult:           d.ifResult,
+		steps:              d.steps,
+		tests:              d.tests,
+		regexMatches:       d.regexMatches,
+		RedirectAddr:       copyStrings(d.RedirectAddr),
+		Mailboxes:          copyStrings(d.Mailboxes),
+		MailboxesCreate:    copyStrings(d.MailboxesCreate),
+		Flags:              copyStrings(d.Flags),
+		KeepFlags:          copyStrings(d.KeepFlags),
+		Keep:               d.Keep,
+		ImplicitKeep:       d.ImplicitKeep,
+		OnAction:           d.OnAction,
+		FlagAliases:        copyStringMap(d.FlagAliases),
+		MatchVariables:     copyStrings(d.MatchVariables),
+		Variables:          copyStringMap(d.Variables),
+		VacationSuppressed: d.VacationSuppressed,
+		testName:           d.testName,
+		testFailMessage:    d.testFailMessage,
+		testFailAt:         d.testFailAt,
+		testScript:         d.testScript,
+		testResult:         append([]testAction(nil), d.testResult...),
+		testImplicitKeep:   d.testImplicitKeep,
+		testSMTP:           append([]testMessage(nil), d.testSMTP...),
+		testMaxNesting:     d.testMaxNesting,
+	}
+
+	if d.mailboxExists != nil {
+		newData.mailboxExists = make(map[string]bool, len(d.mailboxExists))
+		for k, v := range d.mailboxExists {
+			newData.mailboxExists[k] = v
+		}
+	}
+
+	if d.testMailboxes != nil {
+		newData.testMailboxes = make(map[string][]testMessage, len(d.testMailboxes))
+		for k, v := range d.testMailboxes {
+			newData.testMailboxes[k] = append([]testMessage(nil), v...)
+		}
+	}
+
+	if d.MailboxFlags != nil {
+		newData.MailboxFlags = make(map[string][]string, len(d.MailboxFlags))
+		for k, v := range d.MailboxFlags {
+			newData.MailboxFlags[k] = copyStrings(v)
+		}
 	}
 
 	// Copy vacation responses if they exist
@@ -114,20 +210,42 @@ func (d *RuntimeData) Copy() *RuntimeData {
 		copy(newData.HeaderEdits, d.HeaderEdits)
 	}
 
-	copy(newData.RedirectAddr, d.RedirectAddr)
-	copy(newData.Mailboxes, d.Mailboxes)
-	copy(newData.MailboxesCreate, d.MailboxesCreate)
-	copy(newData.Flags, d.Flags)
-	copy(newData.MatchVariables, d.MatchVariables)
+	return newData
+}
 
-	for k, v := range d.FlagAliases {
-		newData.FlagAliases[k] = v
+// copyStrings duplicates a slice, preserving nil.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
 	}
-	for k, v := range d.Variables {
-		newData.Variables[k] = v
+	c := make([]string, len(s))
+	copy(c, s)
+	return c
+}
+
+// copyStringMap duplicates a map, preserving nil.
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
 	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
 
-	return newData
+// step counts one command or test evaluation and fails once
+// Options.MaxExecutionSteps is exceeded.
+func (d *RuntimeData) step() error {
+	d.steps++
+	if d.Script == nil || d.Script.opts.MaxExecutionSteps <= 0 {
+		return nil
+	}
+	if d.steps > d.Script.opts.MaxExecutionSteps {
+		return fmt.Errorf("%w (%d)", ErrStepLimit, d.Script.opts.MaxExecutionSteps)
+	}
+	return nil
 }
 
 func (d *RuntimeData) MatchVariable(i int) string {
@@ -169,21 +287,24 @@ func (d *RuntimeData) Var(name string) (string, error) {
 	}
 }
 
+// truncateUTF8 cuts value to at most max bytes. If this truncates an
+// otherwise valid Unicode character, the character is removed altogether.
+func truncateUTF8(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	until := max
+	for until > 0 && value[until] >= 128 && value[until] < 192 /* second or further octet of UTF-8 encoding */ {
+		until--
+	}
+	return value[:until]
+}
+
 func (d *RuntimeData) SetVar(name, value string) error {
 	if len(name) > d.Script.opts.MaxVariableNameLen {
 		return fmt.Errorf("attempting to use a too long variable name: %v", name)
 	}
-	if len(value) > d.Script.opts.MaxVariableLen {
-		until := d.Script.opts.MaxVariableLen
-		// If this truncated an otherwise valid Unicode character,
-		// remove the character altogether.
-		for until > 0 && value[until] >= 128 && value[until] < 192 /* second or further octet of UTF-8 encoding */ {
-			until--
-		}
-
-		value = value[:until]
-
-	}
+	value = truncateUTF8(value, d.Script.opts.MaxVariableLen)
 
 	namespace, name, ok := strings.Cut(strings.ToLower(name), ".")
 	if !ok {
@@ -204,7 +325,7 @@ func (d *RuntimeData) SetVar(name, value string) error {
 }
 
 func NewRuntimeData(s *Script, p PolicyReader, e Envelope, m Message) *RuntimeData {
-	return &RuntimeData{
+	d := &RuntimeData{
 		Script:       s,
 		Policy:       p,
 		Envelope:     e,
@@ -213,4 +334,9 @@ func NewRuntimeData(s *Script, p PolicyReader, e Envelope, m Message) *RuntimeDa
 		FlagAliases:  make(map[string]string),
 		Variables:    map[string]string{},
 	}
+	if s != nil {
+		d.Namespace = s.opts.Namespace
+		d.ImplicitKeep = !s.opts.DisableImplicitKeep
+	}
+	return d
 }
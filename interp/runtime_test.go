@@ -0,0 +1,120 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"reflect"
+	"testing"
+)
+
+func TestRuntimeDataCopy(t *testing.T) {
+	newData := func() *RuntimeData {
+		return &RuntimeData{
+			Policy:            DummyPolicy{},
+			Envelope:          EnvelopeStatic{From: "from@example.org"},
+			Msg:               MessageStatic{Size: 10},
+			ifResult:          true,
+			RedirectAddr:      []string{"a@example.org"},
+			Mailboxes:         []string{"INBOX"},
+			MailboxesCreate:   []string{"New"},
+			mailboxExists:     map[string]bool{"INBOX": true},
+			MailboxFlags:      map[string][]string{"INBOX": {"\\seen"}},
+			Flags:             []string{"\\seen"},
+			Keep:              true,
+			ImplicitKeep:      true,
+			FlagAliases:       map[string]string{"seen": "\\seen"},
+			MatchVariables:    []string{"full", "1"},
+			Variables:         map[string]string{"a": "b"},
+			HeaderEdits:       []HeaderEdit{{Action: "add", FieldName: "X-A", Value: "1"}},
+			VacationResponses: map[string]VacationResponse{"s@example.org": {Subject: "Away"}},
+			testName:          "name",
+			testFailMessage:   "failed",
+		}
+	}
+
+	orig := newData()
+	cpy := orig.Copy()
+	if !reflect.DeepEqual(orig, cpy) {
+		t.Fatalf("copy differs from the original:\n%+v\n%+v", orig, cpy)
+	}
+
+	cpy.RedirectAddr[0] = "changed"
+	cpy.RedirectAddr = append(cpy.RedirectAddr, "more")
+	cpy.Mailboxes[0] = "changed"
+	cpy.MailboxesCreate[0] = "changed"
+	cpy.mailboxExists["INBOX"] = false
+	cpy.MailboxFlags["INBOX"][0] = "changed"
+	cpy.Flags[0] = "changed"
+	cpy.FlagAliases["seen"] = "changed"
+	cpy.FlagAliases["new"] = "changed"
+	cpy.MatchVariables[0] = "changed"
+	cpy.Variables["a"] = "changed"
+	cpy.Variables["new"] = "changed"
+	cpy.HeaderEdits[0].Value = "changed"
+	cpy.VacationResponses["s@example.org"] = VacationResponse{Subject: "changed"}
+	cpy.VacationResponses["new@example.org"] = VacationResponse{}
+	cpy.Keep = false
+	cpy.ImplicitKeep = false
+	cpy.ifResult = false
+
+	if !reflect.DeepEqual(orig, newData()) {
+		t.Fatalf("mutating the copy changed the original:\n%+v", orig)
+	}
+
+	// nil containers stay nil.
+	empty := (&RuntimeData{}).Copy()
+	if empty.RedirectAddr != nil || empty.Flags != nil || empty.Variables != nil ||
+		empty.HeaderEdits != nil || empty.VacationResponses != nil {
+		t.Errorf("copy of empty RuntimeData has non-nil containers: %+v", empty)
+	}
+}
+
+// strictMessage fails HeaderGet for names that are not valid field names,
+// as a host backed by a protocol such as IMAP may, and for X-Broken.
+type strictMessage struct {
+	MessageStatic
+}
+
+func (m strictMessage) HeaderGet(key string) ([]string, error) {
+	if key == "X-Broken" {
+		return nil, errors.New("read error")
+	}
+	if !isValidHeaderName(key) {
+		return nil, fmt.Errorf("invalid field name %q", key)
+	}
+	return m.MessageStatic.HeaderGet(key)
+}
+
+func TestHeaderAbsent(t *testing.T) {
+	msg := strictMessage{MessageStatic{Header: textproto.MIMEHeader{"Subject": {"hello"}}}}
+	for _, tc := range []struct {
+		name   string
+		script string
+	}{
+		{"absent", `if header :contains "X-Absent" "" { keep; }`},
+		{"absent-not", `if not header :contains "X-Absent" "" { } else { keep; }`},
+		{"empty-name", `require "variables"; set "field" ""; if header :is "${field}" "" { keep; }`},
+		{"invalid-name", `require "variables"; set "field" "Sub ject"; if header :is "${field}" "hello" { keep; }`},
+		{"exists-empty-name", `require "variables"; set "field" ""; if exists "${field}" { keep; }`},
+		{"date-empty-name", `require ["date", "variables"]; set "field" ""; if date :is "${field}" "year" "2020" { keep; }`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := loadTestScript(t, &Options{MaxVariableNameLen: 32, MaxVariableLen: 4000}, tc.script)
+			d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, msg)
+			if err := s.Execute(context.Background(), d); err != nil {
+				t.Fatal(err)
+			}
+			if d.Keep {
+				t.Error("test on a missing header matched")
+			}
+		})
+	}
+
+	s := loadTestScript(t, &Options{}, `if header :contains "X-Broken" "" { keep; }`)
+	d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, msg)
+	if err := s.Execute(context.Background(), d); err == nil {
+		t.Error("a HeaderGet error did not end the script")
+	}
+}
@@ -3,10 +3,14 @@ package interp
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io/fs"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/migadu/go-sieve/lexer"
+	"github.com/migadu/go-sieve/parser"
 )
 
 type Cmd interface {
@@ -16,10 +20,25 @@ type Cmd interface {
 type Options struct {
 	MaxRedirects int
 
+	// MaxExecutionSteps limits the number of commands and tests a single
+	// execution evaluates. A script that needs more fails with
+	// ErrStepLimit. Zero means no limit.
+	MaxExecutionSteps int
+
+	// MaxComplexityScore makes LoadScript reject a script whose
+	// Script.ComplexityScore is higher with ErrComplexityLimit. Zero means
+	// no limit.
+	MaxComplexityScore int
+
 	MaxVariableCount   int
 	MaxVariableNameLen int
 	MaxVariableLen     int
 
+	// ListSeparator separates the items of a list held in a single
+	// variable value, as counted by the "string" test with :count. Empty
+	// means ",".
+	ListSeparator string
+
 	// RegexLimits bounds :matches and :regex execution: per-match input truncation
 	// (MaxInputLength) and the soft execution wait (MaxExecTime), applied to every
 	// match this script runs. Zero-valued fields fall back to DefaultRegexLimits, so a
@@ -29,6 +48,105 @@ type Options struct {
 	// script budget.
 	RegexLimits RegexLimits
 
+	// MaxMimeParts limits the number of MIME parts, at any nesting depth,
+	// the body test walks through. A message with more parts fails the
+	// script. Zero means no limit.
+	MaxMimeParts int
+
+	// MaxBodyScan limits how many bytes of the undecoded body "body :raw"
+	// searches. Text past the limit never matches. Zero means no limit.
+	MaxBodyScan int
+
+	// HeaderLimits bounds the header of messages the script reads itself,
+	// such as those set by the testsuite. Hosts should read messages with
+	// ReadMessage and the same limits.
+	HeaderLimits HeaderLimits
+
+	// AddressLiteralFallback makes the address test compare a header value
+	// that cannot be parsed as an address list literally under :all, as
+	// Dovecot does. By default malformed addresses match nothing.
+	AddressLiteralFallback bool
+
+	// AddressHeaders lists additional header fields, e.g.
+	// "X-Original-Sender", that hold addresses and can be used with the
+	// address test. Names are case-insensitive.
+	AddressHeaders []string
+
+	// RawHeaders lists header fields, e.g. "DKIM-Signature", that the
+	// header test compares as they appear in the message, folding line
+	// breaks included and without decoding encoded-words. It only applies
+	// to messages implementing MessageHeaderRaw. Names are
+	// case-insensitive.
+	RawHeaders []string
+
+	// Text controls how header text is decoded and how values are
+	// normalized before they are compared.
+	Text TextPolicy
+
+	// StrictAddressHeaders makes the address test fail the script for a
+	// header field that does not hold addresses. By default such a field
+	// never matches.
+	StrictAddressHeaders bool
+
+	// DefaultComparator is the comparator used by tests without a
+	// :comparator argument, e.g. ComparatorOctet to match an older server.
+	// Empty means DefaultComparator, i;ascii-casemap (RFC 5228, Section
+	// 2.7.3).
+	DefaultComparator Comparator
+
+	// CaseInsensitiveDomains makes :domain comparisons in the address and
+	// envelope tests ignore ASCII case even under the i;octet comparator,
+	// since domain names are case-insensitive. By default the comparator
+	// applies as is.
+	CaseInsensitiveDomains bool
+
+	// Clock returns the current time for the currentdate test. Nil means
+	// time.Now.
+	Clock func() time.Time
+
+	// Location is the time zone the date and currentdate tests use when
+	// neither :zone nor :originalzone is given. Nil means time.Local.
+	Location *time.Location
+
+	// ISOWeekday makes the "weekday" date-part use ISO 8601 numbering,
+	// Monday=1 to Sunday=7, instead of RFC 5260's Sunday=0 to Saturday=6.
+	ISOWeekday bool
+
+	// CaseSensitiveLocalParts makes vacation compare the local-parts of
+	// the sender and the user's own addresses exactly. By default they
+	// are compared ignoring case, as most mail systems treat them.
+	CaseSensitiveLocalParts bool
+
+	// RewriteRedirectSender records that redirected messages should be sent
+	// with a rewritten envelope sender, e.g. using SRS, in
+	// Action.RewriteSender. go-sieve does not rewrite anything itself. By
+	// default the original envelope sender is kept.
+	RewriteRedirectSender bool
+
+	// DisableImplicitKeep makes NewRuntimeData start with ImplicitKeep
+	// unset, for hosts that apply their own default delivery: a script
+	// that takes no action then delivers nothing. By default the implicit
+	// keep applies (RFC 5228, Section 2.10.2).
+	DisableImplicitKeep bool
+
+	// DropInvalidFlags makes setflag, addflag, keep :flags and fileinto
+	// :flags silently drop flags that are not valid IMAP flags, as Dovecot
+	// does. By default an invalid flag fails the script.
+	DropInvalidFlags bool
+
+	// Metrics, if set, receives the duration and the test and regex counts
+	// of every execution.
+	Metrics MetricsCollector
+
+	// DebugLog receives the variable-expanded messages of the debug_log
+	// command (vnd.dovecot.debug). If nil, debug_log does nothing.
+	DebugLog func(msg string)
+
+	// Namespace holds the files the script can refer to (e.g. scripts
+	// compiled by test_script_compile). NewRuntimeData uses it as the
+	// default RuntimeData.Namespace.
+	Namespace fs.FS
+
 	// If specified - enables vnd.dovecot.testsuite extension
 	// and will execute tests.
 	T             *testing.T
@@ -39,12 +157,38 @@ type Script struct {
 	extensions        map[string]struct{}
 	cmd               []Cmd
 	enabledExtensions []string
+	warnings          []Warning
 
 	opts *Options
 }
 
 var ErrStop = errors.New("interpreter: stop called")
 
+// ErrStepLimit is returned when an execution exceeds
+// Options.MaxExecutionSteps.
+var ErrStepLimit = errors.New("interpreter: execution step limit exceeded")
+
+// ErrComplexityLimit is returned when a script exceeds
+// Options.MaxComplexityScore.
+var ErrComplexityLimit = errors.New("interpreter: script complexity limit exceeded")
+
+// executeCmd runs c, counting it against the step limit.
+func executeCmd(ctx context.Context, d *RuntimeData, c Cmd) error {
+	if err := d.step(); err != nil {
+		return err
+	}
+	return c.Execute(ctx, d)
+}
+
+// checkTest evaluates t, counting it against the step limit.
+func checkTest(ctx context.Context, d *RuntimeData, t Test) (bool, error) {
+	if err := d.step(); err != nil {
+		return false, err
+	}
+	d.tests++
+	return t.Check(ctx, d)
+}
+
 func (s Script) Extensions() []string {
 	exts := make([]string, 0, len(s.extensions))
 	for ext := range s.extensions {
@@ -58,6 +202,21 @@ func (s Script) RequiresExtension(name string) bool {
 	return ok
 }
 
+// ExtensionRequiredError is returned when a script uses a command, test or
+// tag of an extension it does not require.
+type ExtensionRequiredError struct {
+	Extension string
+}
+
+func (e ExtensionRequiredError) Error() string {
+	return fmt.Sprintf("missing require '%s'", e.Extension)
+}
+
+// requireError returns an ExtensionRequiredError for ext at pos.
+func requireError(pos lexer.Position, ext string) error {
+	return parser.ErrorAt(pos, "%w", ExtensionRequiredError{Extension: ext})
+}
+
 func (s *Script) IsVarUsable(variableName string) (settable, gettable bool) {
 	if len(variableName) > s.opts.MaxVariableNameLen {
 		return false, false
@@ -86,14 +245,20 @@ func (s *Script) IsVarUsable(variableName string) (settable, gettable bool) {
 	}
 }
 
-func (s Script) Execute(ctx context.Context, d *RuntimeData) error {
+func (s Script) Execute(ctx context.Context, d *RuntimeData) (err error) {
+	if s.opts.Metrics != nil {
+		start := d.startMetrics()
+		defer func() { d.reportMetrics(s.opts.Metrics, start, err) }()
+	}
 	// Install the script's effective regex limits so per-match input truncation and the
 	// soft execution wait are configurable per execution (see ContextWithRegexLimits).
-	if s.opts != nil {
-		ctx = ContextWithRegexLimits(ctx, EffectiveRegexLimits(s.opts.RegexLimits))
-	}
+	ctx = ContextWithRegexLimits(ctx, EffectiveRegexLimits(s.opts.RegexLimits))
+	// The step limit and the MailboxChecker answers apply to one execution,
+	// also when d is executed again.
+	d.steps = 0
+	d.mailboxExists = nil
 	for _, c := range s.cmd {
-		if err := c.Execute(ctx, d); err != nil {
+		if err := executeCmd(ctx, d, c); err != nil {
 			if errors.Is(err, ErrStop) {
 				return nil
 			}
@@ -0,0 +1,83 @@
+package interp
+
+import (
+	"sort"
+)
+
+// ScriptStats describes the size and shape of a loaded script.
+type ScriptStats struct {
+	// Commands is the number of commands other than require, including
+	// if, elsif and else.
+	Commands int
+	// Tests is the number of tests, including allof, anyof and not.
+	Tests int
+	// MaxBlockNesting is the deepest block level used; a script without
+	// blocks has 0. It is counted as parser.Options.MaxBlockNesting is.
+	MaxBlockNesting int
+	// MaxTestNesting is the deepest test level used: 1 for the test of an
+	// if, 2 for a test inside its anyof and so on. It is counted as
+	// parser.Options.MaxTestNesting is.
+	MaxTestNesting int
+	// Extensions are the required extensions, sorted.
+	Extensions []string
+}
+
+// Stats returns statistics about the loaded script.
+func (s *Script) Stats() ScriptStats {
+	var st ScriptStats
+	s.walk(func(node interface{}, blockDepth, testDepth int) bool {
+		if _, ok := node.(Test); ok {
+			st.Tests++
+			if testDepth > st.MaxTestNesting {
+				st.MaxTestNesting = testDepth
+			}
+			return true
+		}
+		st.Commands++
+		switch node.(type) {
+		case CmdIf, CmdElsif, CmdElse, CmdDovecotTest:
+			// The block counts even if it is empty.
+			blockDepth++
+		}
+		if blockDepth > st.MaxBlockNesting {
+			st.MaxBlockNesting = blockDepth
+		}
+		return true
+	})
+	st.Extensions = s.Extensions()
+	sort.Strings(st.Extensions)
+	return st
+}
+
+// Weights of the complexity score, see ComplexityScore.
+const (
+	complexityMatchesKey = 2
+	complexityRegexKey   = 10
+)
+
+// ComplexityScore estimates how expensive the script can be to execute, for
+// Options.MaxComplexityScore. Every command and test adds 1, and every key
+// a test compares values against adds 1 more, 2 for :matches and 10 for
+// :regex, since each key may be tried against every value.
+func (s *Script) ComplexityScore() int {
+	score := 0
+	s.Walk(func(node interface{}) bool {
+		score++
+		if m, ok := node.(interface{ keyWeight() int }); ok {
+			score += m.keyWeight()
+		}
+		return true
+	})
+	return score
+}
+
+// keyWeight returns the complexity score of the keys of the test.
+func (t matcherTest) keyWeight() int {
+	switch t.match {
+	case MatchRegex:
+		return len(t.key) * complexityRegexKey
+	case MatchMatches:
+		return len(t.key) * complexityMatchesKey
+	}
+	return len(t.key)
+}
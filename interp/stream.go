@@ -0,0 +1,78 @@
+package interp
+
+import (
+	"context"
+)
+
+type ActionKind string
+
+const (
+	ActionKeep     ActionKind = "keep"
+	ActionFileInto ActionKind = "fileinto"
+	ActionRedirect ActionKind = "redirect"
+	ActionDiscard  ActionKind = "discard"
+	ActionVacation ActionKind = "vacation"
+)
+
+// Action is an action performed by a script, reported to
+// RuntimeData.OnAction as it is executed.
+type Action struct {
+	Kind ActionKind
+	// Target is the mailbox for fileinto, the address for redirect and
+	// the recipient of the response for vacation.
+	Target string
+	// Flags are the IMAP flags the message is stored with by keep and
+	// fileinto.
+	Flags []string
+	// Copy is set for fileinto and redirect with :copy.
+	Copy bool
+	// RewriteSender is set for redirect when Options.RewriteRedirectSender
+	// asks the sending layer to rewrite the envelope sender, e.g. with SRS.
+	// Otherwise the original envelope sender is kept.
+	RewriteSender bool
+}
+
+// emit reports a to the OnAction hook, if any.
+func (d *RuntimeData) emit(a Action) {
+	if d.OnAction != nil {
+		d.OnAction(a)
+	}
+}
+
+// ExecuteStream executes the script in a new goroutine and sends each action
+// on the returned channel as it is performed. The action channel is closed
+// when execution ends; the error channel then yields the result of Execute
+// and is closed. The implicit keep is not an action: check d.ImplicitKeep
+// once execution has ended.
+//
+// The caller must drain the action channel or cancel ctx, otherwise
+// execution blocks. d must not be used until the error channel is closed.
+func (s *Script) ExecuteStream(ctx context.Context, d *RuntimeData) (<-chan Action, <-chan error) {
+	actions := make(chan Action)
+	errc := make(chan error, 1)
+
+	hook := d.OnAction
+	dropped := false
+	d.OnAction = func(a Action) {
+		if hook != nil {
+			hook(a)
+		}
+		select {
+		case actions <- a:
+		case <-ctx.Done():
+			dropped = true
+		}
+	}
+
+	go func() {
+		defer close(errc)
+		err := s.Execute(ctx, d)
+		d.OnAction = hook
+		close(actions)
+		if err == nil && dropped {
+			err = ctx.Err()
+		}
+		errc <- err
+	}()
+	return actions, errc
+}
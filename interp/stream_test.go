@@ -0,0 +1,75 @@
+package interp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestExecuteStream(t *testing.T) {
+	s := loadTestScript(t, &Options{MaxRedirects: 5}, `require ["fileinto", "copy", "imap4flags"];
+keep :flags "\\Seen";
+fileinto :copy "Archive";
+redirect "other@example.org";
+discard;
+`)
+	d := testRuntimeData(s, nil, nil)
+
+	var got []Action
+	actions, errc := s.ExecuteStream(context.Background(), d)
+	for a := range actions {
+		got = append(got, a)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Action{
+		{Kind: ActionKeep, Flags: []string{"\\seen"}},
+		{Kind: ActionFileInto, Target: "Archive", Copy: true},
+		{Kind: ActionRedirect, Target: "other@example.org"},
+		{Kind: ActionDiscard},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("actions =\n%+v\nwant\n%+v", got, want)
+	}
+	if d.OnAction != nil {
+		t.Error("ExecuteStream did not restore the OnAction hook")
+	}
+}
+
+func TestRedirectRewriteSender(t *testing.T) {
+	for _, rewrite := range []bool{false, true} {
+		s := loadTestScript(t, &Options{MaxRedirects: 5, RewriteRedirectSender: rewrite}, `require "copy";
+redirect :copy "a@example.org";
+redirect "b@example.org";
+`)
+		var got []Action
+		d := testRuntimeData(s, nil, nil)
+		d.OnAction = func(a Action) { got = append(got, a) }
+		if err := s.Execute(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []Action{
+			{Kind: ActionRedirect, Target: "a@example.org", Copy: true, RewriteSender: rewrite},
+			{Kind: ActionRedirect, Target: "b@example.org", RewriteSender: rewrite},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("RewriteRedirectSender=%v: actions =\n%+v\nwant\n%+v", rewrite, got, want)
+		}
+	}
+}
+
+func TestExecuteStreamCancel(t *testing.T) {
+	s := loadTestScript(t, &Options{}, `keep; keep;`)
+	d := testRuntimeData(s, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	actions, errc := s.ExecuteStream(ctx, d)
+	<-actions
+	cancel()
+	if err := <-errc; err == nil {
+		t.Error("expected an error after cancelling an undrained stream")
+	}
+}
@@ -1,7 +1,6 @@
 package interp
 
 import (
-	"encoding/hex"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -21,28 +20,31 @@ var encodedHexRegex = regexp.MustCompile(
 		`hex:[ \t\r\n]*([0-9a-f]{1,2}(?:[ \t\r\n]+[0-9a-f]{1,2})*)[ \t\r\n]*|` +
 		`unicode:[ \t\r\n]*([0-9a-f]+(?:[ \t\r\n]+[0-9a-f]+)*)[ \t\r\n]*)}`)
 
-var removeWSP = strings.NewReplacer(
-	"\t", "", "\r", "", "\n", "", " ", "",
-)
-
-var normalizeWSP = strings.NewReplacer(
-	"\t", "", "\r", "", "\n", "",
-)
-
+// decodeEncodedChars replaces the encoded character sequences in s. LoadSpec
+// only calls it for scripts that require "encoded-character"; otherwise the
+// sequences are ordinary text (RFC 5228, Section 2.4.2.4).
 func decodeEncodedChars(s string) (string, error) {
 	var lastErr error
 	decoded := encodedHexRegex.ReplaceAllStringFunc(s, func(match string) string {
 		if strings.HasPrefix(strings.ToLower(match), "${hex:") {
-			hexString := removeWSP.Replace(match[6 : len(match)-1])
-			decoded, err := hex.DecodeString(hexString)
-			if err != nil {
-				lastErr = err
-				return ""
+			// Each hex-pair is one octet, even a single digit, so the pairs
+			// are decoded one by one rather than concatenated. Sequences
+			// that are not pairs of hex digits never match encodedHexRegex
+			// and are left as literal text.
+			pairs := strings.Fields(match[6 : len(match)-1])
+			decoded := make([]byte, 0, len(pairs))
+			for _, pair := range pairs {
+				b, err := strconv.ParseUint(pair, 16, 8)
+				if err != nil {
+					lastErr = err
+					return ""
+				}
+				decoded = append(decoded, byte(b))
 			}
 			return string(decoded)
 		}
 
-		cpString := strings.Fields(normalizeWSP.Replace(match[10 : len(match)-1]))
+		cpString := strings.Fields(match[10 : len(match)-1])
 		replacement := strings.Builder{}
 		replacement.Grow(len(cpString))
 		for _, part := range cpString { // strings.Fields guarantees no empty parts
@@ -0,0 +1,68 @@
+package interp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/migadu/go-sieve/lexer"
+	"github.com/migadu/go-sieve/parser"
+)
+
+func TestDecodeEncodedChars(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"${hex:41 42}", "AB"},
+		{"${hex: 4142 }", "${hex: 4142 }"},
+		{"${HEX:\t41\r\n42}", "AB"},
+		{"${hex:4}", "\x04"},
+		{"${hex:4 1}", "\x04\x01"},
+		{"${hex:414}", "${hex:414}"},
+		{"${hex:zz}", "${hex:zz}"},
+		{"${hex:}", "${hex:}"},
+		{"a${hex:20}b${hex:4g}", "a b${hex:4g}"},
+		{"${unicode:41 42}", "AB"},
+		{"${unicode:41\t1F600}", "A\U0001F600"},
+		{"${unicode:xyz}", "${unicode:xyz}"},
+	} {
+		got, err := decodeEncodedChars(tc.in)
+		if err != nil {
+			t.Errorf("decodeEncodedChars(%q): %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("decodeEncodedChars(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	if _, err := decodeEncodedChars("${unicode:D800}"); err == nil {
+		t.Error("expected an error for a surrogate code point")
+	}
+}
+
+func TestEncodedCharsReload(t *testing.T) {
+	// "${hex:24}" decodes to "$", leaving "${hex:41}" after one pass.
+	toks, err := lexer.Lex(strings.NewReader(`require ["encoded-character", "variables"];
+if string :is ["${hex:24}{hex:41}"] "${hex:24}{hex:41}" { keep; }`), &lexer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds, err := parser.Parse(lexer.NewStream(toks), &parser.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		s, err := LoadScript(cmds, &Options{MaxVariableNameLen: 32}, []string{"encoded-character", "variables"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{})
+		if err := s.Execute(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		if !d.Keep {
+			t.Errorf("load %d: string list decoded differently from the key", i+1)
+		}
+	}
+}
@@ -15,16 +15,24 @@ func stripRFC2822Comments(addr string) string {
 	// Simple regex to remove text in parentheses
 	// This is a basic implementation - RFC 2822 comment parsing is complex
 	// but this handles the common case in the test
-	commentRegex := regexp.MustCompile(`\([^)]*\)`)
 	return strings.TrimSpace(commentRegex.ReplaceAllString(addr, ""))
 }
 
+var commentRegex = regexp.MustCompile(`\([^)]*\)`)
+
 type Test interface {
 	Check(ctx context.Context, d *RuntimeData) (bool, error)
 }
 
+// AddressTest is the address test (RFC 5228, Section 5.1). The fields are
+// tested in the order they appear in the message. A message that is resent
+// gets a new block of Resent-* fields prepended (RFC 5322, Section 3.6.6),
+// so the values of a Resent-* field come newest first and :index 1 selects
+// the most recent one.
 type AddressTest struct {
 	matcherTest
+	fieldIndex
+	mimeTest
 
 	AddressPart    AddressPart
 	AddressPartCnt int // Counter to detect duplicate address parts
@@ -69,21 +77,44 @@ var allowedAddrHeaders = map[string]struct{}{
 	"x-original-to":                      {},
 }
 
+// isAddressHeader reports whether the lower-cased header field name holds
+// addresses, either by default or per Options.AddressHeaders.
+func (s *Script) isAddressHeader(name string) bool {
+	if _, ok := allowedAddrHeaders[name]; ok {
+		return true
+	}
+	for _, h := range s.opts.AddressHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (a AddressTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	entryCount := uint64(0)
 	for _, hdr := range a.Header {
 		hdr = strings.ToLower(hdr)
 		hdr = expandVars(d, hdr)
 
-		if _, ok := allowedAddrHeaders[hdr]; !ok {
+		if !d.Script.isAddressHeader(hdr) {
+			if d.Script.opts.StrictAddressHeaders {
+				return false, fmt.Errorf("address: %s is not an address header", hdr)
+			}
 			continue
 		}
 
-		// Use GetHeaderWithEdits to get the current header state including any edits
-		values, err := GetHeaderWithEdits(d, hdr)
+		// The current header state including any edits and, with
+		// :mime :anychild, the headers of the MIME parts
+		values, err := a.rawValues(ctx, d, hdr)
 		if err != nil {
 			return false, err
 		}
+		if a.Index > 0 {
+			if values = a.selectField(values); values == nil {
+				continue
+			}
+		}
 
 		// Handle case where header exists but has no values (empty header)
 		if len(values) == 0 {
@@ -104,24 +135,14 @@ func (a AddressTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 		}
 
 		for _, value := range values {
-			// Strip RFC 2822 comments before parsing
-			cleanValue := stripRFC2822Comments(value)
-
-			// Check for invalid angle bracket usage (bare angle brackets without display name)
-			// Pattern like "<email@domain.com>" without preceding display name is invalid
-			trimmed := strings.TrimSpace(cleanValue)
-			hasBareAngleBrackets := strings.HasPrefix(trimmed, "<") && strings.HasSuffix(trimmed, ">") &&
-				strings.Count(trimmed, "<") == 1 && strings.Count(trimmed, ">") == 1
-
-			if hasBareAngleBrackets {
-				// Bare angle brackets are invalid for address parsing, but for :all we can match literally
+			// Most values hold a single plain address, which needs no
+			// full address-list parse.
+			if addr, ok := simpleAddress(value); ok {
 				if a.isCount() {
-					// For count mode, invalid addresses don't count
+					entryCount++
 					continue
 				}
-
-				// Try literal matching against the invalid address format
-				ok, err := testAddress(ctx, d, a.matcherTest, a.AddressPart, cleanValue)
+				ok, err := testAddress(ctx, d, a.matcherTest, a.AddressPart, addr)
 				if err != nil {
 					return false, err
 				}
@@ -131,16 +152,26 @@ func (a AddressTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 				continue
 			}
 
-			addrList, err := mail.ParseAddressList(cleanValue)
-			if err != nil {
-				// If parsing fails, try matching against the literal header value
-				if a.isCount() {
-					// For count mode, non-parseable addresses don't count
-					continue
-				}
+			// Strip RFC 2822 comments before parsing
+			cleanValue := stripRFC2822Comments(value)
 
-				// For failed address parsing, match against the literal value
-				ok, err := testAddress(ctx, d, a.matcherTest, a.AddressPart, cleanValue)
+			// Check for invalid angle bracket usage (bare angle brackets without display name)
+			// Pattern like "<email@domain.com>" without preceding display name is invalid
+			trimmed := strings.TrimSpace(cleanValue)
+			hasBareAngleBrackets := strings.HasPrefix(trimmed, "<") && strings.HasSuffix(trimmed, ">") &&
+				strings.Count(trimmed, "<") == 1 && strings.Count(trimmed, ">") == 1
+
+			// An empty value is an empty address list, which
+			// mail.ParseAddressList rejects.
+			var addrList []*mail.Address
+			var err error
+			if !hasBareAngleBrackets && trimmed != "" {
+				addrList, err = mail.ParseAddressList(cleanValue)
+			}
+			if hasBareAngleBrackets || err != nil {
+				// Bare angle brackets and other unparsable values are
+				// malformed addresses.
+				ok, err := a.testMalformed(ctx, d, cleanValue)
 				if err != nil {
 					return false, err
 				}
@@ -192,13 +223,76 @@ func (a AddressTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	return false, nil
 }
 
+// simpleAddress returns the addr-spec of value if value is a single
+// address in one of the two most common forms, "local@domain" or
+// "Display Name <local@domain>", with an ASCII dot-atom local-part and
+// domain and a display name of plain words. For such a value the result is
+// the address mail.ParseAddressList finds. ok is false for anything else,
+// e.g. quoted strings, comments, groups or several addresses.
+func simpleAddress(value string) (addr string, ok bool) {
+	value = strings.Trim(value, " \t")
+	if strings.HasSuffix(value, ">") {
+		open := strings.LastIndexByte(value, '<')
+		if open < 0 {
+			return "", false
+		}
+		name := strings.TrimRight(value[:open], " \t")
+		if name == "" {
+			// A bare angle-addr is malformed, see AddressTest.Check.
+			return "", false
+		}
+		for _, word := range strings.Fields(name) {
+			if !isDotAtom(word, false) {
+				return "", false
+			}
+		}
+		value = value[open+1 : len(value)-1]
+	}
+	local, domain, found := strings.Cut(value, "@")
+	if !found || !isDotAtom(local, true) || !isDotAtom(domain, true) {
+		return "", false
+	}
+	return value, true
+}
+
+// isDotAtom reports whether s is an ASCII dot-atom (RFC 5322, Section
+// 3.2.3), or an atom if dots is false.
+func isDotAtom(s string, dots bool) bool {
+	if s == "" || s[0] == '.' || s[len(s)-1] == '.' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0:
+		case c == '.' && dots && s[i-1] != '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// testMalformed handles a header value that cannot be parsed as an address
+// list. Malformed addresses match nothing for any address-part and are not
+// counted by :count. If Options.AddressLiteralFallback is set, the unparsed
+// value is instead compared as a whole under :all; :localpart, :domain, :user
+// and :detail still never match since the value has no such parts.
+func (a AddressTest) testMalformed(ctx context.Context, d *RuntimeData, value string) (bool, error) {
+	if a.isCount() || a.AddressPart != All || !d.Script.opts.AddressLiteralFallback {
+		return false, nil
+	}
+	return testAddress(ctx, d, a.matcherTest, All, value)
+}
+
 type AllOfTest struct {
 	Tests []Test
 }
 
 func (a AllOfTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	for _, t := range a.Tests {
-		ok, err := t.Check(ctx, d)
+		ok, err := checkTest(ctx, d, t)
 		if err != nil {
 			return false, err
 		}
@@ -215,7 +309,7 @@ type AnyOfTest struct {
 
 func (a AnyOfTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	for _, t := range a.Tests {
-		ok, err := t.Check(ctx, d)
+		ok, err := checkTest(ctx, d, t)
 		if err != nil {
 			return false, err
 		}
@@ -236,44 +330,44 @@ type EnvelopeTest struct {
 func (e EnvelopeTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	entryCount := uint64(0)
 	for _, field := range e.Field {
-		var value string
-		switch strings.ToLower(expandVars(d, field)) {
-		case "from":
-			value = d.Envelope.EnvelopeFrom()
-		case "to":
-			value = d.Envelope.EnvelopeTo()
-		case "auth":
-			value = d.Envelope.AuthUsername()
-		default:
+		fieldName := strings.ToLower(expandVars(d, field))
+		if !envelopePartDefined(d.Script, fieldName) {
 			return false, fmt.Errorf("envelope: unsupported envelope-part: %v", field)
 		}
+		for _, value := range envelopePart(d.Envelope, fieldName) {
+			// For envelope addresses (from/to), we need to validate them first
+			// If the address is syntactically invalid, envelope tests should not match
+			// Note: auth is not an address, so don't validate it
+			if value != "" && (fieldName == "from" || fieldName == "to") {
+				// Try to parse as envelope address to check validity
+				_, err := parseEnvelopeAddress(value)
+				if err != nil {
+					// Invalid envelope address - should not match anything
+					continue
+				}
+			}
 
-		// For envelope addresses (from/to), we need to validate them first
-		// If the address is syntactically invalid, envelope tests should not match
-		// Note: auth is not an address, so don't validate it
-		fieldName := strings.ToLower(expandVars(d, field))
-		if value != "" && (fieldName == "from" || fieldName == "to") {
-			// Try to parse as envelope address to check validity
-			_, err := parseEnvelopeAddress(value)
-			if err != nil {
-				// Invalid envelope address - should not match anything
+			if e.isCount() {
+				if value != "" {
+					entryCount++
+				}
 				continue
 			}
-		}
 
-		if e.isCount() {
-			if value != "" {
-				entryCount++
+			// The null reverse-path "<>" of a bounce is the empty string,
+			// so `envelope :is "from" ""` detects it. It has no local-part
+			// or domain for the other address parts to match.
+			if (value == "" || value == "<>") && e.AddressPart != All {
+				continue
 			}
-			continue
-		}
 
-		ok, err := testAddress(ctx, d, e.matcherTest, e.AddressPart, value)
-		if err != nil {
-			return false, err
-		}
-		if ok {
-			return true, nil
+			ok, err := testAddress(ctx, d, e.matcherTest, e.AddressPart, value)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
 		}
 	}
 	if e.isCount() {
@@ -282,14 +376,56 @@ func (e EnvelopeTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	return false, nil
 }
 
+// envelopePartDefined reports whether part (lower-case) is an envelope-part
+// defined by the extensions required by the script.
+func envelopePartDefined(s *Script, part string) bool {
+	switch part {
+	case "from", "to", "auth":
+		return true
+	case "orcpt", "notify":
+		return s.RequiresExtension("envelope-dsn")
+	}
+	return false
+}
+
+// envelopePart returns the values of an envelope-part: one, except for
+// "to" with several recipients, or none if the envelope does not provide
+// the part.
+func envelopePart(env Envelope, part string) []string {
+	switch part {
+	case "from":
+		return []string{env.EnvelopeFrom()}
+	case "to":
+		return envelopeTo(env)
+	case "auth":
+		return []string{env.AuthUsername()}
+	case "orcpt":
+		if dsn, isDSN := env.(EnvelopeDSN); isDSN {
+			if value, ok := dsn.OriginalRecipient(); ok {
+				return []string{value}
+			}
+		}
+	case "notify":
+		if dsn, isDSN := env.(EnvelopeDSN); isDSN {
+			if value, ok := dsn.DSNNotify(); ok {
+				return []string{value}
+			}
+		}
+	}
+	return nil
+}
+
 type ExistsTest struct {
+	mimeTest
+
 	Fields []string
 }
 
-func (e ExistsTest) Check(_ context.Context, d *RuntimeData) (bool, error) {
+func (e ExistsTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	for _, field := range e.Fields {
-		// Use GetHeaderWithEdits to get the current header state including any edits
-		values, err := GetHeaderWithEdits(d, expandVars(d, field))
+		// The current header state including any edits and, with
+		// :mime :anychild, the headers of the MIME parts
+		values, err := e.rawValues(ctx, d, expandVars(d, field))
 		if err != nil {
 			return false, err
 		}
@@ -314,6 +450,8 @@ func (t TrueTest) Check(context.Context, *RuntimeData) (bool, error) {
 
 type HeaderTest struct {
 	matcherTest
+	fieldIndex
+	mimeTest
 
 	Header []string
 }
@@ -321,19 +459,33 @@ type HeaderTest struct {
 func (h HeaderTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 	entryCount := uint64(0)
 	for _, hdr := range h.Header {
-		// Use GetHeaderWithEdits to get the current header state including any edits
-		values, err := GetHeaderWithEdits(d, expandVars(d, hdr))
+		// Use headerValues to get the current header state including any edits
+		var values []string
+		var raw bool
+		var err error
+		if h.mime {
+			values, err = h.mimeTest.values(ctx, d, expandVars(d, hdr))
+		} else {
+			values, raw, err = headerValues(d, expandVars(d, hdr))
+		}
 		if err != nil {
 			return false, err
 		}
+		values = h.selectField(values)
 
 		for _, value := range values {
+			// Each occurrence of the field counts, so scripts can guard
+			// against mail loops by counting Received headers.
 			if h.isCount() {
 				entryCount++
 				continue
 			}
 
-			ok, err := h.matcherTest.tryMatch(ctx, d, decodeHeaderValue(value))
+			// Values selected with :mime are already decoded.
+			if !raw && !h.mime {
+				value = d.Script.headerCompareValue(value)
+			}
+			ok, err := h.matcherTest.tryMatch(ctx, d, value)
 			if err != nil {
 				return false, err
 			}
@@ -355,7 +507,7 @@ type NotTest struct {
 }
 
 func (n NotTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
-	ok, err := n.Test.Check(ctx, d)
+	ok, err := checkTest(ctx, d, n.Test)
 	if err != nil {
 		return false, err
 	}
@@ -363,7 +515,7 @@ func (n NotTest) Check(ctx context.Context, d *RuntimeData) (bool, error) {
 }
 
 type SizeTest struct {
-	Size  int
+	Size  int64
 	Over  bool
 	Under bool
 }
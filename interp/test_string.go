@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"strings"
 	"unicode"
+
+	"golang.org/x/net/idna"
 )
 
 type Match string
@@ -46,6 +48,28 @@ const (
 // in subaddresses. The default is "+" but can be configured.
 var SubaddressSeparator = "+"
 
+// SubaddressPolicy is optionally implemented by a PolicyReader whose
+// domains use different subaddress separators, e.g. "-" for one and "+"
+// for another.
+type SubaddressPolicy interface {
+	// SubaddressSeparatorFor returns the separator used in domain, or ""
+	// for the default one.
+	SubaddressSeparatorFor(domain string) string
+}
+
+// subaddressSeparator returns the separator for addresses in domain.
+func subaddressSeparator(d *RuntimeData, domain string) string {
+	if p, ok := d.Policy.(SubaddressPolicy); ok {
+		if sep := p.SubaddressSeparatorFor(domain); sep != "" {
+			return sep
+		}
+	}
+	if sep := d.Script.opts.Text.SubaddressSeparator; sep != "" {
+		return sep
+	}
+	return SubaddressSeparator
+}
+
 func split(addr string) (mailbox, domain string, err error) {
 	if strings.EqualFold(addr, "postmaster") {
 		return addr, "", nil
@@ -106,7 +130,7 @@ func testString(ctx context.Context, comparator Comparator, match Match, rel Rel
 		case MatchMatches:
 			return matchOctet(ctx, key, value, false)
 		case MatchRegex:
-			return matchRegex(ctx, key, value)
+			return matchRegex(ctx, key, regexValue(comparator, value))
 		case MatchValue:
 			return rel.CompareString(value, key), nil, nil
 		case MatchCount:
@@ -144,9 +168,7 @@ func testString(ctx context.Context, comparator Comparator, match Match, rel Rel
 		case MatchMatches:
 			return matchOctet(ctx, key, value, true)
 		case MatchRegex:
-			// For case-insensitive regex, normalize value but not pattern
-			value = toLowerASCII(value)
-			return matchRegex(ctx, key, value)
+			return matchRegex(ctx, key, regexValue(comparator, value))
 		case MatchValue:
 			value = toLowerASCII(value)
 			key = toLowerASCII(key)
@@ -165,9 +187,7 @@ func testString(ctx context.Context, comparator Comparator, match Match, rel Rel
 		case MatchMatches:
 			return matchUnicode(ctx, key, value, true)
 		case MatchRegex:
-			// For Unicode case-insensitive regex, normalize value but not pattern
-			value = strings.ToLower(value)
-			return matchRegex(ctx, key, value)
+			return matchRegex(ctx, key, regexValue(comparator, value))
 		case MatchValue:
 			value = toLowerASCII(value)
 			key = toLowerASCII(key)
@@ -179,18 +199,25 @@ func testString(ctx context.Context, comparator Comparator, match Match, rel Rel
 	return false, nil, nil
 }
 
-// splitSubaddress splits a local-part into user and detail parts
-// using the SubaddressSeparator. If no separator is found, user is the
-// entire local-part and detail is empty.
-func splitSubaddress(localPart string) (user, detail string) {
-	idx := strings.Index(localPart, SubaddressSeparator)
+// splitSubaddress splits a local-part into user and detail parts at the
+// first sep. If no separator is found, user is the entire local-part and
+// detail is empty.
+func splitSubaddress(localPart, sep string) (user, detail string) {
+	idx := strings.Index(localPart, sep)
 	if idx == -1 {
 		// No separator found - entire local-part is the user
 		return localPart, ""
 	}
-	return localPart[:idx], localPart[idx+len(SubaddressSeparator):]
+	return localPart[:idx], localPart[idx+len(sep):]
 }
 
+// testAddress matches the selected part of address using the test's
+// comparator. The comparator applies uniformly to every part: although
+// local-parts are case-sensitive (RFC 5321), the default i;ascii-casemap
+// compares them case-insensitively, and i;octet can be used to match a
+// local-part exactly. Options.CaseInsensitiveDomains turns i;octet into
+// i;ascii-casemap for the domain part, and Options.Text.IDNDomains lets :is
+// match a domain in either its Unicode or its "xn--" form.
 func testAddress(ctx context.Context, d *RuntimeData, matcher matcherTest, part AddressPart, address string) (bool, error) {
 	if address == "<>" {
 		address = ""
@@ -211,25 +238,31 @@ func testAddress(ctx context.Context, d *RuntimeData, matcher matcherTest, part
 				return false, nil
 			}
 			valueToCompare = domain
+			if matcher.comparator == ComparatorOctet && d.Script.opts.CaseInsensitiveDomains {
+				// Keys compiled for i;octet are recompiled on use.
+				matcher.comparator = ComparatorASCIICaseMap
+				matcher.keyCompiled = nil
+			}
 		case All:
 			valueToCompare = address
 		case User:
 			// RFC 5233: :user is the user sub-part of the local-part
-			localPart, _, err := split(address)
+			localPart, domain, err := split(address)
 			if err != nil {
 				return false, nil
 			}
-			user, _ := splitSubaddress(localPart)
+			user, _ := splitSubaddress(localPart, subaddressSeparator(d, domain))
 			valueToCompare = user
 		case Detail:
 			// RFC 5233: :detail is the detail sub-part of the local-part
 			// If no detail exists, the address fails to match any key
-			localPart, _, err := split(address)
+			localPart, domain, err := split(address)
 			if err != nil {
 				return false, nil
 			}
-			_, detail := splitSubaddress(localPart)
-			if detail == "" && !strings.Contains(localPart, SubaddressSeparator) {
+			sep := subaddressSeparator(d, domain)
+			_, detail := splitSubaddress(localPart, sep)
+			if detail == "" && !strings.Contains(localPart, sep) {
 				// No separator found - fail to match (RFC 5233 Section 4)
 				return false, nil
 			}
@@ -238,10 +271,40 @@ func testAddress(ctx context.Context, d *RuntimeData, matcher matcherTest, part
 	}
 
 	ok, err := matcher.tryMatch(ctx, d, valueToCompare)
-	if err != nil {
-		return false, err
+	if err != nil || ok {
+		return ok, err
 	}
-	return ok, nil
+	if matcher.match == MatchIs && d.Script.opts.Text.IDNDomains && (part == All || part == Domain) {
+		for _, alt := range idnForms(part, valueToCompare) {
+			ok, err := matcher.tryMatch(ctx, d, alt)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// idnForms returns value, an address or a domain as selected by part, with
+// its domain converted to the "xn--" form and to Unicode (RFC 5891), leaving
+// the local-part as is. Forms equal to value or that cannot be converted are
+// omitted.
+func idnForms(part AddressPart, value string) []string {
+	local, domain := "", value
+	if part == All {
+		var err error
+		if local, domain, err = split(value); err != nil || domain == "" {
+			return nil
+		}
+		local += "@"
+	}
+	var forms []string
+	for _, conv := range []func(string) (string, error){idna.Lookup.ToASCII, idna.Lookup.ToUnicode} {
+		if alt, err := conv(domain); err == nil && alt != domain {
+			forms = append(forms, local+alt)
+		}
+	}
+	return forms
 }
 
 func toLowerASCII(s string) string {
@@ -275,9 +338,24 @@ func toLowerASCII(s string) string {
 	return b.String()
 }
 
-// matchRegex performs safe regex matching and returns match result and capture groups
+// regexValue returns value as the :regex match type compares it with
+// comparator: the case-insensitive comparators lower-case the value but not
+// the pattern.
+func regexValue(comparator Comparator, value string) string {
+	switch comparator {
+	case ComparatorASCIICaseMap:
+		return toLowerASCII(value)
+	case ComparatorUnicodeCaseMap:
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// matchRegex performs safe regex matching and returns match result and capture groups.
+// The pattern is compiled with the limits carried by ctx, if any.
 func matchRegex(ctx context.Context, pattern, value string) (bool, []string, error) {
-	matcher, err := CompileSafeRegex(pattern, DefaultRegexLimits)
+	limits, _ := regexLimitsFromContext(ctx)
+	matcher, err := CompileSafeRegex(pattern, EffectiveRegexLimits(limits))
 	if err != nil {
 		return false, nil, err
 	}
@@ -0,0 +1,135 @@
+package interp
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/emersion/go-message"
+	"golang.org/x/text/unicode/norm"
+)
+
+// TextPolicy controls how text from the message is decoded and compared.
+// The zero value decodes encoded-words, rejects unknown charsets, does not
+// normalize and compares domains as written.
+type TextPolicy struct {
+	// KeepEncodedWords makes the header test compare header values with
+	// RFC 2047 encoded-words left as they are, as older implementations
+	// did, instead of decoding them (RFC 5228, Section 2.7.2). Scripts
+	// written for such a server may rely on it.
+	KeepEncodedWords bool
+
+	// CharsetFallback is the charset, e.g. "iso-8859-1", assumed for
+	// encoded-words in a charset that cannot be decoded and for header
+	// values that are not valid UTF-8. Empty leaves such text as it is.
+	CharsetFallback string
+
+	// Normalization is the Unicode normalization form applied to values
+	// and keys compared with the i;unicode-casemap comparator, so that
+	// composed and decomposed characters match. Empty means none.
+	Normalization Normalization
+
+	// IDNDomains makes :is in the address and envelope tests match an
+	// internationalized domain in either its Unicode or its ASCII
+	// ("xn--") form, so "user@münchen.de" matches
+	// "user@xn--mnchen-3ya.de". Only the domain of the message value is
+	// converted, so a key in Unicode should be written as IDNA maps it,
+	// e.g. lower-cased; keys, local-parts and other match types are
+	// compared as is.
+	IDNDomains bool
+
+	// SubaddressSeparator separates user from detail for the subaddress
+	// extension. A PolicyReader implementing SubaddressPolicy overrides
+	// it per domain. Empty means the package-wide SubaddressSeparator.
+	SubaddressSeparator string
+}
+
+// Normalization is a Unicode normalization form (UAX #15).
+type Normalization string
+
+const (
+	NormalizeNone Normalization = ""
+	NormalizeNFC  Normalization = "NFC"
+	NormalizeNFD  Normalization = "NFD"
+	NormalizeNFKC Normalization = "NFKC"
+	NormalizeNFKD Normalization = "NFKD"
+)
+
+// normalize returns s in the normalization form n.
+func (n Normalization) normalize(s string) string {
+	switch n {
+	case NormalizeNFC:
+		return norm.NFC.String(s)
+	case NormalizeNFD:
+		return norm.NFD.String(s)
+	case NormalizeNFKC:
+		return norm.NFKC.String(s)
+	case NormalizeNFKD:
+		return norm.NFKD.String(s)
+	}
+	return s
+}
+
+// valid reports whether n is a known normalization form.
+func (n Normalization) valid() bool {
+	switch n {
+	case NormalizeNone, NormalizeNFC, NormalizeNFD, NormalizeNFKC, NormalizeNFKD:
+		return true
+	}
+	return false
+}
+
+// normalizeFor returns s normalized as the policy asks for values compared
+// with comparator.
+func (p TextPolicy) normalizeFor(comparator Comparator, s string) string {
+	if comparator != ComparatorUnicodeCaseMap {
+		return s
+	}
+	return p.Normalization.normalize(s)
+}
+
+// decodeHeaderValue unfolds a header value and decodes RFC 2047
+// encoded-words into UTF-8 so that comparisons operate on the decoded text
+// (RFC 5228, Section 2.7.2). Values that fail to decode are returned
+// unfolded but otherwise unchanged, or converted from CharsetFallback if
+// they are not valid UTF-8.
+func (p TextPolicy) decodeHeaderValue(raw string) string {
+	raw = unfoldHeaderValue(raw)
+	if !utf8.ValidString(raw) {
+		raw = p.fromFallback(raw)
+	}
+	if !strings.Contains(raw, "=?") {
+		return raw
+	}
+	dec := headerWordDecoder
+	if p.CharsetFallback != "" {
+		dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+			if r, err := headerWordDecoder.CharsetReader(charset, input); err == nil {
+				return r, nil
+			}
+			return headerWordDecoder.CharsetReader(p.CharsetFallback, input)
+		}
+	}
+	decoded, err := dec.DecodeHeader(raw)
+	if err != nil {
+		return raw
+	}
+	return decoded
+}
+
+// fromFallback converts s from CharsetFallback to UTF-8, or returns it
+// unchanged if there is no fallback or it cannot be converted.
+func (p TextPolicy) fromFallback(s string) string {
+	if p.CharsetFallback == "" || message.CharsetReader == nil {
+		return s
+	}
+	r, err := message.CharsetReader(strings.ToLower(p.CharsetFallback), strings.NewReader(s))
+	if err != nil {
+		return s
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return s
+	}
+	return string(b)
+}
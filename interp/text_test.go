@@ -0,0 +1,59 @@
+package interp
+
+import (
+	"net/textproto"
+	"testing"
+)
+
+func TestTextPolicy(t *testing.T) {
+	run := func(t *testing.T, text TextPolicy, field, value, test string) bool {
+		t.Helper()
+		hdr := textproto.MIMEHeader{}
+		hdr.Set(field, value)
+		d := runHeaderScript(t, &Options{Text: text}, `require ["subaddress", "comparator-i;unicode-casemap"]; if `+test+` { discard; }`, hdr)
+		return !d.ImplicitKeep
+	}
+
+	for _, tc := range []struct {
+		name  string
+		text  TextPolicy
+		field string
+		value string
+		test  string
+		match bool
+	}{
+		// "e" followed by a combining acute accent against a precomposed "é".
+		{"decomposed", TextPolicy{}, "Subject", "Cafe\u0301", `header :comparator "i;unicode-casemap" :is "Subject" "CAFÉ"`, false},
+		{"decomposed-nfc", TextPolicy{Normalization: NormalizeNFC}, "Subject", "Cafe\u0301", `header :comparator "i;unicode-casemap" :is "Subject" "CAFÉ"`, true},
+		{"decomposed-nfc-matches", TextPolicy{Normalization: NormalizeNFC}, "Subject", "Cafe\u0301 menu", `header :comparator "i;unicode-casemap" :matches "Subject" "café *"`, true},
+		{"decomposed-nfc-octet", TextPolicy{Normalization: NormalizeNFC}, "Subject", "Cafe\u0301", `header :comparator "i;octet" :is "Subject" "Café"`, false},
+		{"ligature-nfkc", TextPolicy{Normalization: NormalizeNFKC}, "Subject", "\ufb01le", `header :comparator "i;unicode-casemap" :is "Subject" "file"`, true},
+
+		{"unknown-charset", TextPolicy{}, "Subject", "=?x-unknown?Q?caf=E9?=", `header :is "Subject" "café"`, false},
+		{"unknown-charset-fallback", TextPolicy{CharsetFallback: "iso-8859-1"}, "Subject", "=?x-unknown?Q?caf=E9?=", `header :is "Subject" "café"`, true},
+		{"8bit-fallback", TextPolicy{CharsetFallback: "iso-8859-1"}, "Subject", "caf\xe9", `header :is "Subject" "café"`, true},
+
+		{"keep-encoded-words", TextPolicy{KeepEncodedWords: true}, "Subject", "=?UTF-8?Q?caf=C3=A9?=", `header :is "Subject" "café"`, false},
+
+		{"separator", TextPolicy{}, "To", "user-box@example.org", `address :detail "To" "box"`, false},
+		{"separator-dash", TextPolicy{SubaddressSeparator: "-"}, "To", "user-box@example.org", `address :detail "To" "box"`, true},
+
+		{"idn", TextPolicy{}, "To", "user@xn--mnchen-3ya.de", `address :domain :is "To" "münchen.de"`, false},
+		{"idn-domains", TextPolicy{IDNDomains: true}, "To", "user@xn--mnchen-3ya.de", `address :domain :is "To" "münchen.de"`, true},
+		{"idn-domains-unicode-value", TextPolicy{IDNDomains: true}, "To", "user@MÜNCHEN.de", `address :domain :is "To" "xn--mnchen-3ya.de"`, true},
+		{"idn-domains-all", TextPolicy{IDNDomains: true}, "To", "user@xn--mnchen-3ya.de", `address :all :is "To" "user@münchen.de"`, true},
+		{"idn-domains-contains", TextPolicy{IDNDomains: true}, "To", "user@xn--mnchen-3ya.de", `address :domain :contains "To" "münchen"`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := run(t, tc.text, tc.field, tc.value, tc.test); got != tc.match {
+				t.Errorf("match = %v, want %v", got, tc.match)
+			}
+		})
+	}
+
+	t.Run("unknown-normalization", func(t *testing.T) {
+		if _, err := LoadScript(nil, &Options{Text: TextPolicy{Normalization: "NFX"}}, nil); err == nil {
+			t.Error("LoadScript accepted an unknown normalization form")
+		}
+	})
+}
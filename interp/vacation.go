@@ -2,7 +2,12 @@ package interp
 
 import (
 	"context"
-	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"github.com/emersion/go-message"
 )
 
 // VacationResponse represents an autoresponse to be sent.
@@ -26,14 +31,72 @@ type VacationResponse struct {
 	Days int
 }
 
+// Header returns the header of the response to send to the recipient to.
+// Non-ASCII text in the subject and the From display name is RFC 2047
+// encoded. Unless the reason is a MIME entity itself, the body is
+// declared as UTF-8 text. The response is marked as auto-replied (RFC
+// 3834, Section 5).
+func (r VacationResponse) Header(to string) message.Header {
+	var h message.Header
+	if r.From != "" {
+		from := r.From
+		if addr, err := mail.ParseAddress(from); err == nil {
+			from = addr.String()
+		}
+		h.Set("From", from)
+	}
+	h.Set("To", to)
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", r.Subject))
+	h.Set("Auto-Submitted", "auto-replied")
+	h.Set("MIME-Version", "1.0")
+	if !r.IsMime {
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		if isASCII(r.Body) {
+			h.Set("Content-Transfer-Encoding", "7bit")
+		} else {
+			h.Set("Content-Transfer-Encoding", "8bit")
+		}
+	}
+	return h
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// VacationSuppression tells why a vacation command that was executed did
+// not produce a response. Rate limiting by :days and :handle is left to the
+// host and is not reported here.
+type VacationSuppression string
+
+const (
+	// VacationOwnAddress: the sender is one of the :addresses.
+	VacationOwnAddress VacationSuppression = "own-address"
+	// VacationBulkMail: the message was sent automatically or through a
+	// mailing list (RFC 5230, Section 4.5).
+	VacationBulkMail VacationSuppression = "bulk-mail"
+	// VacationNoSender: the envelope has no return path to respond to.
+	VacationNoSender VacationSuppression = "no-sender"
+)
+
+// MaxVacationDays is the largest :days value a script can set. Larger
+// values are reduced to it, as RFC 5230, Section 4.1 allows.
+const MaxVacationDays = 365
+
 // CmdVacation represents the vacation command as defined in RFC 5230.
 type CmdVacation struct {
 	// Days specifies the minimum number of days between autoresponses to the same sender.
-	// Default is 7 days if not specified.
+	// Default is 7 days if not specified, and it is at most MaxVacationDays.
 	Days int
 
 	// Subject specifies the subject to be used in the autoresponse.
-	// Default is "Automated reply" if not specified.
+	// Default is "Auto: " followed by the subject of the message, or
+	// "Automated reply" if the message has none (RFC 5230, Section 4.5).
 	Subject string
 
 	// From specifies the address to be used in the From header of the autoresponse.
@@ -60,7 +123,10 @@ func (c CmdVacation) Execute(ctx context.Context, d *RuntimeData) error {
 	// Expand variables in all string fields
 	subject := expandVars(d, c.Subject)
 	if subject == "" {
-		subject = "Automated reply"
+		var err error
+		if subject, err = defaultVacationSubject(d); err != nil {
+			return err
+		}
 	}
 
 	from := expandVars(d, c.From)
@@ -72,18 +138,30 @@ func (c CmdVacation) Execute(ctx context.Context, d *RuntimeData) error {
 	// Get the sender's address from the message
 	// We'll use the envelope from address as the sender
 	sender := d.Envelope.EnvelopeFrom()
-	if sender == "" {
-		return fmt.Errorf("vacation: failed to get sender from envelope")
+	if sender == "" || sender == "<>" {
+		d.VacationSuppressed = VacationNoSender
+		return nil
 	}
 
-	// Check if the sender is in the list of "my" addresses
-	for _, addr := range addresses {
-		if addr == sender {
-			// Don't send autoresponse to our own addresses
+	// Don't send autoresponse to our own addresses: the recipients and
+	// the :addresses (RFC 5230, Section 4.5)
+	own := append(append([]string(nil), envelopeTo(d.Envelope)...), addresses...)
+	for _, addr := range own {
+		if sameAddress(addr, sender, d.Script.opts.CaseSensitiveLocalParts) {
+			d.VacationSuppressed = VacationOwnAddress
 			return nil
 		}
 	}
 
+	bulk, err := isBulkMail(d)
+	if err != nil {
+		return err
+	}
+	if bulk {
+		d.VacationSuppressed = VacationBulkMail
+		return nil
+	}
+
 	// In a real implementation, we would check if we've already sent an autoresponse
 	// to this sender recently, and we would send the autoresponse if allowed.
 	// For now, we'll just add the autoresponse to the runtime data.
@@ -101,9 +179,115 @@ func (c CmdVacation) Execute(ctx context.Context, d *RuntimeData) error {
 		Handle:  handle,
 		Days:    c.Days,
 	}
+	d.emit(Action{Kind: ActionVacation, Target: sender})
 
 	// Per RFC 5230 Section 4: "The vacation action does not cancel the implicit keep."
 	// Therefore, we do NOT set d.ImplicitKeep = false here.
 
 	return nil
 }
+
+// maxVacationSubject bounds the number of characters of the default
+// vacation subject, "Auto: " prefix included.
+const maxVacationSubject = 128
+
+// defaultVacationSubject returns the subject of a response without
+// :subject: the decoded subject of the message prefixed with "Auto: ",
+// truncated if long, or "Automated reply" if the message has no subject.
+// A subject that already starts with "Auto:" is not prefixed again. Control
+// characters, which a decoded encoded-word may hold, become spaces so that
+// the subject cannot add fields to the response header.
+func defaultVacationSubject(d *RuntimeData) (string, error) {
+	values, err := GetHeaderWithEdits(d, "Subject")
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "Automated reply", nil
+	}
+	subject := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, d.Script.opts.Text.decodeHeaderValue(values[0]))
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return "Automated reply", nil
+	}
+	if len(subject) < 5 || !strings.EqualFold(subject[:5], "Auto:") {
+		subject = "Auto: " + subject
+	}
+	if r := []rune(subject); len(r) > maxVacationSubject {
+		subject = strings.TrimSpace(string(r[:maxVacationSubject])) + "..."
+	}
+	return subject, nil
+}
+
+// sameAddress reports whether a and b, each either a bare address or one
+// with a display name or angle brackets, are the same address. Domains are
+// compared ignoring case, local-parts too unless caseSensitiveLocal is set.
+func sameAddress(a, b string, caseSensitiveLocal bool) bool {
+	aLocal, aDomain, ok := splitAddress(a)
+	if !ok {
+		return false
+	}
+	bLocal, bDomain, ok := splitAddress(b)
+	if !ok {
+		return false
+	}
+	if !strings.EqualFold(aDomain, bDomain) {
+		return false
+	}
+	if caseSensitiveLocal {
+		return aLocal == bLocal
+	}
+	return strings.EqualFold(aLocal, bLocal)
+}
+
+// splitAddress parses addr and splits it into local-part and domain.
+func splitAddress(addr string) (local, domain string, ok bool) {
+	if parsed, err := mail.ParseAddress(addr); err == nil {
+		addr = parsed.Address
+	} else {
+		addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(addr), "<"), ">")
+	}
+	i := strings.LastIndexByte(addr, '@')
+	if i <= 0 || i == len(addr)-1 {
+		return "", "", false
+	}
+	return addr[:i], addr[i+1:], true
+}
+
+// isBulkMail reports whether the message was generated automatically or
+// distributed by a mailing list, which vacation must not respond to
+// (RFC 5230, Section 4.5; RFC 3834, Section 2).
+func isBulkMail(d *RuntimeData) (bool, error) {
+	autoSubmitted, err := d.Msg.HeaderGet("Auto-Submitted")
+	if err != nil {
+		return false, err
+	}
+	for _, v := range autoSubmitted {
+		kind, _, _ := strings.Cut(v, ";")
+		if !strings.EqualFold(strings.TrimSpace(kind), "no") {
+			return true, nil
+		}
+	}
+
+	precedence, err := d.Msg.HeaderGet("Precedence")
+	if err != nil {
+		return false, err
+	}
+	for _, v := range precedence {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "bulk", "list", "junk":
+			return true, nil
+		}
+	}
+
+	listID, err := d.Msg.HeaderGet("List-Id")
+	if err != nil {
+		return false, err
+	}
+	return len(listID) != 0, nil
+}
@@ -30,10 +30,12 @@ func usedVars(script *Script, s string) []string {
 	return variables
 }
 
+// usedVarsAreValid reports whether every reference in s can be read: a
+// match variable, a user variable or a variable of a namespace whose
+// extension is required (RFC 5229, Section 3).
 func usedVarsAreValid(script *Script, s string) bool {
 	for _, v := range usedVars(script, s) {
-		matchNum, err := strconv.Atoi(v)
-		if err == nil && matchNum >= 0 {
+		if isNumVariable(v) {
 			continue
 		}
 
@@ -45,6 +47,34 @@ func usedVarsAreValid(script *Script, s string) bool {
 	return true
 }
 
+// isNumVariable reports whether name is a num-variable, a reference to a
+// match variable.
+func isNumVariable(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] < '0' || name[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// matchVariableIndex returns the index of the match variable a
+// num-variable refers to. Leading zeros are ignored; a number too large to
+// parse refers to no match variable.
+func matchVariableIndex(name string) int {
+	i, err := strconv.Atoi(name)
+	if err != nil {
+		return maxMatchVariableIndex
+	}
+	return i
+}
+
+// maxMatchVariableIndex is past every match variable.
+const maxMatchVariableIndex = 1<<31 - 1
+
 func expandVarsList(d *RuntimeData, list []string) []string {
 	if !d.Script.RequiresExtension("variables") {
 		return list
@@ -57,25 +87,48 @@ func expandVarsList(d *RuntimeData, list []string) []string {
 	return listCpy
 }
 
+// expandVars substitutes the variable references in s. Expansion is a
+// single pass: references in the substituted values are not expanded again.
+// The result is truncated to len(s) plus MaxVariableLen bytes (RFC 5229,
+// Section 3 allows implementations to truncate), so a string referencing
+// many large variables cannot grow without bound.
 func expandVars(d *RuntimeData, s string) string {
 	if !d.Script.RequiresExtension("variables") {
 		return s
 	}
 
-	expanded := variableRegexp.ReplaceAllStringFunc(s, func(match string) string {
-		name := match[2 : len(match)-1]
+	limit := -1
+	if max := d.Script.opts.MaxVariableLen; max > 0 {
+		limit = len(s) + max
+	}
 
-		if matchNum, err := strconv.Atoi(name); err == nil && matchNum >= 0 {
-			return d.MatchVariable(matchNum)
+	var b strings.Builder
+	last := 0
+	for _, loc := range variableRegexp.FindAllStringIndex(s, -1) {
+		b.WriteString(s[last:loc[0]])
+		last = loc[1]
+
+		name := s[loc[0]+2 : loc[1]-1]
+		var value string
+		if isNumVariable(name) {
+			value = d.MatchVariable(matchVariableIndex(name))
+		} else {
+			// References are checked when the script is loaded, so an
+			// error here is a variable that does not exist: it expands
+			// to the empty string, as an unset variable does.
+			value, _ = d.Var(name)
 		}
+		b.WriteString(value)
 
-		value, err := d.Var(name)
-		if err != nil {
-			panic("attempt to use an unusable variable: " + name)
+		if limit >= 0 && b.Len() > limit {
+			return truncateUTF8(b.String(), limit)
 		}
-		return value
-	})
-	return expanded
+	}
+	b.WriteString(s[last:])
+	if limit >= 0 {
+		return truncateUTF8(b.String(), limit)
+	}
+	return b.String()
 }
 
 type CmdSet struct {
@@ -89,6 +142,22 @@ func (c CmdSet) Execute(_ context.Context, d *RuntimeData) error {
 	return d.SetVar(c.Name, c.ModifyValue(expandVars(d, c.Value)))
 }
 
+// countListItems returns the number of non-empty items in s when split on
+// sep. Variables only ever hold plain strings, so the "string" test with
+// :count splits every expanded source string on Options.ListSeparator and
+// counts the non-empty items. A source without a separator therefore counts
+// as one item when non-empty and zero items when empty, which matches
+// Dovecot's behaviour for literal string lists.
+func countListItems(s, sep string) uint64 {
+	count := uint64(0)
+	for _, item := range strings.Split(s, sep) {
+		if item != "" {
+			count++
+		}
+	}
+	return count
+}
+
 type TestString struct {
 	matcherTest
 
@@ -96,14 +165,16 @@ type TestString struct {
 }
 
 func (t TestString) Check(ctx context.Context, d *RuntimeData) (bool, error) {
+	sep := d.Script.opts.ListSeparator
+	if sep == "" {
+		sep = ","
+	}
 	entryCount := uint64(0)
 	for _, source := range t.Source {
 		source = expandVars(d, source)
 
 		if t.isCount() {
-			if source != "" {
-				entryCount++
-			}
+			entryCount += countListItems(source, sep)
 			continue
 		}
 
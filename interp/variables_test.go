@@ -0,0 +1,160 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	opts := &Options{MaxVariableCount: 10, MaxVariableNameLen: 32, MaxVariableLen: 100}
+
+	t.Run("self-reference", func(t *testing.T) {
+		s := loadTestScript(t, opts, `require "variables";
+set "a" "${a}x";
+set "a" "${a}${a}";
+set "b" "${a}";`)
+		d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{})
+		if err := s.Execute(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Variables["b"]; got != "xx" {
+			t.Errorf("b = %q, want %q", got, "xx")
+		}
+		// A value that looks like a reference is not expanded again.
+		d.Variables["c"] = "${a}"
+		if got := expandVars(d, "${c}"); got != "${a}" {
+			t.Errorf("expandVars(${c}) = %q, want %q", got, "${a}")
+		}
+	})
+
+	t.Run("length-cap", func(t *testing.T) {
+		s := loadTestScript(t, opts, `require "variables";
+set "a" "`+strings.Repeat("y", 100)+`";`)
+		d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{}, MessageStatic{})
+		if err := s.Execute(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+		in := strings.Repeat("${a}", 50)
+		got := expandVars(d, in)
+		if want := len(in) + 100; len(got) != want {
+			t.Errorf("expanded to %d bytes, want %d", len(got), want)
+		}
+		if got := expandVars(d, "<${a}>"); got != "<"+strings.Repeat("y", 100)+">" {
+			t.Errorf("single reference was truncated: %q", got)
+		}
+	})
+}
+
+func TestVariableReferences(t *testing.T) {
+	opts := &Options{MaxVariableCount: 10, MaxVariableNameLen: 32, MaxVariableLen: 100}
+	s := loadTestScript(t, opts, `require ["variables", "envelope"];
+set "foo" "bar";
+if string :matches "hello world" "* *" { }`)
+	d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{From: "from@example.org"}, MessageStatic{})
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"${1}", "hello"},
+		{"${0}", "hello world"},
+		{"${002}", "world"},
+		{"${3}", ""},
+		{"${99999999999999999999999}", ""},
+		{"${foo}", "bar"},
+		{"${FOO}", "bar"},
+		{"${undefined}", ""},
+		{"${envelope.from}", "from@example.org"},
+		{"${envelope.FROM}", "from@example.org"},
+		// Not a variable-ref: left as is.
+		{"${}", "${}"},
+		{"${foo", "${foo"},
+		{"${foo.}", "${foo.}"},
+		{"${.foo}", "${.foo}"},
+		{"${1a}", "${1a}"},
+		{"${ foo}", "${ foo}"},
+		{"$${foo}}", "$bar}"},
+	} {
+		if got := expandVars(d, tc.in); got != tc.want {
+			t.Errorf("expandVars(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	for _, script := range []string{
+		// Unknown namespace.
+		`require "variables"; set "a" "${global.foo}";`,
+		// The namespace's extension is not required.
+		`require "variables"; set "a" "${envelope.from}";`,
+		`require ["variables", "fileinto"]; fileinto "${envelope.to}";`,
+	} {
+		if _, err := loadTestScriptErr(t, opts, []string{"variables", "fileinto", "envelope"}, script); err == nil {
+			t.Errorf("%s: loaded a reference to an unavailable variable", script)
+		}
+	}
+}
+
+func TestVariableKeys(t *testing.T) {
+	opts := &Options{MaxVariableCount: 10, MaxVariableNameLen: 32, MaxVariableLen: 100}
+	s := loadTestScript(t, opts, `require ["variables", "envelope", "imap4flags"];
+set "x" "hello";
+set "who" "alice";
+if header :contains "Subject" "${x}" { addflag "header"; }
+if address :localpart :is "From" "${who}" { addflag "address"; }
+if envelope :localpart :is "from" "${who}" { addflag "envelope"; }
+if header :matches "X-Ref" "*" { set "ref" "${1}"; }
+if header :is "X-Ref" "${ref}" { addflag "literal"; }
+set "x" "bye";
+if header :contains "Subject" "${x}" { addflag "stale"; }`)
+
+	hdr := textproto.MIMEHeader{}
+	hdr.Set("Subject", "well hello there")
+	hdr.Set("From", "alice@example.org")
+	hdr.Set("X-Ref", "${x}")
+	d := NewRuntimeData(s, DummyPolicy{}, EnvelopeStatic{From: "alice@example.org"}, MessageStatic{Header: hdr})
+	if err := s.Execute(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// Keys are expanded when the test runs, once: "stale" would match the
+	// value x had at load, and "literal" fails if the value of ref, taken
+	// from the message, is expanded again.
+	want := []string{"address", "envelope", "header", "literal"}
+	if got := d.Flags; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("flags = %v, want %v", got, want)
+	}
+}
+
+func TestSetName(t *testing.T) {
+	opts := &Options{MaxVariableCount: 10, MaxVariableNameLen: 32, MaxVariableLen: 100}
+	load := func(script string) error {
+		_, err := loadTestScriptErr(t, opts, []string{"variables", "envelope"}, script)
+		return err
+	}
+
+	for _, tc := range []struct {
+		script, err string
+	}{
+		{`require "variables"; set "1" "x";`, `1:22: cannot set match variable "1"`},
+		{`require "variables"; set "global.foo" "x";`, `1:22: cannot set variable "global.foo": the global namespace is not supported`},
+		{`require ["variables", "envelope"]; set "envelope.from" "x";`, `cannot set read-only variable "envelope.from"`},
+		{`require "variables"; set "other.foo" "x";`, `unknown namespace "other"`},
+		{`require "variables"; set "a-b" "x";`, "cannot set this variable"},
+	} {
+		err := load(tc.script)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: error %v, want %q", tc.script, err, tc.err)
+		}
+	}
+
+	var reqErr ExtensionRequiredError
+	if err := load(`require "variables"; set "global.foo" "x";`); errors.As(err, &reqErr) {
+		t.Errorf("set global.foo: error %v asks for an unsupported extension", err)
+	}
+	if err := load(`require "variables"; set "foo_1" "x";`); err != nil {
+		t.Errorf("set foo_1: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package interp
+
+// Walk traverses the loaded script depth-first and calls fn for every command
+// and test, including commands nested in blocks and tests nested in allof,
+// anyof and not.
+//
+// Nodes are the concrete values produced by the loader. Commands implement
+// Cmd (CmdIf, CmdElsif, CmdElse, CmdFileInto, CmdRedirect, CmdKeep,
+// CmdDiscard, CmdStop, CmdSet, CmdVacation, CmdAddHeader, CmdDeleteHeader,
+// CmdSetFlag, CmdAddFlag, CmdRemoveFlag, ...) and tests implement Test
+// (AllOfTest, AnyOfTest, NotTest, AddressTest, EnvelopeTest, HeaderTest,
+// ExistsTest, SizeTest, TestString, DateTest, CurrentDateTest,
+// MailboxExistsTest, *TestBody, ...). Tests that compare values against a
+// key-list expose their match type and comparator via MatchType and
+// Comparator.
+//
+// A command is visited before its test, the test before its nested tests,
+// and those before the command's block. If fn returns false, the children of
+// that node are not visited.
+func (s *Script) Walk(fn func(node interface{}) bool) {
+	s.walk(func(node interface{}, _, _ int) bool { return fn(node) })
+}
+
+// walkFunc is called by walk for every node with its nesting: the block
+// depth, 0 for top-level commands and their tests, and for tests the test
+// depth, 1 for the test of a command and 0 for commands.
+type walkFunc func(node interface{}, blockDepth, testDepth int) bool
+
+// walk is Walk with the nesting of every node.
+func (s *Script) walk(fn walkFunc) {
+	walkCmds(s.cmd, 0, fn)
+}
+
+func walkCmds(cmds []Cmd, depth int, fn walkFunc) {
+	for _, c := range cmds {
+		walkCmd(c, depth, fn)
+	}
+}
+
+func walkCmd(c Cmd, depth int, fn walkFunc) {
+	if !fn(c, depth, 0) {
+		return
+	}
+	switch c := c.(type) {
+	case CmdIf:
+		walkTest(c.Test, depth, 1, fn)
+		walkCmds(c.Block, depth+1, fn)
+	case CmdElsif:
+		walkTest(c.Test, depth, 1, fn)
+		walkCmds(c.Block, depth+1, fn)
+	case CmdElse:
+		walkCmds(c.Block, depth+1, fn)
+	case CmdDovecotTest:
+		walkCmds(c.Cmds, depth+1, fn)
+	}
+}
+
+func walkTest(t Test, blockDepth, depth int, fn walkFunc) {
+	if t == nil || !fn(t, blockDepth, depth) {
+		return
+	}
+	switch t := t.(type) {
+	case AllOfTest:
+		for _, nested := range t.Tests {
+			walkTest(nested, blockDepth, depth+1, fn)
+		}
+	case AnyOfTest:
+		for _, nested := range t.Tests {
+			walkTest(nested, blockDepth, depth+1, fn)
+		}
+	case NotTest:
+		walkTest(t.Test, blockDepth, depth+1, fn)
+	}
+}
@@ -0,0 +1,87 @@
+package interp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScriptWalk(t *testing.T) {
+	s := loadTestScript(t, &Options{}, `require ["fileinto", "regex"];
+if header :contains "Subject" "a" {
+	fileinto "a";
+	if anyof (header :regex "Subject" "^b", not exists "X-C") {
+		fileinto "b";
+	} elsif true {
+		fileinto "c";
+	} else {
+		if false { fileinto "d"; }
+	}
+}
+fileinto "e";
+`)
+
+	fileinto := 0
+	regex := 0
+	s.Walk(func(node interface{}) bool {
+		switch n := node.(type) {
+		case CmdFileInto:
+			fileinto++
+		case HeaderTest:
+			if n.MatchType() == MatchRegex {
+				regex++
+			}
+		}
+		return true
+	})
+	if fileinto != 5 {
+		t.Errorf("Walk visited %d fileinto commands, want 5", fileinto)
+	}
+	if regex != 1 {
+		t.Errorf("Walk visited %d :regex tests, want 1", regex)
+	}
+
+	// Returning false skips the children of a node.
+	fileinto = 0
+	s.Walk(func(node interface{}) bool {
+		if _, ok := node.(CmdFileInto); ok {
+			fileinto++
+		}
+		_, isIf := node.(CmdIf)
+		return !isIf
+	})
+	if fileinto != 1 {
+		t.Errorf("Walk visited %d top-level fileinto commands, want 1", fileinto)
+	}
+}
+
+func TestScriptStats(t *testing.T) {
+	s := loadTestScript(t, &Options{}, `require ["fileinto", "regex"];
+require "copy";
+if header :contains "Subject" "a" {
+	fileinto "a";
+	if anyof (header :regex "Subject" "^b", not exists "X-C") {
+		fileinto :copy "b";
+	} elsif true {
+		fileinto "c";
+	} else {
+		if false { }
+	}
+}
+keep;
+`)
+	got := s.Stats()
+	want := ScriptStats{
+		Commands:        9,
+		Tests:           7,
+		MaxBlockNesting: 3,
+		MaxTestNesting:  3,
+		Extensions:      []string{"copy", "fileinto", "regex"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	if got := loadTestScript(t, &Options{}, `keep;`).Stats(); got.Commands != 1 || got.MaxBlockNesting != 0 || got.MaxTestNesting != 0 {
+		t.Errorf("Stats() = %+v for a single keep", got)
+	}
+}
@@ -0,0 +1,136 @@
+package interp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/migadu/go-sieve/lexer"
+	"github.com/migadu/go-sieve/parser"
+)
+
+// Warning is a problem found while loading a script that does not prevent
+// it from running, such as a command that can never be executed.
+type Warning struct {
+	lexer.Position
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Position.String() + ": " + w.Message
+}
+
+// Warnings returns the warnings found when the script was loaded.
+func (s *Script) Warnings() []Warning {
+	return s.warnings
+}
+
+// coreComparators are available without a require (RFC 5228, Section
+// 2.7.3).
+var coreComparators = map[string]struct{}{
+	"comparator-i;octet":         {},
+	"comparator-i;ascii-casemap": {},
+}
+
+// collectWarnings inspects the parsed script for suspicious but valid
+// constructs.
+func collectWarnings(cmds []parser.Cmd) []Warning {
+	var warnings []Warning
+	warn := func(pos lexer.Position, format string, args ...interface{}) {
+		warnings = append(warnings, Warning{Position: pos, Message: fmt.Sprintf(format, args...)})
+	}
+
+	required := make(map[string]struct{})
+	for _, c := range cmds {
+		if !strings.EqualFold(c.Id, "require") {
+			continue
+		}
+		for _, ext := range constStrings(c.Args) {
+			if _, ok := coreComparators[ext]; ok {
+				warn(c.Position, "require %q is not needed, the comparator is always available", ext)
+			}
+			if _, ok := required[ext]; ok {
+				warn(c.Position, "extension %q is required more than once", ext)
+			}
+			required[ext] = struct{}{}
+		}
+	}
+
+	var checkBlock func(block []parser.Cmd)
+	checkBlock = func(block []parser.Cmd) {
+		fileinto := make(map[string]struct{})
+		for i, c := range block {
+			if i+1 < len(block) && stopsAt(block, i) {
+				next := block[i+1]
+				warn(next.Position, "%s is never executed, it follows stop", next.Id)
+			}
+			if strings.EqualFold(c.Id, "fileinto") {
+				if args := constStrings(c.Args); len(args) > 0 && !strings.Contains(args[len(args)-1], "${") {
+					mailbox := args[len(args)-1]
+					if _, ok := fileinto[mailbox]; ok {
+						warn(c.Position, "fileinto %q more than once, the message is delivered only once", mailbox)
+					}
+					fileinto[mailbox] = struct{}{}
+				}
+			}
+			checkBlock(c.Block)
+		}
+	}
+	checkBlock(cmds)
+
+	return warnings
+}
+
+// stopsAt reports whether execution of block never continues past
+// block[i]: block[i] is stop, or it ends an if/elsif/else chain whose every
+// branch, including an else, always stops. A stop under an if without an
+// else is conditional. discard does not end the script (RFC 5228, Section
+// 4.5), so commands after it are reachable.
+func stopsAt(block []parser.Cmd, i int) bool {
+	if i+1 < len(block) {
+		// The chain continues with an elsif or else.
+		next := strings.ToLower(block[i+1].Id)
+		if next == "elsif" || next == "else" {
+			return false
+		}
+	}
+	switch strings.ToLower(block[i].Id) {
+	case "stop":
+		return true
+	case "else":
+		// Walk back to the if that starts the chain.
+		for j := i; j >= 0; j-- {
+			if !blockStops(block[j].Block) {
+				return false
+			}
+			if strings.EqualFold(block[j].Id, "if") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// blockStops reports whether executing block always ends in stop.
+func blockStops(block []parser.Cmd) bool {
+	for i := range block {
+		if stopsAt(block, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// constStrings returns the values of the string and string-list arguments in
+// args, in order.
+func constStrings(args []parser.Arg) []string {
+	var res []string
+	for _, a := range args {
+		switch a := a.(type) {
+		case parser.StringArg:
+			res = append(res, a.Value)
+		case parser.StringListArg:
+			res = append(res, a.Value...)
+		}
+	}
+	return res
+}
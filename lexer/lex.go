@@ -3,6 +3,7 @@ package lexer
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -27,7 +28,7 @@ func consumeCRLF(r *bufio.Reader, state *lexerState) error {
 			return err
 		}
 		if b != '\n' {
-			return fmt.Errorf("CR is not followed by LF")
+			return charError(state.Position, '\r', "CR is not followed by LF")
 		}
 		fallthrough
 	case '\n':
@@ -43,25 +44,40 @@ func Lex(r io.Reader, opts *Options) ([]Token, error) {
 	if opts == nil {
 		opts = &Options{}
 	}
-	toks, err := tokenStream(bufio.NewReader(r), opts)
+	state := &lexerState{}
+	state.File = opts.Filename
+	state.Line = 1
+	toks, err := tokenStream(bufio.NewReader(r), opts, state)
 	if err != nil {
 		if err == io.EOF {
-			return nil, io.ErrUnexpectedEOF
+			return nil, SyntaxError{Pos: state.Position, Msg: io.ErrUnexpectedEOF.Error()}
 		}
 		return nil, err
 	}
 	return toks, nil
 }
 
+// charError returns a SyntaxError for the character b at pos.
+func charError(pos Position, b byte, format string, args ...interface{}) error {
+	return SyntaxError{Pos: pos, Token: string([]byte{b}), Msg: fmt.Sprintf(format, args...)}
+}
+
+// unterminated returns a SyntaxError at pos, where token starts, if err
+// reports that the input ended before the token did. Other errors are
+// returned as they are.
+func unterminated(err error, pos Position, token, msg string) error {
+	if err != io.EOF {
+		return err
+	}
+	return SyntaxError{Pos: pos, Token: token, Msg: msg}
+}
+
 type lexerState struct {
 	Position
 }
 
-func tokenStream(r *bufio.Reader, opts *Options) ([]Token, error) {
+func tokenStream(r *bufio.Reader, opts *Options, state *lexerState) ([]Token, error) {
 	res := []Token{}
-	state := &lexerState{}
-	state.File = opts.Filename
-	state.Line = 1
 	for {
 		b, err := r.ReadByte()
 		if err != nil {
@@ -78,7 +94,7 @@ func tokenStream(r *bufio.Reader, opts *Options) ([]Token, error) {
 		}
 		switch b {
 		case 0:
-			return nil, fmt.Errorf("go-sieve/lexer: NUL is not allowed in input stream")
+			return nil, charError(state.Position, b, "go-sieve/lexer: NUL is not allowed in input stream")
 		case '[':
 			res = append(res, ListStart{state.Position})
 		case ']':
@@ -110,7 +126,7 @@ func tokenStream(r *bufio.Reader, opts *Options) ([]Token, error) {
 			lineCol := state.Position
 			str, err := quotedString(r, state)
 			if err != nil {
-				return nil, err
+				return nil, unterminated(err, lineCol, "\"", "unterminated quoted string")
 			}
 			res = append(res, String{Position: lineCol, Text: str})
 		case '#':
@@ -118,16 +134,16 @@ func tokenStream(r *bufio.Reader, opts *Options) ([]Token, error) {
 				return nil, err
 			}
 		case '/':
+			lineCol := state.Position
 			b2, err := r.ReadByte()
-			if err != nil {
+			if err == io.EOF || (err == nil && b2 != '*') {
+				return nil, charError(lineCol, b, "unexpected forward slash")
+			} else if err != nil {
 				return nil, err
 			}
 			state.Col++
-			if b2 != '*' {
-				return nil, fmt.Errorf("unexpected forward slash")
-			}
 			if err := multilineComment(r, state); err != nil {
-				return nil, err
+				return nil, unterminated(err, lineCol, "/*", "unterminated comment")
 			}
 		case 't':
 			// "text:"
@@ -166,12 +182,12 @@ func tokenStream(r *bufio.Reader, opts *Options) ([]Token, error) {
 						}
 						break wsLoop
 					default:
-						return nil, fmt.Errorf("unexpected character: %v", b)
+						return nil, charError(state.Position, b, "unexpected character: %v", b)
 					}
 				}
 				mlString, err := multilineString(r, state)
 				if err != nil {
-					return nil, err
+					return nil, unterminated(err, lineCol, "text:", "unterminated multi-line string")
 				}
 				res = append(res, String{Position: lineCol, Text: mlString})
 				continue
@@ -189,17 +205,19 @@ func tokenStream(r *bufio.Reader, opts *Options) ([]Token, error) {
 				res = append(res, Identifier{Position: lineCol, Text: str})
 			} else if b >= '0' && b <= '9' {
 				num, err := number(r, string(b), state)
-				if err != nil {
+				if numErr := (*strconv.NumError)(nil); errors.As(err, &numErr) {
+					return nil, SyntaxError{Pos: lineCol, Token: numErr.Num, Msg: "number is too large"}
+				} else if err != nil {
 					return nil, err
 				}
 				num.Position = lineCol
 				res = append(res, num)
 			} else {
-				return nil, fmt.Errorf("unexpected character: %v", b)
+				return nil, charError(state.Position, b, "unexpected character: %v", b)
 			}
 		}
 		if opts.MaxTokens != 0 && len(res) > opts.MaxTokens {
-			return nil, fmt.Errorf("too many tokens")
+			return nil, SyntaxErrorAt(res[len(res)-1], "too many tokens")
 		}
 	}
 	return res, nil
@@ -287,7 +305,7 @@ readLoop:
 		}
 	}
 
-	numParsed, err := strconv.Atoi(num.String())
+	numParsed, err := strconv.ParseInt(num.String(), 10, 64)
 	if err != nil {
 		return Number{}, err
 	}
@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -114,3 +116,136 @@ Line 5
 		Semicolon{Position: LineCol(8, 1)},
 	})
 }
+
+func TestLexLineEndings(t *testing.T) {
+	const script = `require ["fileinto"]; # comment
+/* multi-line
+   comment */
+if header :contains "Subject" "multi
+line\
+string" {
+	fileinto text: # comment
+INBOX
+..dotted
+.
+;
+}
+`
+	crlf := strings.ReplaceAll(script, "\n", "\r\n")
+
+	lfToks, err := Lex(strings.NewReader(script), &Options{})
+	if err != nil {
+		t.Fatal("LF script failed:", err)
+	}
+	crlfToks, err := Lex(strings.NewReader(crlf), &Options{})
+	if err != nil {
+		t.Fatal("CRLF script failed:", err)
+	}
+	if !reflect.DeepEqual(lfToks, crlfToks) {
+		t.Log("Different lexer output for LF and CRLF line endings")
+		t.Logf("LF:   %#v", lfToks)
+		t.Logf("CRLF: %#v", crlfToks)
+		t.Fail()
+	}
+
+	// An injected error is reported at the same position.
+	const broken = "require \"fileinto\";\n\nif true {\n  @keep;\n}\n"
+	_, lfErr := Lex(strings.NewReader(broken), &Options{})
+	_, crlfErr := Lex(strings.NewReader(strings.ReplaceAll(broken, "\n", "\r\n")), &Options{})
+	if lfErr == nil || crlfErr == nil {
+		t.Fatalf("expected errors, got LF: %v, CRLF: %v", lfErr, crlfErr)
+	}
+	if lfErr.Error() != crlfErr.Error() {
+		t.Errorf("different error for LF (%v) and CRLF (%v)", lfErr, crlfErr)
+	}
+	if !strings.HasPrefix(lfErr.Error(), "4:3:") {
+		t.Errorf("error reported at wrong position: %v", lfErr)
+	}
+}
+
+func TestLexSyntaxError(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		script string
+		want   SyntaxError
+	}{
+		{"unexpected-character", "require \"fileinto\";\n\nif true {\n  @keep;\n}\n", SyntaxError{
+			Pos:   Position{File: "broken.sieve", Line: 4, Col: 3},
+			Token: "@",
+			Msg:   "unexpected character: 64",
+		}},
+		{"forward-slash", "keep; /x", SyntaxError{
+			Pos:   Position{File: "broken.sieve", Line: 1, Col: 7},
+			Token: "/",
+			Msg:   "unexpected forward slash",
+		}},
+		{"forward-slash-at-end", "keep; /", SyntaxError{
+			Pos:   Position{File: "broken.sieve", Line: 1, Col: 7},
+			Token: "/",
+			Msg:   "unexpected forward slash",
+		}},
+		{"unterminated-string", "keep;\nfileinto \"INBOX\n", SyntaxError{
+			Pos:   Position{File: "broken.sieve", Line: 2, Col: 10},
+			Token: "\"",
+			Msg:   "unterminated quoted string",
+		}},
+		{"unterminated-comment", "keep; /* no end\n *", SyntaxError{
+			Pos:   Position{File: "broken.sieve", Line: 1, Col: 7},
+			Token: "/*",
+			Msg:   "unterminated comment",
+		}},
+		{"unterminated-text", "vacation text:\nline\n", SyntaxError{
+			Pos:   Position{File: "broken.sieve", Line: 1, Col: 10},
+			Token: "text:",
+			Msg:   "unterminated multi-line string",
+		}},
+		{"cr-without-lf", "keep;\r;", SyntaxError{
+			Pos:   Position{File: "broken.sieve", Line: 1, Col: 6},
+			Token: "\r",
+			Msg:   "CR is not followed by LF",
+		}},
+		{"cr-at-end", "keep;\r", SyntaxError{
+			Pos: Position{File: "broken.sieve", Line: 1, Col: 6},
+			Msg: "unexpected EOF",
+		}},
+		{"number-too-large", "size :over 99999999999999999999;", SyntaxError{
+			Pos:   Position{File: "broken.sieve", Line: 1, Col: 12},
+			Token: "99999999999999999999",
+			Msg:   "number is too large",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Lex(strings.NewReader(tc.script), &Options{Filename: "broken.sieve"})
+			var serr SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("error %v is not a SyntaxError", err)
+			}
+			if serr != tc.want {
+				t.Errorf("error = %+v, want %+v", serr, tc.want)
+			}
+			if prefix := fmt.Sprintf("%d:%d: ", tc.want.Pos.Line, tc.want.Pos.Col); !strings.HasPrefix(err.Error(), prefix) {
+				t.Errorf("error %q does not start with %q", err, prefix)
+			}
+		})
+	}
+}
+
+func TestLexTooManyTokens(t *testing.T) {
+	_, err := Lex(strings.NewReader("keep;\nkeep;\n"), &Options{MaxTokens: 3})
+	want := SyntaxError{Pos: Position{Line: 2, Col: 5}, Token: ";", Msg: "too many tokens"}
+	var serr SyntaxError
+	if !errors.As(err, &serr) {
+		t.Fatalf("error %v is not a SyntaxError", err)
+	}
+	if serr != want {
+		t.Errorf("error = %+v, want %+v", serr, want)
+	}
+}
+
+func TestStreamErrEmpty(t *testing.T) {
+	err := NewStream(nil).Err("expected %s", "a command")
+	want := SyntaxError{Msg: "expected a command"}
+	if serr, ok := err.(SyntaxError); !ok || serr != want {
+		t.Errorf("error = %#v, want %#v", err, want)
+	}
+}
@@ -10,7 +10,7 @@ type Stream struct {
 }
 
 func (s *Stream) Last() Token {
-	if s.cursor >= len(s.toks) {
+	if s.cursor < 0 || s.cursor >= len(s.toks) {
 		return nil
 	}
 	return s.toks[s.cursor]
@@ -32,12 +32,18 @@ func (s *Stream) Peek() Token {
 	return s.toks[cur]
 }
 
+// Err returns a SyntaxError at the current token or, past the end of the
+// stream, at the last one. For an empty stream Pos is zero.
 func (s *Stream) Err(format string, args ...interface{}) error {
 	last := s.Last()
-	if last == nil {
-		return fmt.Errorf(format, args...)
+	if last != nil {
+		return SyntaxErrorAt(last, format, args...)
+	}
+	err := SyntaxError{Msg: fmt.Sprintf(format, args...)}
+	if len(s.toks) != 0 {
+		err.Pos = tokenPos(s.toks[len(s.toks)-1])
 	}
-	return ErrorAt(last, format, args...)
+	return err
 }
 
 func NewStream(toks []Token) *Stream {
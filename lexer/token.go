@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 )
@@ -22,6 +23,10 @@ func (l Position) LineCol() (int, int) {
 	return l.Line, l.Col
 }
 
+func (l Position) pos() Position {
+	return l
+}
+
 func LineCol(line, col int) Position {
 	return Position{Line: line, Col: col}
 }
@@ -47,7 +52,7 @@ const (
 	Giga Quantifier = 'G'
 )
 
-func (q Quantifier) Multiplier() int {
+func (q Quantifier) Multiplier() int64 {
 	switch q {
 	case None:
 		return 1
@@ -64,7 +69,7 @@ func (q Quantifier) Multiplier() int {
 
 type Number struct {
 	Position
-	Value      int
+	Value      int64
 	Quantifier Quantifier
 }
 
@@ -123,22 +128,74 @@ type position interface {
 	LineCol() (int, int)
 }
 
-type tokError struct {
-	t    position
-	text string
+// Error is an error at a position in a script that parsed, such as those
+// interp.LoadScript returns, made by ErrorAt. Lex and parser.Parse return
+// SyntaxError instead. Line and Col are 0 if the position is not known.
+type Error struct {
+	Line, Col int
+	Message   string
+	// Err is the error wrapped with %w in the message, if any.
+	Err error
+
+	hasPos bool
 }
 
-func (e tokError) Error() string {
-	if e.t == nil {
-		return fmt.Sprintf("unknown-position: %s", e.text)
+func (e Error) Error() string {
+	if !e.hasPos {
+		return fmt.Sprintf("unknown-position: %s", e.Message)
 	}
-	line, col := e.t.LineCol()
+	return formatError(e.Line, e.Col, e.Message)
+}
+
+// formatError formats msg at line and col as "line:col: msg".
+func formatError(line, col int, msg string) string {
 	if line == 0 || col == 0 {
-		return fmt.Sprintf("invalid-position: %s", e.text)
+		return fmt.Sprintf("invalid-position: %s", msg)
 	}
-	return fmt.Sprintf("%d:%d: %s", line, col, e.text)
+	return fmt.Sprintf("%d:%d: %s", line, col, msg)
 }
 
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorAt returns an Error at the position of t. As with fmt.Errorf, an
+// error formatted with %w is wrapped.
 func ErrorAt(t position, format string, args ...interface{}) error {
-	return tokError{t: t, text: fmt.Sprintf(format, args...)}
+	err := fmt.Errorf(format, args...)
+	e := Error{Message: err.Error(), Err: errors.Unwrap(err)}
+	if t != nil {
+		e.hasPos = true
+		e.Line, e.Col = t.LineCol()
+	}
+	return e
+}
+
+// SyntaxError is an error in the syntax of a script. Lex and parser.Parse
+// return it for every error in the script; only errors reading it are
+// returned as they are. Pos is 1-based, unless Options.NoPosition is
+// set. Token is the source text of the offending token or character, or ""
+// if the script ends early; Pos is then that of the last token, or zero if
+// there is none. It formats as Error does.
+type SyntaxError struct {
+	Pos   Position
+	Token string
+	Msg   string
+}
+
+func (e SyntaxError) Error() string {
+	return formatError(e.Pos.Line, e.Pos.Col, e.Msg)
+}
+
+// SyntaxErrorAt returns a SyntaxError at token t.
+func SyntaxErrorAt(t Token, format string, args ...interface{}) error {
+	return SyntaxError{Pos: tokenPos(t), Token: tokenText(t), Msg: fmt.Sprintf(format, args...)}
+}
+
+// tokenPos returns the position of t.
+func tokenPos(t Token) Position {
+	if p, ok := t.(interface{ pos() Position }); ok {
+		return p.pos()
+	}
+	return LineCol(t.LineCol())
 }
@@ -10,40 +10,7 @@ import (
 func Write(w io.Writer, toks []Token) error {
 	bw := bufio.NewWriter(w)
 	for _, t := range toks {
-		var err error
-		switch t := t.(type) {
-		case Identifier:
-			_, err = bw.WriteString(t.Text)
-		case Number:
-			if t.Quantifier != None {
-				_, err = fmt.Fprintf(bw, "%d%s", t.Value, string(t.Quantifier))
-			} else {
-				_, err = fmt.Fprintf(bw, "%d", t.Value)
-			}
-		case String:
-			_, err = bw.WriteString(formatString(t.Text))
-		case ListStart:
-			err = bw.WriteByte('[')
-		case ListEnd:
-			err = bw.WriteByte(']')
-		case TestListStart:
-			err = bw.WriteByte('(')
-		case TestListEnd:
-			err = bw.WriteByte(')')
-		case BlockStart:
-			err = bw.WriteByte('{')
-		case BlockEnd:
-			err = bw.WriteByte('}')
-		case Comma:
-			err = bw.WriteByte(',')
-		case Semicolon:
-			err = bw.WriteByte(';')
-		case Colon:
-			err = bw.WriteByte(':')
-		default:
-			panic("unexpected token type")
-		}
-		if err != nil {
+		if _, err := bw.WriteString(tokenText(t)); err != nil {
 			return err
 		}
 
@@ -58,6 +25,42 @@ func Write(w io.Writer, toks []Token) error {
 	return nil
 }
 
+// tokenText returns the source text of t. Strings are written quoted,
+// whether they were quoted or text: strings in the script.
+func tokenText(t Token) string {
+	switch t := t.(type) {
+	case Identifier:
+		return t.Text
+	case Number:
+		if t.Quantifier != None {
+			return fmt.Sprintf("%d%s", t.Value, string(t.Quantifier))
+		}
+		return fmt.Sprintf("%d", t.Value)
+	case String:
+		return formatString(t.Text)
+	case ListStart:
+		return "["
+	case ListEnd:
+		return "]"
+	case TestListStart:
+		return "("
+	case TestListEnd:
+		return ")"
+	case BlockStart:
+		return "{"
+	case BlockEnd:
+		return "}"
+	case Comma:
+		return ","
+	case Semicolon:
+		return ";"
+	case Colon:
+		return ":"
+	default:
+		panic("unexpected token type")
+	}
+}
+
 func formatString(s string) string {
 	esc := strings.Builder{}
 	esc.WriteByte('"')
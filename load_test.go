@@ -0,0 +1,167 @@
+package sieve
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/migadu/go-sieve/interp"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("sibling.sieve", `keep;`)
+	write("main.sieve", `require "vnd.dovecot.testsuite";
+test "sibling" {
+	if not test_script_compile "sibling.sieve" {
+		test_fail "sibling script not found next to main.sieve";
+	}
+}
+`)
+
+	opts := DefaultOptions()
+	opts.Interp.T = t
+	script, err := LoadFile(filepath.Join(dir, "main.sieve"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The namespace defaults to the directory of the script file.
+	data := NewRuntimeData(script, interp.DummyPolicy{}, interp.EnvelopeStatic{}, interp.MessageStatic{})
+	if data.Namespace == nil {
+		t.Fatal("NewRuntimeData did not set the namespace of the script file")
+	}
+	if err := script.Execute(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+
+	// An explicit namespace takes precedence.
+	override := fstest.MapFS{"sibling.sieve": {Data: []byte(`discard;`)}}
+	data = NewRuntimeData(script, interp.DummyPolicy{}, interp.EnvelopeStatic{}, interp.MessageStatic{}, override)
+	if _, err := data.Namespace.Open("sibling.sieve"); err != nil {
+		t.Fatal("explicit namespace was not used:", err)
+	}
+
+	if _, err := LoadFile(filepath.Join(dir, "missing.sieve"), opts); err == nil {
+		t.Fatal("LoadFile succeeded for a missing file")
+	}
+}
+
+func TestCompileWarnings(t *testing.T) {
+	compile := func(t *testing.T, script string) []Warning {
+		t.Helper()
+		_, warnings, err := Compile(strings.NewReader(script), testOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return warnings
+	}
+
+	t.Run("unreachable-after-stop", func(t *testing.T) {
+		warnings := compile(t, "keep;\nstop;\ndiscard;\n")
+		if len(warnings) != 1 {
+			t.Fatalf("warnings = %v, want one", warnings)
+		}
+		if got := warnings[0].String(); got != "3:1: discard is never executed, it follows stop" {
+			t.Errorf("warning = %q", got)
+		}
+	})
+	t.Run("unreachable-in-block", func(t *testing.T) {
+		warnings := compile(t, "if true {\n  stop;\n  keep;\n}\ndiscard;\n")
+		if len(warnings) != 1 || warnings[0].Line != 3 {
+			t.Errorf("warnings = %v, want one on line 3", warnings)
+		}
+	})
+	t.Run("unreachable-after-if-else", func(t *testing.T) {
+		script := "if true { stop; } elsif false { discard; stop; } else { stop; }\nkeep;\n"
+		warnings := compile(t, script)
+		if len(warnings) != 1 || warnings[0].Line != 2 {
+			t.Errorf("warnings = %v, want one on line 2", warnings)
+		}
+	})
+	t.Run("guarded-stop", func(t *testing.T) {
+		for _, script := range []string{
+			`if true { stop; } keep;`,
+			`if true { stop; } elsif false { stop; } keep;`,
+			`if true { stop; } else { discard; } keep;`,
+			`discard; keep;`,
+		} {
+			if warnings := compile(t, script); len(warnings) != 0 {
+				t.Errorf("%s: unexpected warnings: %v", script, warnings)
+			}
+		}
+	})
+	t.Run("redundant-require", func(t *testing.T) {
+		warnings := compile(t, `require ["fileinto", "comparator-i;octet", "fileinto"]; keep;`)
+		if len(warnings) != 2 {
+			t.Errorf("warnings = %v, want two", warnings)
+		}
+	})
+	t.Run("duplicate-fileinto", func(t *testing.T) {
+		warnings := compile(t, `require "fileinto"; fileinto "A"; fileinto "B"; fileinto "A";`)
+		if len(warnings) != 1 {
+			t.Errorf("warnings = %v, want one", warnings)
+		}
+	})
+	t.Run("clean", func(t *testing.T) {
+		script := `require "fileinto"; if header :contains "Subject" "x" { fileinto "A"; stop; } fileinto "A";`
+		if warnings := compile(t, script); len(warnings) != 0 {
+			t.Errorf("unexpected warnings: %v", warnings)
+		}
+	})
+}
+
+func TestEvalTest(t *testing.T) {
+	ctx := context.Background()
+	msg, err := interp.ReadMessage(strings.NewReader(eml), interp.HeaderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := interp.EnvelopeStatic{From: "coyote@desert.example.org", To: "roadrunner@acme.example.com"}
+	data := NewRuntimeData(nil, interp.DummyPolicy{}, env, msg)
+
+	for _, tc := range []struct {
+		test string
+		want bool
+	}{
+		{`address :is "From" "coyote@desert.example.org"`, true},
+		{`address :is "From" "x"`, false},
+		{`address :domain :is "To" "acme.example.com"`, true},
+		{`not header :contains "Subject" "present"`, false},
+		{`allof (exists "From", envelope :localpart :is "to" "roadrunner")`, true},
+	} {
+		t.Run(tc.test, func(t *testing.T) {
+			got, err := EvalTest(ctx, tc.test, testOptions(), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("EvalTest = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	for _, bad := range []string{
+		``,
+		`address :is "From"`,
+		`true { discard; } if true`,
+	} {
+		if _, err := EvalTest(ctx, bad, testOptions(), data); err == nil {
+			t.Errorf("EvalTest(%q) succeeded, expected an error", bad)
+		}
+	}
+	if _, err := EvalTest(ctx, `envelope :is "from" "x"`, DefaultOptions(), data); err == nil {
+		t.Error("EvalTest succeeded for a test whose extension is not enabled")
+	}
+	if data.Script != nil || !data.ImplicitKeep {
+		t.Error("EvalTest modified data")
+	}
+}
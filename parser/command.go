@@ -8,7 +8,7 @@ type Arg interface {
 }
 
 type NumberArg struct {
-	Value int
+	Value int64
 	lexer.Position
 }
 
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"math"
+
 	"github.com/migadu/go-sieve/lexer"
 )
 
@@ -87,9 +89,14 @@ func readArguments(s *lexer.Stream, forTest bool, nesting int, opts *Options) ([
 		switch tok := tok.(type) {
 		case lexer.Semicolon, lexer.BlockStart:
 			return args, tests, nil
+		case lexer.BlockEnd:
+			if !forTest {
+				return nil, nil, lexer.SyntaxErrorAt(tok, "reading arguments: missing semicolon before closing brace")
+			}
+			return nil, nil, lexer.SyntaxErrorAt(tok, "reading arguments: expected arguments or block, got closing brace")
 		case lexer.Comma, lexer.TestListEnd:
 			if !forTest {
-				return nil, nil, s.Err("reading arguments: expected semicolon or arguments or block, got %v", tok)
+				return nil, nil, lexer.SyntaxErrorAt(tok, "reading arguments: expected semicolon or arguments or block, got %v", tok)
 			}
 			return args, tests, nil
 		case lexer.String:
@@ -104,7 +111,11 @@ func readArguments(s *lexer.Stream, forTest bool, nesting int, opts *Options) ([
 			args = append(args, StringListArg{Value: list, Position: tok.Position})
 		case lexer.Number:
 			s.Pop()
-			args = append(args, NumberArg{Value: tok.Value * tok.Quantifier.Multiplier(), Position: tok.Position})
+			mult := tok.Quantifier.Multiplier()
+			if tok.Value > math.MaxInt64/mult {
+				return nil, nil, lexer.SyntaxErrorAt(tok, "number is too large: %v", tok)
+			}
+			args = append(args, NumberArg{Value: tok.Value * mult, Position: tok.Position})
 		case lexer.Colon:
 			s.Pop() // colon
 			idT := s.Pop()
@@ -140,7 +151,7 @@ func readArguments(s *lexer.Stream, forTest bool, nesting int, opts *Options) ([
 			}
 			return args, tests, nil
 		default:
-			return nil, nil, s.Err("reading arguments: expected semicolon or arguments or block. got %v", tok)
+			return nil, nil, lexer.SyntaxErrorAt(tok, "reading arguments: expected semicolon or arguments or block. got %v", tok)
 		}
 	}
 }
@@ -148,6 +159,7 @@ func readArguments(s *lexer.Stream, forTest bool, nesting int, opts *Options) ([
 func readTestList(s *lexer.Stream, nesting int, opts *Options) ([]Test, error) {
 	needTest := true
 	res := []Test{}
+	var lastComma *lexer.Comma
 	for {
 		tok := s.Pop()
 		if tok == nil {
@@ -175,8 +187,12 @@ func readTestList(s *lexer.Stream, nesting int, opts *Options) ([]Test, error) {
 				return nil, s.Err("reading test list: expected identifier or list end, got comma")
 			}
 			needTest = true
+			lastComma = &tok
 		case lexer.TestListEnd:
 			if needTest {
+				if lastComma != nil {
+					return nil, lexer.SyntaxErrorAt(*lastComma, "reading test list: unexpected comma at end of test list")
+				}
 				return nil, s.Err("reading test list: expected identifier, got closing brace")
 			}
 			return res, nil
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -185,3 +187,142 @@ func TestParser(t *testing.T) {
 		},
 	})
 }
+
+func TestParseLineEndings(t *testing.T) {
+	parseScript := func(script string) ([]Cmd, error) {
+		toks, err := lexer.Lex(strings.NewReader(script), &lexer.Options{})
+		if err != nil {
+			t.Fatal("Lexer failed:", err)
+		}
+		return Parse(lexer.NewStream(toks), &Options{})
+	}
+
+	lfCmds, err := parseScript(exampleScript)
+	if err != nil {
+		t.Fatal("LF script failed:", err)
+	}
+	crlfCmds, err := parseScript(strings.ReplaceAll(exampleScript, "\n", "\r\n"))
+	if err != nil {
+		t.Fatal("CRLF script failed:", err)
+	}
+	if !reflect.DeepEqual(lfCmds, crlfCmds) {
+		t.Log("Different parse result for LF and CRLF line endings")
+		t.Log("LF:")
+		t.Log(spew.Sdump(lfCmds))
+		t.Log("CRLF:")
+		t.Log(spew.Sdump(crlfCmds))
+		t.Fail()
+	}
+
+	// An injected error (missing semicolon) is reported at the same position.
+	broken := strings.Replace(exampleScript, `fileinto "filter";`, `fileinto "filter"`, 1)
+	_, lfErr := parseScript(broken)
+	_, crlfErr := parseScript(strings.ReplaceAll(broken, "\n", "\r\n"))
+	if lfErr == nil || crlfErr == nil {
+		t.Fatalf("expected errors, got LF: %v, CRLF: %v", lfErr, crlfErr)
+	}
+	if lfErr.Error() != crlfErr.Error() {
+		t.Errorf("different error for LF (%v) and CRLF (%v)", lfErr, crlfErr)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		script    string
+		line, col int
+		msg       string
+	}{
+		{
+			"missing-semicolon-end-of-block",
+			"if true {\n  keep\n}\n",
+			3, 1, "reading arguments: missing semicolon before closing brace",
+		},
+		{
+			"missing-semicolon-nested-block",
+			"if true {\n  if false { stop }\n}\n",
+			2, 19, "reading arguments: missing semicolon before closing brace",
+		},
+		{
+			"trailing-comma-test-list",
+			"if anyof(true, false,) { keep; }\n",
+			1, 21, "reading test list: unexpected comma at end of test list",
+		},
+		{
+			"trailing-comma-nested-test-list",
+			"if allof(true,\n  anyof(false, true, )) { keep; }\n",
+			2, 20, "reading test list: unexpected comma at end of test list",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			toks, err := lexer.Lex(strings.NewReader(tc.script), &lexer.Options{})
+			if err != nil {
+				t.Fatal("Lexer failed:", err)
+			}
+			_, err = Parse(lexer.NewStream(toks), &Options{})
+			if err == nil {
+				t.Fatal("expected a parse error")
+			}
+			var serr lexer.SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("error %q is not a lexer.SyntaxError", err)
+			}
+			if serr.Pos.Line != tc.line || serr.Pos.Col != tc.col || serr.Msg != tc.msg {
+				t.Errorf("error = %d:%d: %s, want %d:%d: %s", serr.Pos.Line, serr.Pos.Col, serr.Msg, tc.line, tc.col, tc.msg)
+			}
+		})
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		script string
+		want   lexer.SyntaxError
+	}{
+		{
+			"unexpected-token",
+			"require \"fileinto\";\nif header :is \"Subject\" \"x\" {\n  fileinto \"a\" ];\n}\n",
+			lexer.SyntaxError{
+				Pos:   lexer.Position{File: "broken.sieve", Line: 3, Col: 16},
+				Token: "]",
+				Msg:   "reading arguments: expected semicolon or arguments or block. got ListEnd()",
+			},
+		},
+		{
+			"trailing-comma",
+			"if anyof(true,\n  false, ) {\n  keep;\n}\n",
+			lexer.SyntaxError{
+				Pos:   lexer.Position{File: "broken.sieve", Line: 2, Col: 8},
+				Token: ",",
+				Msg:   "reading test list: unexpected comma at end of test list",
+			},
+		},
+		{
+			"end-of-script",
+			"if true {\n  keep;\n",
+			lexer.SyntaxError{
+				Pos: lexer.Position{File: "broken.sieve", Line: 2, Col: 7},
+				Msg: "reading command: expected a closing brace",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			toks, err := lexer.Lex(strings.NewReader(tc.script), &lexer.Options{Filename: "broken.sieve"})
+			if err != nil {
+				t.Fatal("Lexer failed:", err)
+			}
+			_, err = Parse(lexer.NewStream(toks), &Options{})
+			var serr lexer.SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("error %v is not a lexer.SyntaxError", err)
+			}
+			if serr != tc.want {
+				t.Errorf("error = %+v, want %+v", serr, tc.want)
+			}
+			if prefix := fmt.Sprintf("%d:%d: ", tc.want.Pos.Line, tc.want.Pos.Col); !strings.HasPrefix(err.Error(), prefix) {
+				t.Errorf("error %q does not start with %q", err, prefix)
+			}
+		})
+	}
+}
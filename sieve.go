@@ -1,7 +1,13 @@
 package sieve
 
 import (
+	"context"
+	"errors"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/migadu/go-sieve/interp"
 	"github.com/migadu/go-sieve/lexer"
@@ -11,6 +17,11 @@ import (
 type (
 	Script      = interp.Script
 	RuntimeData = interp.RuntimeData
+	Warning     = interp.Warning
+	ScriptStats = interp.ScriptStats
+
+	ExtensionRequiredError = interp.ExtensionRequiredError
+	SyntaxError            = lexer.SyntaxError
 
 	PolicyReader = interp.PolicyReader
 	Message      = interp.Message
@@ -38,9 +49,16 @@ func DefaultOptions() Options {
 		},
 		Interp: interp.Options{
 			MaxRedirects:       5,
+			MaxExecutionSteps:  10000,
 			MaxVariableCount:   128,
 			MaxVariableNameLen: 32,
 			MaxVariableLen:     4000,
+			MaxMimeParts:       1000,
+			MaxBodyScan:        10 << 20,
+			HeaderLimits: interp.HeaderLimits{
+				MaxHeaderCount:    1000,
+				MaxHeaderValueLen: 64 << 10,
+			},
 		},
 		EnabledExtensions: nil, // nil means no extensions enabled
 	}
@@ -60,6 +78,93 @@ func Load(r io.Reader, opts Options) (*Script, error) {
 	return interp.LoadScript(cmds, &opts.Interp, opts.EnabledExtensions)
 }
 
-func NewRuntimeData(s *Script, p interp.PolicyReader, e interp.Envelope, msg interp.Message) *interp.RuntimeData {
-	return interp.NewRuntimeData(s, p, e, msg)
+// Compile is like Load but also returns warnings about constructs that are
+// valid but most likely mistakes, such as commands following stop.
+func Compile(r io.Reader, opts Options) (*Script, []Warning, error) {
+	s, err := Load(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s.Warnings(), nil
+}
+
+// EvalTest evaluates a single test, such as `address :is "From" "x"`,
+// against the message and envelope in data, without a full script. The
+// extensions in opts.EnabledExtensions are available to the test as if
+// required. data, which may have been created without a script, is not
+// modified.
+func EvalTest(ctx context.Context, testSource string, opts Options, data *RuntimeData) (bool, error) {
+	toks, err := lexer.Lex(strings.NewReader(testSource), &opts.Lexer)
+	if err != nil {
+		return false, err
+	}
+	if len(toks) == 0 {
+		return false, errors.New("EvalTest: empty test")
+	}
+
+	// Parse the test as the condition of "if <test> {}".
+	line, col := toks[0].LineCol()
+	start := lexer.Position{File: opts.Lexer.Filename, Line: line, Col: col}
+	line, col = toks[len(toks)-1].LineCol()
+	end := lexer.Position{File: opts.Lexer.Filename, Line: line, Col: col}
+	wrapped := append([]lexer.Token{lexer.Identifier{Position: start, Text: "if"}}, toks...)
+	wrapped = append(wrapped, lexer.BlockStart{Position: end}, lexer.BlockEnd{Position: end})
+	cmds, err := parser.Parse(lexer.NewStream(wrapped), &opts.Parser)
+	if err != nil {
+		return false, err
+	}
+	if len(cmds) != 1 || len(cmds[0].Args) != 0 || len(cmds[0].Tests) != 1 || len(cmds[0].Block) != 0 {
+		return false, errors.New("EvalTest: source is not a single test")
+	}
+
+	var require []parser.Cmd
+	if len(opts.EnabledExtensions) != 0 {
+		require = append(require, parser.Cmd{
+			Id:   "require",
+			Args: []parser.Arg{parser.StringListArg{Value: opts.EnabledExtensions}},
+		})
+	}
+	script, err := interp.LoadScript(require, &opts.Interp, opts.EnabledExtensions)
+	if err != nil {
+		return false, err
+	}
+	test, err := interp.LoadTest(script, cmds[0].Tests[0])
+	if err != nil {
+		return false, err
+	}
+
+	d := data.Copy()
+	d.Script = script
+	return test.Check(ctx, d)
+}
+
+// LoadFile loads the script at path. Unless already set in opts, the lexer
+// filename is the base name of path and the script namespace is the
+// directory containing it, so files referenced by the script resolve
+// relative to the script file.
+func LoadFile(path string, opts Options) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if opts.Lexer.Filename == "" {
+		opts.Lexer.Filename = filepath.Base(path)
+	}
+	if opts.Interp.Namespace == nil {
+		opts.Interp.Namespace = os.DirFS(filepath.Dir(path))
+	}
+	return Load(f, opts)
+}
+
+// NewRuntimeData creates the runtime state for executing s. The namespace
+// defaults to the one the script was loaded with (see LoadFile) and can be
+// overridden by passing one explicitly.
+func NewRuntimeData(s *Script, p interp.PolicyReader, e interp.Envelope, msg interp.Message, namespace ...fs.FS) *interp.RuntimeData {
+	d := interp.NewRuntimeData(s, p, e, msg)
+	if len(namespace) != 0 {
+		d.Namespace = namespace[0]
+	}
+	return d
 }
@@ -8,3 +8,57 @@ import (
 func TestExtensionsEnvelope(t *testing.T) {
 	RunDovecotTest(t, filepath.Join("pigeonhole", "tests", "extensions", "envelope.svtest"))
 }
+
+func TestEnvelopeComposite(t *testing.T) {
+	RunDovecotTestInline(t, "", `
+require "vnd.dovecot.testsuite";
+require "envelope";
+require "envelope-dsn";
+
+test_set "envelope" "from: <sender@example.org>
+to: <user+folder@example.net>
+auth: user
+orcpt: rfc822;original@example.com
+notify: SUCCESS,FAILURE";
+
+test "Composite" {
+	if not envelope :is "from" "sender@example.org" {
+		test_fail "wrong from";
+	}
+	if not envelope :is "to" "user+folder@example.net" {
+		test_fail "wrong to";
+	}
+	if not envelope :is "auth" "user" {
+		test_fail "wrong auth";
+	}
+	if not envelope :is "orcpt" "original@example.com" {
+		test_fail "wrong orcpt";
+	}
+	if not envelope :contains "notify" "FAILURE" {
+		test_fail "wrong notify";
+	}
+}
+
+test_set "envelope.orcpt" "rfc822;other@example.com";
+
+test "Part" {
+	if not envelope :is "orcpt" "other@example.com" {
+		test_fail "orcpt not replaced";
+	}
+	if not envelope :is "from" "sender@example.org" {
+		test_fail "from lost";
+	}
+}
+
+test_set "envelope" "to: <recipient@example.com>";
+
+test "Reset" {
+	if not envelope :is "from" "" {
+		test_fail "from not reset";
+	}
+	if envelope :matches "orcpt" "*" {
+		test_fail "orcpt not reset";
+	}
+}
+`)
+}
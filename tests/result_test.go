@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResultExecute(t *testing.T) {
+	dir := t.TempDir()
+	script := `require ["fileinto", "copy"];
+fileinto "Archive";
+redirect :copy "other@example.com";
+keep;
+`
+	if err := os.WriteFile(filepath.Join(dir, "actions.sieve"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	RunDovecotTestInline(t, dir, `
+require "vnd.dovecot.testsuite";
+require "relational";
+require "comparator-i;ascii-numeric";
+
+test "Actions" {
+	if not test_script_compile "actions.sieve" {
+		test_fail "script failed to compile";
+	}
+	if not test_script_run {
+		test_fail "script failed to run";
+	}
+	if not test_result_action :count "eq" :comparator "i;ascii-numeric" "3" {
+		test_fail "wrong number of actions";
+	}
+	if not test_result_action :index 1 "store" {
+		test_fail "first action is not 'store'";
+	}
+	if not test_result_action :index 2 "redirect" {
+		test_fail "second action is not 'redirect'";
+	}
+	if not test_result_action :index 3 "keep" {
+		test_fail "third action is not 'keep'";
+	}
+	if test_result_action "discard" {
+		test_fail "unexpected discard action";
+	}
+	if not test_result_execute {
+		test_fail "result execute failed";
+	}
+}
+
+test "Reset" {
+	if not test_script_compile "actions.sieve" {
+		test_fail "script failed to compile";
+	}
+	if not test_script_run {
+		test_fail "script failed to run";
+	}
+	test_result_reset;
+	if test_result_action :matches "*" {
+		test_fail "actions left after test_result_reset";
+	}
+}
+`)
+}
+
+func TestResultMessage(t *testing.T) {
+	dir := t.TempDir()
+	for name, script := range map[string]string{
+		"deliver.sieve": `require ["fileinto", "editheader"];
+addheader "X-Filed" "yes";
+fileinto "Archive";
+deleteheader "X-Filed";
+redirect "other@example.com";
+`,
+		"implicit.sieve": `require "editheader";
+addheader "X-Kept" "implicitly";
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	RunDovecotTestInline(t, dir, `
+require "vnd.dovecot.testsuite";
+require "envelope";
+
+test_set "message" text:
+From: sender@example.com
+Subject: hello
+
+Body.
+.
+;
+
+test "Stored and sent" {
+	if not test_script_compile "deliver.sieve" {
+		test_fail "script failed to compile";
+	}
+	if not test_script_run {
+		test_fail "script failed to run";
+	}
+	if not test_result_execute {
+		test_fail "result execute failed";
+	}
+
+	test_message :folder "Archive" 0;
+	if not header :is "X-Filed" "yes" {
+		test_fail "the stored message lacks the header added before fileinto";
+	}
+
+	test_message :smtp 0;
+	if exists "X-Filed" {
+		test_fail "the sent message has the header deleted before redirect";
+	}
+	if not header :is "Subject" "hello" {
+		test_fail "the sent message is not the one the script ran on";
+	}
+	if not envelope :is "to" "other@example.com" {
+		test_fail "the sent message has the wrong envelope recipient";
+	}
+}
+
+test "Implicit keep" {
+	if not test_script_compile "implicit.sieve" {
+		test_fail "script failed to compile";
+	}
+	if not test_script_run {
+		test_fail "script failed to run";
+	}
+	if not test_result_execute {
+		test_fail "result execute failed";
+	}
+
+	test_message :folder "INBOX" 0;
+	if not header :is "X-Kept" "implicitly" {
+		test_fail "the implicit keep did not store the edited message";
+	}
+}
+`)
+}
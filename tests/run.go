@@ -1,11 +1,9 @@
 package tests
 
 import (
-	"bytes"
 	"context"
 	"net/textproto"
 	"os"
-	"path/filepath"
 	"strings"
 	"testing"
 
@@ -17,6 +15,8 @@ func RunDovecotTestInline(t *testing.T, baseDir string, scriptText string) {
 	opts := sieve.DefaultOptions()
 	opts.Lexer.Filename = "inline"
 	opts.Interp.T = t
+	opts.Interp.AddressLiteralFallback = true
+	opts.Interp.DropInvalidFlags = true
 	// Enable all extensions for Dovecot tests
 	opts.EnabledExtensions = []string{
 		"fileinto", "envelope", "encoded-character",
@@ -24,6 +24,7 @@ func RunDovecotTestInline(t *testing.T, baseDir string, scriptText string) {
 		"comparator-i;ascii-numeric", "comparator-i;unicode-casemap",
 		"imap4flags", "variables", "relational", "vacation", "copy", "regex",
 		"date", "index", "editheader", "mailbox", "subaddress", "body",
+		"envelope-dsn", "vnd.dovecot.debug",
 	}
 
 	script, err := sieve.Load(strings.NewReader(scriptText), opts)
@@ -63,14 +64,10 @@ func RunDovecotTestInline(t *testing.T, baseDir string, scriptText string) {
 }
 
 func RunDovecotTestWithout(t *testing.T, path string, disabledTests []string) {
-	svScript, err := os.ReadFile(path)
-	if err != nil {
-		t.Fatal(err)
-	}
-
 	opts := sieve.DefaultOptions()
-	opts.Lexer.Filename = filepath.Base(path)
 	opts.Interp.T = t
+	opts.Interp.AddressLiteralFallback = true
+	opts.Interp.DropInvalidFlags = true
 	opts.Interp.DisabledTests = disabledTests
 	// Enable all extensions for Dovecot tests
 	opts.EnabledExtensions = []string{
@@ -79,9 +76,10 @@ func RunDovecotTestWithout(t *testing.T, path string, disabledTests []string) {
 		"comparator-i;ascii-numeric", "comparator-i;unicode-casemap",
 		"imap4flags", "variables", "relational", "vacation", "copy", "regex",
 		"date", "index", "editheader", "mailbox", "subaddress", "body",
+		"envelope-dsn", "vnd.dovecot.debug",
 	}
 
-	script, err := sieve.Load(bytes.NewReader(svScript), opts)
+	script, err := sieve.LoadFile(path, opts)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -91,7 +89,6 @@ func RunDovecotTestWithout(t *testing.T, path string, disabledTests []string) {
 	// Empty data.
 	data := sieve.NewRuntimeData(script, interp.DummyPolicy{},
 		interp.EnvelopeStatic{}, interp.MessageStatic{})
-	data.Namespace = os.DirFS(filepath.Dir(path))
 
 	err = script.Execute(ctx, data)
 	if err != nil {
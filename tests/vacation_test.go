@@ -2,6 +2,7 @@ package tests
 
 import (
 	"context"
+	"net/textproto"
 	"strings"
 	"testing"
 
@@ -21,6 +22,8 @@ func TestVacation(t *testing.T) {
 		expectedHandle    string
 		expectedDays      int
 		expectedRecipient string
+		headers           map[string]string
+		expectSuppressed  interp.VacationSuppression
 	}{
 		{
 			name:              "BasicVacation",
@@ -49,10 +52,142 @@ func TestVacation(t *testing.T) {
 			expectedRecipient: "sender@example.com",
 		},
 		{
-			name:           "NoVacationResponseToOwnAddresses",
-			script:         `require ["vacation"]; vacation :addresses ["sender@example.com", "other@example.com"] "Away.";`,
-			envFrom:        "sender@example.com",
-			expectResponse: false,
+			name:              "VacationDaysClamped",
+			script:            `require ["vacation"]; vacation :days 4294967296 "Away.";`,
+			envFrom:           "sender@example.com",
+			expectResponse:    true,
+			expectedSubject:   "Automated reply",
+			expectedBody:      "Away.",
+			expectedDays:      interp.MaxVacationDays,
+			expectedRecipient: "sender@example.com",
+		},
+		{
+			name:             "NoVacationResponseToOwnAddresses",
+			script:           `require ["vacation"]; vacation :addresses ["sender@example.com", "other@example.com"] "Away.";`,
+			envFrom:          "sender@example.com",
+			expectResponse:   false,
+			expectSuppressed: interp.VacationOwnAddress,
+		},
+		{
+			name:             "NoVacationResponseToOwnAddressesCaseInsensitive",
+			script:           `require ["vacation"]; vacation :addresses "Sender@Example.com" "Away.";`,
+			envFrom:          "sender@example.com",
+			expectResponse:   false,
+			expectSuppressed: interp.VacationOwnAddress,
+		},
+		{
+			name:             "NoVacationResponseToOwnAddressesDisplayName",
+			script:           `require ["vacation"]; vacation :addresses "Me Myself <SENDER@EXAMPLE.COM>" "Away.";`,
+			envFrom:          "sender@Example.com",
+			expectResponse:   false,
+			expectSuppressed: interp.VacationOwnAddress,
+		},
+		{
+			name:             "NoVacationResponseToRecipient",
+			script:           `require ["vacation"]; vacation "Away.";`,
+			envFrom:          "Recipient@EXAMPLE.com",
+			expectResponse:   false,
+			expectSuppressed: interp.VacationOwnAddress,
+		},
+		{
+			name:             "NoVacationResponseWithoutSender",
+			script:           `require ["vacation"]; vacation "Away.";`,
+			envFrom:          "",
+			expectResponse:   false,
+			expectSuppressed: interp.VacationNoSender,
+		},
+		{
+			name:             "NoVacationResponseToAutoSubmitted",
+			script:           `require ["vacation"]; vacation "Away.";`,
+			envFrom:          "sender@example.com",
+			headers:          map[string]string{"Auto-Submitted": "auto-replied"},
+			expectResponse:   false,
+			expectSuppressed: interp.VacationBulkMail,
+		},
+		{
+			name:             "NoVacationResponseToMailingList",
+			script:           `require ["vacation"]; vacation "Away.";`,
+			envFrom:          "sender@example.com",
+			headers:          map[string]string{"List-Id": "<list.example.com>"},
+			expectResponse:   false,
+			expectSuppressed: interp.VacationBulkMail,
+		},
+		{
+			name:              "VacationResponseAutoSubmittedNo",
+			script:            `require ["vacation"]; vacation "Away.";`,
+			envFrom:           "sender@example.com",
+			headers:           map[string]string{"Auto-Submitted": "no"},
+			expectResponse:    true,
+			expectedSubject:   "Automated reply",
+			expectedBody:      "Away.",
+			expectedDays:      7,
+			expectedRecipient: "sender@example.com",
+		},
+		{
+			name:              "VacationSubjectFromMessage",
+			script:            `require ["vacation"]; vacation "Away.";`,
+			envFrom:           "sender@example.com",
+			headers:           map[string]string{"Subject": "Lunch on =?UTF-8?Q?Fr=C3=A9d=C3=A9ric?="},
+			expectResponse:    true,
+			expectedSubject:   "Auto: Lunch on Frédéric",
+			expectedBody:      "Away.",
+			expectedDays:      7,
+			expectedRecipient: "sender@example.com",
+		},
+		{
+			name:              "VacationSubjectAlreadyAuto",
+			script:            `require ["vacation"]; vacation "Away.";`,
+			envFrom:           "sender@example.com",
+			headers:           map[string]string{"Subject": "AUTO: Lunch"},
+			expectResponse:    true,
+			expectedSubject:   "AUTO: Lunch",
+			expectedBody:      "Away.",
+			expectedDays:      7,
+			expectedRecipient: "sender@example.com",
+		},
+		{
+			name:              "VacationSubjectTruncated",
+			script:            `require ["vacation"]; vacation "Away.";`,
+			envFrom:           "sender@example.com",
+			headers:           map[string]string{"Subject": strings.Repeat("é", 200)},
+			expectResponse:    true,
+			expectedSubject:   "Auto: " + strings.Repeat("é", 122) + "...",
+			expectedBody:      "Away.",
+			expectedDays:      7,
+			expectedRecipient: "sender@example.com",
+		},
+		{
+			name:              "VacationSubjectAlreadyAutoTruncated",
+			script:            `require ["vacation"]; vacation "Away.";`,
+			envFrom:           "sender@example.com",
+			headers:           map[string]string{"Subject": "Auto: " + strings.Repeat("x", 200)},
+			expectResponse:    true,
+			expectedSubject:   "Auto: " + strings.Repeat("x", 122) + "...",
+			expectedBody:      "Away.",
+			expectedDays:      7,
+			expectedRecipient: "sender@example.com",
+		},
+		{
+			name:              "VacationSubjectControlCharacters",
+			script:            `require ["vacation"]; vacation "Away.";`,
+			envFrom:           "sender@example.com",
+			headers:           map[string]string{"Subject": "=?UTF-8?Q?hi=0D=0ABcc:_victim@example.org?="},
+			expectResponse:    true,
+			expectedSubject:   "Auto: hi  Bcc: victim@example.org",
+			expectedBody:      "Away.",
+			expectedDays:      7,
+			expectedRecipient: "sender@example.com",
+		},
+		{
+			name:              "VacationExplicitSubject",
+			script:            `require ["vacation"]; vacation :subject "Away" "Away.";`,
+			envFrom:           "sender@example.com",
+			headers:           map[string]string{"Subject": "Lunch"},
+			expectResponse:    true,
+			expectedSubject:   "Away",
+			expectedBody:      "Away.",
+			expectedDays:      7,
+			expectedRecipient: "sender@example.com",
 		},
 	}
 
@@ -73,13 +208,22 @@ func TestVacation(t *testing.T) {
 				To:   "recipient@example.com",
 			}
 
-			data := sieve.NewRuntimeData(parsedScript, interp.DummyPolicy{}, env, interp.MessageStatic{})
+			hdr := make(textproto.MIMEHeader)
+			for k, v := range tc.headers {
+				hdr.Set(k, v)
+			}
+
+			data := sieve.NewRuntimeData(parsedScript, interp.DummyPolicy{}, env, interp.MessageStatic{Header: hdr})
 
 			err = parsedScript.Execute(ctx, data)
 			if err != nil {
 				t.Fatalf("Script execution failed: %v", err)
 			}
 
+			if data.VacationSuppressed != tc.expectSuppressed {
+				t.Errorf("Expected suppression reason %q, got %q", tc.expectSuppressed, data.VacationSuppressed)
+			}
+
 			if !tc.expectResponse {
 				if len(data.VacationResponses) != 0 {
 					t.Fatalf("Expected no vacation responses, got %d", len(data.VacationResponses))
@@ -114,3 +258,64 @@ func TestVacation(t *testing.T) {
 		})
 	}
 }
+
+func TestVacationResponseHeader(t *testing.T) {
+	resp := interp.VacationResponse{
+		From:    "Zoë Müller <zoe@example.com>",
+		Subject: "Abwesenheit: zurück am Montag",
+		Body:    "Ich bin im Urlaub.",
+	}
+	h := resp.Header("sender@example.org")
+
+	subject := h.Get("Subject")
+	if subject == resp.Subject || !strings.HasPrefix(subject, "=?utf-8?") {
+		t.Errorf("Subject not encoded: %q", subject)
+	}
+	if decoded, err := h.Text("Subject"); err != nil || decoded != resp.Subject {
+		t.Errorf("Subject decodes to %q, %v", decoded, err)
+	}
+	if from := h.Get("From"); !strings.HasSuffix(from, "<zoe@example.com>") || !strings.HasPrefix(from, "=?utf-8?") {
+		t.Errorf("From not encoded: %q", from)
+	}
+	if got := h.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := h.Get("Auto-Submitted"); got != "auto-replied" {
+		t.Errorf("Auto-Submitted = %q", got)
+	}
+
+	ascii := interp.VacationResponse{Subject: "Away", IsMime: true}
+	h = ascii.Header("sender@example.org")
+	if got := h.Get("Subject"); got != "Away" {
+		t.Errorf("ASCII Subject = %q", got)
+	}
+	if h.Has("Content-Type") {
+		t.Error("Content-Type set for a :mime reason")
+	}
+}
+
+func TestVacationCaseSensitiveLocalParts(t *testing.T) {
+	for _, tc := range []struct {
+		sensitive bool
+		respond   bool
+	}{
+		{false, false},
+		{true, true},
+	} {
+		opts := sieve.DefaultOptions()
+		opts.EnabledExtensions = []string{"vacation"}
+		opts.Interp.CaseSensitiveLocalParts = tc.sensitive
+		script, err := sieve.Load(strings.NewReader(`require "vacation"; vacation :addresses "Sender@example.com" "Away.";`), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := interp.EnvelopeStatic{From: "sender@EXAMPLE.com", To: "recipient@example.com"}
+		data := sieve.NewRuntimeData(script, interp.DummyPolicy{}, env, interp.MessageStatic{Header: make(textproto.MIMEHeader)})
+		if err := script.Execute(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(data.VacationResponses) != 0; got != tc.respond {
+			t.Errorf("CaseSensitiveLocalParts = %v: responded = %v, want %v", tc.sensitive, got, tc.respond)
+		}
+	}
+}